@@ -47,10 +47,11 @@ const TwitchDialog: React.FC<Props> = ({ open, onClose }) => {
   const baseURL = useAtomValue(serverURL)
 
   const submit = async (channelURL: string) => {
-    const task = ffetch<void>(`${baseURL}/twitch/user`, {
+    const task = ffetch<void>(`${baseURL}/channels`, {
       method: 'POST',
       body: JSON.stringify({
-        user: channelURL.split('/').at(-1)
+        url: `https://www.twitch.tv/${channelURL.split('/').at(-1)}`,
+        source: 'twitch',
       })
     })
     const either = await task()
@@ -45,6 +45,7 @@ export enum ProcessStatus {
   COMPLETED,
   ERRORED,
   LIVESTREAM,
+  CORRUPT,
 }
 
 type DownloadProgress = {
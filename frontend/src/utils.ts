@@ -68,6 +68,8 @@ export function mapProcessStatus(status: ProcessStatus) {
       return 'Error'
     case ProcessStatus.LIVESTREAM:
       return 'Livestream'
+    case ProcessStatus.CORRUPT:
+      return 'Corrupt'
     default:
       return 'Pending'
   }
@@ -16,6 +16,13 @@ import { useToast } from '../hooks/toast'
 import useFetch from '../hooks/useFetch'
 import { ffetch } from '../lib/httpClient'
 
+type Channel = {
+  url: string
+  settings: {
+    source?: string
+  }
+}
+
 const TwitchView: React.FC = () => {
   const { pushMessage } = useToast()
 
@@ -23,12 +30,15 @@ const TwitchView: React.FC = () => {
 
   const [openDialog, setOpenDialog] = useState(false)
 
-  const { data: users, fetcher: refetch } = useFetch<Array<string>>('/twitch/users')
+  const { data: channels, fetcher: refetch } = useFetch<Array<Channel>>('/channels')
+
+  // twitch users are monitored as channels of the twitch source
+  const users = channels?.filter(c => c.settings.source === 'twitch')
 
   const [isPending, startTransition] = useTransition()
 
-  const deleteUser = async (user: string) => {
-    const task = ffetch<void>(`${baseURL}/twitch/user/${user}`, {
+  const deleteUser = async (url: string) => {
+    const task = ffetch<void>(`${baseURL}/channels?url=${encodeURIComponent(url)}`, {
       method: 'DELETE',
     })
     const either = await task()
@@ -63,8 +73,9 @@ const TwitchView: React.FC = () => {
             }}>
               {users.map(user => (
                 <Chip
-                  label={user}
-                  onDelete={() => startTransition(async () => await deleteUser(user))}
+                  key={user.url}
+                  label={user.url.split('/').at(-1)}
+                  onDelete={() => startTransition(async () => await deleteUser(user.url))}
                 />
               ))}
             </Paper>
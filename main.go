@@ -43,9 +43,20 @@ func main() {
 	v.SetDefault("paths.download_path", ".")
 	v.SetDefault("paths.downloader_path", "yt-dlp")
 	v.SetDefault("paths.local_database_path", ".")
+	v.SetDefault("paths.ffprobe_path", "ffprobe")
+	v.SetDefault("paths.ffmpeg_path", "ffmpeg")
 	v.SetDefault("logging.log_path", "yt-dlp-webui.log")
 	v.SetDefault("logging.enable_file_logging", false)
 	v.SetDefault("authentication.require_auth", false)
+	v.SetDefault("verification.enabled", false)
+	v.SetDefault("verification.duration_tolerance", 2.0)
+	v.SetDefault("verification.max_retries", 1)
+	v.SetDefault("postprocessing.queue_size", 1)
+	v.SetDefault("hls.enabled", true)
+	v.SetDefault("hls.window", 600)
+	v.SetDefault("hls.segment_duration", 4)
+	v.SetDefault("subscriptions.max_entries", 10)
+	v.SetDefault("subscriptions.max_failures", 5)
 
 	// Env binding
 	v.SetEnvPrefix("APP")
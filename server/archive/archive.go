@@ -1,10 +1,10 @@
 package archive
 
 import (
-	"database/sql"
-
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/domain"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 // alias type
@@ -12,7 +12,7 @@ import (
 type Service = domain.Service
 type Entity = domain.ArchiveEntry
 
-func ApplyRouter(db *sql.DB) func(chi.Router) {
+func ApplyRouter(db *bolt.DB) func(chi.Router) {
 	handler, _ := Container(db)
 	return handler.ApplyRouter()
 }
@@ -1,12 +1,12 @@
 package archive
 
 import (
-	"database/sql"
-
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/domain"
+
+	bolt "go.etcd.io/bbolt"
 )
 
-func Container(db *sql.DB) (domain.RestHandler, domain.Service) {
+func Container(db *bolt.DB) (domain.RestHandler, domain.Service) {
 	var (
 		r = provideRepository(db)
 		s = provideService(r)
@@ -1,13 +1,14 @@
 package archive
 
 import (
-	"database/sql"
 	"sync"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/domain"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/repository"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/rest"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/service"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 var (
@@ -20,7 +21,7 @@ var (
 	handOnce sync.Once
 )
 
-func provideRepository(db *sql.DB) domain.Repository {
+func provideRepository(db *bolt.DB) domain.Repository {
 	repoOnce.Do(func() {
 		repo = repository.New(db)
 	})
@@ -2,153 +2,184 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/data"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/domain"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Entries keyed by a big endian sequence, the cursor of the pagination,
+	// so that they're sorted by insertion
+	bucketName = []byte("archive")
+	// Sequence of each entry keyed by its id
+	idsBucketName = []byte("archive-ids")
 )
 
 type Repository struct {
-	db *sql.DB
+	db *bolt.DB
 }
 
-func New(db *sql.DB) domain.Repository {
+func New(db *bolt.DB) domain.Repository {
+	db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(idsBucketName)
+		return err
+	})
+
 	return &Repository{
 		db: db,
 	}
 }
 
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
 func (r *Repository) Archive(ctx context.Context, entry *data.ArchiveEntry) error {
-	conn, err := r.db.Conn(ctx)
-	if err != nil {
+	// the file of an entry is removed by a hard delete
+	if err := internal.ValidateSubPath(entry.Path); err != nil {
 		return err
 	}
 
-	defer conn.Close()
-
-	_, err = conn.ExecContext(
-		ctx,
-		"INSERT INTO archive (id, title, path, thumbnail, source, metadata, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		uuid.NewString(),
-		entry.Title,
-		entry.Path,
-		entry.Thumbnail,
-		entry.Source,
-		entry.Metadata,
-		entry.CreatedAt,
-	)
-
-	return err
+	if entry.Id == "" {
+		entry.Id = uuid.NewString()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		ids := tx.Bucket(idsBucketName)
+
+		if ids.Get([]byte(entry.Id)) != nil {
+			return fmt.Errorf("archive entry %s already exists", entry.Id)
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(itob(seq), v); err != nil {
+			return err
+		}
+		return ids.Put([]byte(entry.Id), itob(seq))
+	})
 }
 
 func (r *Repository) SoftDelete(ctx context.Context, id string) (*data.ArchiveEntry, error) {
-	conn, err := r.db.Conn(ctx)
-	if err != nil {
-		return nil, err
-	}
+	var model data.ArchiveEntry
 
-	defer conn.Close()
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		ids := tx.Bucket(idsBucketName)
 
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+		seq := ids.Get([]byte(id))
+		if seq == nil {
+			return fmt.Errorf("archive entry %s not found", id)
+		}
 
-	var model data.ArchiveEntry
+		if err := json.Unmarshal(b.Get(seq), &model); err != nil {
+			return err
+		}
 
-	row := tx.QueryRowContext(ctx, "SELECT * FROM archive WHERE id = ?", id)
-
-	if err := row.Scan(
-		&model.Id,
-		&model.Title,
-		&model.Path,
-		&model.Thumbnail,
-		&model.Source,
-		&model.Metadata,
-		&model.CreatedAt,
-	); err != nil {
-		return nil, err
-	}
+		if err := b.Delete(seq); err != nil {
+			return err
+		}
+		return ids.Delete([]byte(id))
+	})
 
-	_, err = tx.ExecContext(ctx, "DELETE FROM archive WHERE id = ?", id)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
 	return &model, nil
 }
 
 func (r *Repository) HardDelete(ctx context.Context, id string) (*data.ArchiveEntry, error) {
-	entry, err := r.SoftDelete(ctx, id)
+	var model data.ArchiveEntry
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(idsBucketName).Get([]byte(id))
+		if seq == nil {
+			return fmt.Errorf("archive entry %s not found", id)
+		}
+		return json.Unmarshal(tx.Bucket(bucketName).Get(seq), &model)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := os.Remove(entry.Path); err != nil {
+	// entries stored before the path was validated or a changed download path
+	if err := internal.ValidateSubPath(model.Path); err != nil {
 		return nil, err
 	}
 
-	return entry, nil
-}
-
-func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]data.ArchiveEntry, error) {
-	conn, err := r.db.Conn(ctx)
+	entry, err := r.SoftDelete(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	defer conn.Close()
-
-	var entries []data.ArchiveEntry
-
-	// cursor based pagination
-	rows, err := conn.QueryContext(ctx, "SELECT rowid, * FROM archive WHERE rowid > ? LIMIT ?", startRowId, limit)
-	if err != nil {
+	if err := os.Remove(entry.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
-	for rows.Next() {
-		var rowId int64
-		var entry data.ArchiveEntry
-
-		if err := rows.Scan(
-			&rowId,
-			&entry.Id,
-			&entry.Title,
-			&entry.Path,
-			&entry.Thumbnail,
-			&entry.Source,
-			&entry.Metadata,
-			&entry.CreatedAt,
-		); err != nil {
-			return &entries, err
+	return entry, nil
+}
+
+func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]data.ArchiveEntry, error) {
+	entries := []data.ArchiveEntry{}
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+
+		// cursor based pagination
+		for k, v := c.Seek(itob(uint64(max(startRowId, 0)) + 1)); k != nil && len(entries) < limit; k, v = c.Next() {
+			var entry data.ArchiveEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
 		}
 
-		entries = append(entries, entry)
-	}
+		return nil
+	})
 
 	return &entries, err
 }
 
 func (r *Repository) GetCursor(ctx context.Context, id string) (int64, error) {
-	conn, err := r.db.Conn(ctx)
-	if err != nil {
-		return -1, err
-	}
-	defer conn.Close()
-
-	row := conn.QueryRowContext(ctx, "SELECT rowid FROM archive WHERE id = ?", id)
-
 	var rowId int64
 
-	if err := row.Scan(&rowId); err != nil {
+	err := r.db.View(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(idsBucketName).Get([]byte(id))
+		if seq == nil {
+			return fmt.Errorf("archive entry %s not found", id)
+		}
+		rowId = int64(binary.BigEndian.Uint64(seq))
+		return nil
+	})
+
+	if err != nil {
 		return -1, err
 	}
 
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/data"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRepository(t *testing.T) {
+	dir := t.TempDir()
+	config.Instance().Paths.DownloadPath = dir
+
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		ctx = context.Background()
+		r   = New(db)
+	)
+
+	for _, title := range []string{"first", "second", "third"} {
+		path := filepath.Join(dir, title+".mp4")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Archive(ctx, &data.ArchiveEntry{Title: title, Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := r.List(ctx, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*page) != 2 || (*page)[0].Title != "first" || (*page)[1].Title != "second" {
+		t.Fatalf("unexpected first page %+v", *page)
+	}
+	if (*page)[0].Id == "" || (*page)[0].CreatedAt.IsZero() {
+		t.Errorf("id and creation time not set %+v", (*page)[0])
+	}
+
+	cursor, err := r.GetCursor(ctx, (*page)[1].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := r.List(ctx, int(cursor), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*next) != 1 || (*next)[0].Title != "third" {
+		t.Fatalf("unexpected second page %+v", *next)
+	}
+
+	soft, err := r.SoftDelete(ctx, (*page)[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(soft.Path); err != nil {
+		t.Errorf("soft delete removed the file: %v", err)
+	}
+
+	hard, err := r.HardDelete(ctx, (*next)[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(hard.Path); !os.IsNotExist(err) {
+		t.Errorf("hard delete kept the file: %v", err)
+	}
+
+	left, err := r.List(ctx, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*left) != 1 || (*left)[0].Title != "second" {
+		t.Errorf("unexpected entries left %+v", *left)
+	}
+
+	if _, err := r.GetCursor(ctx, soft.Id); err == nil {
+		t.Error("expected an error for a deleted entry")
+	}
+
+	outside := filepath.Join(t.TempDir(), "outside.mp4")
+	if err := r.Archive(ctx, &data.ArchiveEntry{Title: "outside", Path: outside}); err == nil {
+		t.Error("expected an error for a path outside of the download path")
+	}
+
+	// the download path changed after the entry was archived
+	config.Instance().Paths.DownloadPath = filepath.Join(dir, "moved")
+	if _, err := r.HardDelete(ctx, (*left)[0].Id); err == nil {
+		t.Error("expected an error for a path outside of the download path")
+	}
+	if _, err := os.Stat((*left)[0].Path); err != nil {
+		t.Errorf("hard delete removed a file outside of the download path: %v", err)
+	}
+}
@@ -2,12 +2,14 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive/domain"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/openid"
 
 	middlewares "github.com/marcopiovanello/yt-dlp-web-ui/v4/server/middleware"
@@ -71,6 +73,10 @@ func (h *Handler) Archive() http.HandlerFunc {
 		}
 
 		err := h.service.Archive(r.Context(), &req)
+		if errors.Is(err, internal.ErrIsNotSubPath) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
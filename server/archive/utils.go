@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -56,3 +57,51 @@ func DownloadExists(ctx context.Context, url string) (bool, error) {
 
 	return false, nil
 }
+
+// Remove an entry of the archive.txt file, so that it's downloaded again
+func RemoveEntry(entry string) error {
+	path := filepath.Join(config.Instance().Dir(), "archive.txt")
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept []byte
+	for line := range bytes.Lines(data) {
+		if string(bytes.TrimRight(line, "\r\n")) != entry {
+			kept = append(kept, line...)
+		}
+	}
+
+	if len(kept) == len(data) {
+		return nil
+	}
+
+	return os.WriteFile(path, kept, 0644)
+}
+
+// Entries of the archive.txt file, each one formatted as "<extractor> <id>".
+// A missing archive.txt is an empty archive.
+func DownloadArchive() (map[string]bool, error) {
+	entries := make(map[string]bool)
+
+	fd, err := os.Open(filepath.Join(config.Instance().Dir(), "archive.txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		entries[scanner.Text()] = true
+	}
+
+	return entries, scanner.Err()
+}
@@ -1,24 +1,38 @@
 package archiver
 
 import (
+	"cmp"
 	"context"
-	"database/sql"
+	"encoding/json"
 	"log/slog"
+	"path/filepath"
+	"time"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 var (
-	ch             = make(chan *Message, 1)
+	ch             = make(chan *Message, 16)
 	archiveService archive.Service
 )
 
 type Message = archive.Entity
 
-func Register(db *sql.DB) {
+// Archive the completed downloads when auto_archive is enabled
+func Register(db *bolt.DB, mq *queue.MessageQueue) {
 	_, s := archive.Container(db)
 	archiveService = s
+
+	mq.OnCompleted(func(d downloaders.Downloader) {
+		if m := message(d); m != nil {
+			Publish(m)
+		}
+	})
 }
 
 func init() {
@@ -29,13 +43,47 @@ func init() {
 				slog.String("title", m.Title),
 				slog.String("source", m.Source),
 			)
-			archiveService.Archive(context.Background(), m)
+			if err := archiveService.Archive(context.Background(), m); err != nil {
+				slog.Error("failed to archive download", slog.String("title", m.Title), slog.Any("err", err))
+			}
 		}
 	}()
 }
 
+// Archive entry of a completed download, nil if nothing was saved
+func message(d downloaders.Downloader) *Message {
+	snap := d.Status()
+
+	path := snap.Output.SavedFilePath
+	if path == "" {
+		return nil
+	}
+
+	metadata, err := json.Marshal(snap.Info)
+	if err != nil {
+		slog.Warn("failed to encode the download metadata", slog.String("id", snap.Id), slog.Any("err", err))
+	}
+
+	return &Message{
+		Title:     cmp.Or(snap.Info.Title, filepath.Base(path)),
+		Path:      path,
+		Thumbnail: snap.Info.Thumbnail,
+		Source:    cmp.Or(snap.Info.OriginalURL, snap.Info.URL, d.GetUrl()),
+		Metadata:  string(metadata),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Queue m to be archived, dropped if the queue is full since it's called by
+// the download workers
 func Publish(m *Message) {
-	if config.Instance().AutoArchive {
-		ch <- m
+	if !config.Instance().AutoArchive || archiveService == nil {
+		return
+	}
+
+	select {
+	case ch <- m:
+	default:
+		slog.Warn("archive queue is full, dropping entry", slog.String("title", m.Title))
 	}
 }
@@ -0,0 +1,210 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Checks a channel by querying an HTTP endpoint returning JSON.
+// The rule is given by the channel options:
+//
+//	status_url  endpoint to query (required)
+//	live_path   JSONPath of the value telling if the channel is live (required)
+//	live_value  the channel is live if the value equals it, if it's truthy when empty
+//	title_path  JSONPath of the stream title (optional)
+//
+// Only the $.key, $['key'] and $[index] JSONPath selectors are supported.
+type HTTPJSONSource struct{}
+
+func (HTTPJSONSource) Name() string { return "http-json" }
+
+func (HTTPJSONSource) Validate(c Channel) error {
+	opts := c.Settings.Options
+
+	if err := validateHTTPURL(opts["status_url"]); err != nil {
+		return fmt.Errorf("status_url: %w", err)
+	}
+
+	if opts["live_path"] == "" {
+		return errors.New("live_path is required")
+	}
+
+	for _, key := range []string{"live_path", "title_path"} {
+		if opts[key] == "" {
+			continue
+		}
+		if _, err := parseJSONPath(opts[key]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (HTTPJSONSource) Check(ctx context.Context, c Channel) (Status, error) {
+	opts := c.Settings.Options
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts["status_url"], nil)
+	if err != nil {
+		return Status{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("status endpoint: %s", resp.Status)
+	}
+
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return Status{}, err
+	}
+
+	value, err := evalJSONPath(doc, opts["live_path"])
+	if err != nil {
+		return Status{}, err
+	}
+
+	var status Status
+
+	if expected := opts["live_value"]; expected != "" {
+		status.Live = jsonString(value) == expected
+	} else {
+		status.Live = truthy(value)
+	}
+
+	if opts["title_path"] != "" {
+		if title, err := evalJSONPath(doc, opts["title_path"]); err == nil {
+			status.Title = jsonString(title)
+		}
+	}
+
+	return status, nil
+}
+
+// Selector of a JSONPath, either a key or an index
+type pathSegment struct {
+	key   string
+	index int
+	isKey bool
+}
+
+func parseJSONPath(path string) ([]pathSegment, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, errors.New("a JSONPath starts with $")
+	}
+
+	var segments []pathSegment
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, errors.New("empty key in JSONPath")
+			}
+			segments = append(segments, pathSegment{key: rest[:end], isKey: true})
+			rest = rest[end:]
+
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end == -1 {
+				return nil, errors.New("unterminated key in JSONPath")
+			}
+			segments = append(segments, pathSegment{key: rest[2:end], isKey: true})
+			rest = rest[end+2:]
+
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, errors.New("unterminated index in JSONPath")
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid index %q in JSONPath", rest[1:end])
+			}
+			segments = append(segments, pathSegment{index: i})
+			rest = rest[end+1:]
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in JSONPath", rest)
+		}
+	}
+
+	return segments, nil
+}
+
+func evalJSONPath(doc any, path string) (any, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := doc
+
+	for _, s := range segments {
+		switch v := value.(type) {
+		case map[string]any:
+			if !s.isKey {
+				return nil, fmt.Errorf("%s: expected an array", path)
+			}
+			value = v[s.key]
+		case []any:
+			if s.isKey || s.index >= len(v) {
+				return nil, fmt.Errorf("%s: not found", path)
+			}
+			value = v[s.index]
+		default:
+			// a missing object, e.g. the stream of an offline channel
+			return nil, nil
+		}
+	}
+
+	return value, nil
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false" && v != "0"
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	default:
+		return false
+	}
+}
+
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
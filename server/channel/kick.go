@@ -0,0 +1,86 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const kickAPIURL = "https://kick.com/api/v2"
+
+// Checks kick.com channels through the public channel endpoint,
+// the channel url is https://kick.com/<slug>
+type KickSource struct {
+	BaseURL string
+}
+
+func NewKickSource() *KickSource {
+	return &KickSource{BaseURL: kickAPIURL}
+}
+
+type kickChannel struct {
+	Livestream *struct {
+		SessionTitle string `json:"session_title"`
+		IsLive       bool   `json:"is_live"`
+	} `json:"livestream"`
+}
+
+func (k *KickSource) Name() string { return "kick" }
+
+func (k *KickSource) Validate(c Channel) error {
+	_, err := kickSlug(c.URL)
+	return err
+}
+
+func (k *KickSource) Check(ctx context.Context, c Channel) (Status, error) {
+	slug, err := kickSlug(c.URL)
+	if err != nil {
+		return Status{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.BaseURL+"/channels/"+url.PathEscape(slug), nil)
+	if err != nil {
+		return Status{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("kick api: %s", resp.Status)
+	}
+
+	var kc kickChannel
+	if err := json.NewDecoder(resp.Body).Decode(&kc); err != nil {
+		return Status{}, err
+	}
+
+	// offline channels have no livestream
+	if kc.Livestream == nil || !kc.Livestream.IsLive {
+		return Status{}, nil
+	}
+
+	return Status{Live: true, Title: kc.Livestream.SessionTitle}, nil
+}
+
+func kickSlug(channelURL string) (string, error) {
+	u, err := url.Parse(channelURL)
+	if err != nil {
+		return "", err
+	}
+
+	slug := strings.Trim(u.Path, "/")
+	if strings.TrimPrefix(u.Hostname(), "www.") != "kick.com" || slug == "" || strings.Contains(slug, "/") {
+		return "", errors.New("a kick channel url is https://kick.com/<channel>")
+	}
+
+	return strings.ToLower(slug), nil
+}
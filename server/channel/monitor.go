@@ -0,0 +1,536 @@
+package channel
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("channel-monitor")
+
+// Checks the monitored channels through their LiveSource, a recording is
+// started each time one of them goes live.
+type Monitor struct {
+	channels  map[string]*Channel
+	sources   map[string]LiveSource
+	mu        sync.RWMutex
+	db        *bolt.DB
+	pipelines *pipeline.Store
+	// closed once the recording of a channel ends, a channel isn't recorded
+	// twice even if its state flips meanwhile
+	recordings map[string]<-chan struct{}
+	// channels being checked, a check can outlast the interval
+	checking map[string]bool
+	// channels notified by their Subscriber source, they aren't polled
+	subscribed map[string]bool
+	// set once monitoring, records the notified channels
+	handler func(c Channel) (<-chan struct{}, error)
+}
+
+func NewMonitor(db *bolt.DB, pipelines *pipeline.Store) *Monitor {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+
+	m := &Monitor{
+		channels:   make(map[string]*Channel),
+		sources:    make(map[string]LiveSource),
+		db:         db,
+		pipelines:  pipelines,
+		recordings: make(map[string]<-chan struct{}),
+		checking:   make(map[string]bool),
+		subscribed: make(map[string]bool),
+	}
+
+	m.Register(ytdlpSource{})
+	m.Register(NewKickSource())
+	m.Register(HTTPJSONSource{})
+
+	return m
+}
+
+// Make a source available to the channels, replaces the one with the same name
+func (m *Monitor) Register(s LiveSource) {
+	m.mu.Lock()
+	m.sources[s.Name()] = s
+	m.mu.Unlock()
+}
+
+// Names of the registered sources
+func (m *Monitor) Sources() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Sorted(maps.Keys(m.sources))
+}
+
+func (m *Monitor) source(settings Settings) (LiveSource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := cmp.Or(settings.Source, defaultSource)
+
+	s, ok := m.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %s", name)
+	}
+
+	return s, nil
+}
+
+func (m *Monitor) Add(channelURL string, settings Settings) error {
+	if err := validateHTTPURL(channelURL); err != nil {
+		return err
+	}
+
+	source, err := m.source(settings)
+	if err != nil {
+		return err
+	}
+
+	if err := source.Validate(Channel{URL: channelURL, Settings: settings}); err != nil {
+		return err
+	}
+
+	if settings.Path != "" {
+		if err := internal.ValidateSubPath(settings.Path); err != nil {
+			return err
+		}
+	}
+
+	if _, err := m.pipelines.Resolve(settings.PipelineId); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	err = m.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		return b.Put([]byte(channelURL), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	var previous Channel
+	c, ok := m.channels[channelURL]
+	if ok {
+		// an update, the state is kept
+		previous = *c
+		c.Settings = settings
+	} else {
+		m.channels[channelURL] = &Channel{
+			URL:      channelURL,
+			Settings: settings,
+			State:    StateUnknown,
+		}
+	}
+	monitoring := m.handler != nil
+	m.mu.Unlock()
+
+	if ok {
+		m.unsubscribe(previous)
+	}
+	if monitoring {
+		go m.subscribe(channelURL)
+	}
+
+	slog.Info("added channel to monitor", slog.String("url", channelURL))
+	return nil
+}
+
+// A monitored channel
+func (m *Monitor) Get(channelURL string) (Channel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.channels[channelURL]
+	if !ok {
+		return Channel{}, fmt.Errorf("channel %s is not monitored", channelURL)
+	}
+
+	return *c, nil
+}
+
+func (m *Monitor) Delete(channelURL string) error {
+	m.mu.Lock()
+	c, ok := m.channels[channelURL]
+	delete(m.channels, channelURL)
+	delete(m.recordings, channelURL)
+	m.mu.Unlock()
+
+	if ok {
+		m.unsubscribe(*c)
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		return b.Delete([]byte(channelURL))
+	})
+}
+
+func (m *Monitor) List() []Channel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	channels := make([]Channel, 0, len(m.channels))
+	for _, url := range slices.Sorted(maps.Keys(m.channels)) {
+		channels = append(channels, *m.channels[url])
+	}
+
+	return channels
+}
+
+func (m *Monitor) Monitor(
+	ctx context.Context,
+	interval time.Duration,
+	handler func(c Channel) (<-chan struct{}, error),
+) {
+	m.mu.Lock()
+	m.handler = handler
+	urls := slices.Collect(maps.Keys(m.channels))
+	m.mu.Unlock()
+
+	for _, url := range urls {
+		go m.subscribe(url)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.checkAll(ctx, handler)
+
+		case <-ctx.Done():
+			slog.Info("stopping channel monitor")
+			return
+		}
+	}
+}
+
+// Check the channels which aren't subscribed, the ones of a BatchSource
+// with a single call
+func (m *Monitor) checkAll(ctx context.Context, handler func(c Channel) (<-chan struct{}, error)) {
+	batches := make(map[BatchSource][]string)
+
+	for _, c := range m.List() {
+		m.mu.RLock()
+		subscribed := m.subscribed[c.URL]
+		m.mu.RUnlock()
+
+		if subscribed {
+			continue
+		}
+
+		source, err := m.source(c.Settings)
+		if b, ok := source.(BatchSource); ok && err == nil {
+			batches[b] = append(batches[b], c.URL)
+			continue
+		}
+
+		go m.check(ctx, c.URL, handler)
+	}
+
+	for source, urls := range batches {
+		go m.checkBatch(ctx, source, urls, handler)
+	}
+}
+
+// Start the notifications of a channel, if its source is a Subscriber
+func (m *Monitor) subscribe(url string) {
+	c, err := m.Get(url)
+	if err != nil {
+		return
+	}
+
+	source, err := m.source(c.Settings)
+	if err != nil {
+		return
+	}
+	sub, ok := source.(Subscriber)
+	if !ok {
+		return
+	}
+
+	notify := func(status Status) {
+		m.mu.RLock()
+		handler := m.handler
+		m.mu.RUnlock()
+
+		m.update(url, status, nil, handler)
+	}
+
+	cancelled := func() {
+		m.mu.Lock()
+		delete(m.subscribed, url)
+		m.mu.Unlock()
+
+		slog.Warn("channel notifications cancelled, polling it", slog.String("url", url))
+		go m.subscribe(url)
+	}
+
+	if err := sub.Subscribe(c, notify, cancelled); err != nil {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			slog.Error("subscription failed, polling channel", slog.String("url", url), slog.Any("err", err))
+		}
+		return
+	}
+
+	m.mu.Lock()
+	_, ok = m.channels[url]
+	if ok {
+		m.subscribed[url] = true
+	}
+	handler := m.handler
+	m.mu.Unlock()
+
+	// only the transitions are notified, the channel may be already live
+	if ok {
+		m.check(context.Background(), url, handler)
+	}
+}
+
+func (m *Monitor) unsubscribe(c Channel) {
+	m.mu.Lock()
+	subscribed := m.subscribed[c.URL]
+	delete(m.subscribed, c.URL)
+	m.mu.Unlock()
+
+	if !subscribed {
+		return
+	}
+
+	source, err := m.source(c.Settings)
+	if err != nil {
+		return
+	}
+	sub, ok := source.(Subscriber)
+	if !ok {
+		return
+	}
+	if err := sub.Unsubscribe(c); err != nil {
+		slog.Error("failed to unsubscribe channel", slog.String("url", c.URL), slog.Any("err", err))
+	}
+}
+
+// Whether the last recording of the channel is still going
+func (m *Monitor) recording(url string) bool {
+	done, ok := m.recordings[url]
+	if !ok || done == nil {
+		return false
+	}
+
+	select {
+	case <-done:
+		delete(m.recordings, url)
+		return false
+	default:
+		return true
+	}
+}
+
+// Mark the channel as being checked, returns false if it already is
+func (m *Monitor) begin(url string) (Channel, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.channels[url]
+	if !ok || m.checking[url] {
+		return Channel{}, false
+	}
+	m.checking[url] = true
+
+	return *c, true
+}
+
+func (m *Monitor) end(url string) {
+	m.mu.Lock()
+	delete(m.checking, url)
+	m.mu.Unlock()
+}
+
+func (m *Monitor) check(ctx context.Context, url string, handler func(c Channel) (<-chan struct{}, error)) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	current, ok := m.begin(url)
+	if !ok {
+		return
+	}
+	defer m.end(url)
+
+	var status Status
+
+	source, err := m.source(current.Settings)
+	if err == nil {
+		status, err = source.Check(ctx, current)
+	}
+
+	m.update(url, status, err, handler)
+}
+
+func (m *Monitor) checkBatch(
+	ctx context.Context,
+	source BatchSource,
+	urls []string,
+	handler func(c Channel) (<-chan struct{}, error),
+) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	var channels []Channel
+	for _, url := range urls {
+		if c, ok := m.begin(url); ok {
+			channels = append(channels, c)
+		}
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	defer func() {
+		for _, c := range channels {
+			m.end(c.URL)
+		}
+	}()
+
+	statuses, err := source.CheckAll(ctx, channels)
+
+	for _, c := range channels {
+		m.update(c.URL, statuses[c.URL], err, handler)
+	}
+}
+
+// Apply the result of a check, the channel is recorded if it went live
+func (m *Monitor) update(url string, status Status, err error, handler func(c Channel) (<-chan struct{}, error)) {
+	m.mu.Lock()
+	c, ok := m.channels[url]
+	if !ok {
+		// deleted meanwhile
+		m.mu.Unlock()
+		return
+	}
+
+	wasLive := c.State == StateLive
+	c.LastChecked = time.Now()
+	c.LastError = ""
+
+	switch {
+	case err != nil:
+		// e.g. yt-dlp fails on the /live pages of offline channels
+		c.State = StateOffline
+		c.LastError = firstLine(err.Error())
+	case status.Live:
+		c.State = StateLive
+		c.Title = status.Title
+		c.StreamURL = status.StreamURL
+	default:
+		c.State = StateOffline
+	}
+
+	// a failed check of a live channel looks like it went offline
+	goneLive := c.State == StateLive && !wasLive && !m.recording(url)
+	snapshot := *c
+	m.mu.Unlock()
+
+	if !goneLive {
+		return
+	}
+
+	slog.Info("channel went live", slog.String("url", url), slog.String("title", snapshot.Title))
+
+	var done <-chan struct{}
+
+	source, err := m.source(snapshot.Settings)
+	if r, ok := source.(Recorder); ok && err == nil {
+		done, err = r.Record(snapshot, status)
+	} else if handler != nil {
+		done, err = handler(snapshot)
+	}
+	if err != nil {
+		slog.Error("handler failed", slog.String("url", url), slog.Any("err", err))
+		return
+	}
+
+	m.mu.Lock()
+	if _, ok := m.channels[url]; ok {
+		m.recordings[url] = done
+	}
+	m.mu.Unlock()
+}
+
+func DEFAULT_DOWNLOAD_HANDLER(
+	db *kv.Store,
+	mq *queue.MessageQueue,
+	pipelines *pipeline.Store,
+) func(c Channel) (<-chan struct{}, error) {
+	return func(c Channel) (<-chan struct{}, error) {
+		p := pipelines.ResolveOrNone(c.Settings.PipelineId)
+
+		d := downloaders.NewLiveStreamDownloader(cmp.Or(c.StreamURL, c.URL), []pipes.Pipe{})
+		d.SetPipeline(p)
+		d.SetOutput(internal.DownloadOutput{Path: c.Settings.Path})
+
+		db.Set(d)
+		mq.Publish(d)
+
+		return d.(*downloaders.LiveStreamDownloader).Done(), nil
+	}
+}
+
+func (m *Monitor) Restore() error {
+	channels := make(map[string]*Channel)
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		return b.ForEach(func(k, v []byte) error {
+			var s Settings
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			channels[string(k)] = &Channel{
+				URL:      string(k),
+				Settings: s,
+				State:    StateUnknown,
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.channels = channels
+	m.mu.Unlock()
+
+	return nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,304 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Answers the checks with the queued results, blocking until one is queued
+type fakeSource struct {
+	results chan fakeResult
+
+	mu     sync.Mutex
+	checks int
+}
+
+type fakeResult struct {
+	live bool
+	err  error
+}
+
+func (*fakeSource) Name() string             { return "fake" }
+func (*fakeSource) Validate(c Channel) error { return nil }
+
+func (f *fakeSource) Check(ctx context.Context, c Channel) (Status, error) {
+	f.mu.Lock()
+	f.checks++
+	f.mu.Unlock()
+
+	r := <-f.results
+	return Status{Live: r.live}, r.err
+}
+
+func newTestMonitor(t *testing.T) (*Monitor, *fakeSource) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pipelines, err := pipeline.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &fakeSource{results: make(chan fakeResult, 1)}
+
+	m := NewMonitor(db, pipelines)
+	m.Register(source)
+
+	if err := m.Add("https://example.com/channel", Settings{Source: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return m, source
+}
+
+func TestMonitorRecordsOnce(t *testing.T) {
+	m, source := newTestMonitor(t)
+
+	var (
+		recordings int
+		done       chan struct{}
+	)
+	handler := func(c Channel) (<-chan struct{}, error) {
+		recordings++
+		done = make(chan struct{})
+		return done, nil
+	}
+
+	results := []struct {
+		result     fakeResult
+		recordings int
+	}{
+		{fakeResult{live: true}, 1},
+		// a failed check looks offline, the channel is still being recorded
+		{fakeResult{err: errors.New("timeout")}, 1},
+		{fakeResult{live: true}, 1},
+	}
+
+	for i, r := range results {
+		source.results <- r.result
+		m.check(context.Background(), "https://example.com/channel", handler)
+
+		if recordings != r.recordings {
+			t.Fatalf("check %d: %d recordings, want %d", i, recordings, r.recordings)
+		}
+	}
+
+	// the recording ended, the next stream is recorded
+	close(done)
+
+	source.results <- fakeResult{live: false}
+	m.check(context.Background(), "https://example.com/channel", handler)
+	source.results <- fakeResult{live: true}
+	m.check(context.Background(), "https://example.com/channel", handler)
+
+	if recordings != 2 {
+		t.Fatalf("%d recordings, want 2", recordings)
+	}
+}
+
+func TestMonitorSkipsOverlappingChecks(t *testing.T) {
+	m, source := newTestMonitor(t)
+
+	handler := func(c Channel) (<-chan struct{}, error) { return nil, nil }
+
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+		m.check(context.Background(), "https://example.com/channel", handler)
+	}()
+
+	// wait for the first check to be running
+	for {
+		source.mu.Lock()
+		checks := source.checks
+		source.mu.Unlock()
+		if checks == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// returns right away, the first one is still running
+	m.check(context.Background(), "https://example.com/channel", handler)
+
+	source.results <- fakeResult{}
+	<-checked
+
+	if source.checks != 1 {
+		t.Errorf("expected a single check, got %d", source.checks)
+	}
+}
+
+// Checks its channels with a single CheckAll, the live ones are given by url
+type fakeBatchSource struct {
+	live map[string]bool
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (*fakeBatchSource) Name() string             { return "batch" }
+func (*fakeBatchSource) Validate(c Channel) error { return nil }
+
+func (*fakeBatchSource) Check(ctx context.Context, c Channel) (Status, error) {
+	return Status{}, errors.New("checked alone")
+}
+
+func (f *fakeBatchSource) CheckAll(ctx context.Context, channels []Channel) (map[string]Status, error) {
+	var urls []string
+	statuses := make(map[string]Status)
+
+	for _, c := range channels {
+		urls = append(urls, c.URL)
+		if f.live[c.URL] {
+			statuses[c.URL] = Status{Live: true}
+		}
+	}
+
+	f.mu.Lock()
+	f.batches = append(f.batches, urls)
+	f.mu.Unlock()
+
+	return statuses, nil
+}
+
+func TestMonitorBatchChecks(t *testing.T) {
+	m, _ := newTestMonitor(t)
+
+	source := &fakeBatchSource{live: map[string]bool{"https://example.com/b": true}}
+	m.Register(source)
+
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		if err := m.Add(url, Settings{Source: "batch"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorded := make(chan string, 2)
+	handler := func(c Channel) (<-chan struct{}, error) {
+		recorded <- c.URL
+		return make(chan struct{}), nil
+	}
+
+	// leaves the channel of the fake source out
+	m.Delete("https://example.com/channel")
+	m.checkAll(context.Background(), handler)
+
+	if url := <-recorded; url != "https://example.com/b" {
+		t.Errorf("recorded %s", url)
+	}
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	if len(source.batches) != 1 || len(source.batches[0]) != 2 {
+		t.Errorf("unexpected batches %v", source.batches)
+	}
+	for _, c := range m.List() {
+		if c.LastError != "" {
+			t.Errorf("%s: %s", c.URL, c.LastError)
+		}
+	}
+}
+
+// Notifies the channels through the functions given to Subscribe
+type fakeSubscriber struct {
+	mu           sync.Mutex
+	checks       int
+	subscribes   int
+	unsubscribes int
+	notify       func(Status)
+	cancelled    func()
+}
+
+func (*fakeSubscriber) Name() string             { return "subscriber" }
+func (*fakeSubscriber) Validate(c Channel) error { return nil }
+
+func (f *fakeSubscriber) Check(ctx context.Context, c Channel) (Status, error) {
+	f.mu.Lock()
+	f.checks++
+	f.mu.Unlock()
+	return Status{}, nil
+}
+
+func (f *fakeSubscriber) Subscribe(c Channel, notify func(Status), cancelled func()) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscribes++
+	f.notify, f.cancelled = notify, cancelled
+	return nil
+}
+
+func (f *fakeSubscriber) Unsubscribe(c Channel) error {
+	f.mu.Lock()
+	f.unsubscribes++
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeSubscriber) counts() (checks, subscribes, unsubscribes int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checks, f.subscribes, f.unsubscribes
+}
+
+func TestMonitorSubscriber(t *testing.T) {
+	m, _ := newTestMonitor(t)
+	m.Delete("https://example.com/channel")
+
+	source := &fakeSubscriber{}
+	m.Register(source)
+
+	const url = "https://example.com/subscribed"
+	if err := m.Add(url, Settings{Source: "subscriber"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var recordings int
+	m.handler = func(c Channel) (<-chan struct{}, error) {
+		recordings++
+		return make(chan struct{}), nil
+	}
+
+	// checked once when subscribed, then only notified
+	m.subscribe(url)
+	m.checkAll(context.Background(), m.handler)
+	time.Sleep(50 * time.Millisecond)
+
+	if checks, subscribes, _ := source.counts(); checks != 1 || subscribes != 1 {
+		t.Fatalf("%d checks and %d subscriptions, want 1 and 1", checks, subscribes)
+	}
+
+	source.notify(Status{Live: true})
+	if recordings != 1 {
+		t.Fatalf("%d recordings, want 1", recordings)
+	}
+
+	// subscribed and checked again once cancelled
+	source.cancelled()
+	for {
+		if checks, subscribes, _ := source.counts(); checks == 2 && subscribes == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := m.Delete(url); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, unsubscribes := source.counts(); unsubscribes != 1 {
+		t.Errorf("%d unsubscriptions, want 1", unsubscribes)
+	}
+}
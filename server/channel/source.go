@@ -0,0 +1,87 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
+)
+
+// Default source of the channels that don't specify one
+const defaultSource = "ytdlp"
+
+// Tells whether a channel is live, one implementation for each platform.
+// The monitor takes care of the scheduling, the state tracking and the
+// persistence of the channels.
+//
+// A source can extend the monitor through the optional BatchSource,
+// Subscriber and Recorder interfaces.
+type LiveSource interface {
+	// unique, referenced by Settings.Source
+	Name() string
+	// Reject a channel the source can't check, called before it's added
+	Validate(c Channel) error
+	Check(ctx context.Context, c Channel) (Status, error)
+}
+
+// Implemented by the sources checking many channels with a single request
+type BatchSource interface {
+	// Status of each of the channels by url, the missing ones are offline
+	CheckAll(ctx context.Context, channels []Channel) (map[string]Status, error)
+}
+
+// Implemented by the sources notified when a channel goes live or offline,
+// e.g. through webhooks. The subscribed channels aren't polled.
+type Subscriber interface {
+	// Notify the state changes of c until it's unsubscribed. The source calls
+	// cancelled if it stops notifying them on its own (e.g. the subscription
+	// has been revoked), the channel is polled meanwhile.
+	// Returns errors.ErrUnsupported if the subscriptions are disabled.
+	Subscribe(c Channel, notify func(Status), cancelled func()) error
+	Unsubscribe(c Channel) error
+}
+
+// Implemented by the sources recording the channels themselves, e.g. with
+// platform specific options. The monitor handler is used otherwise.
+type Recorder interface {
+	// Start recording the stream, the returned channel is closed once done
+	Record(c Channel, s Status) (<-chan struct{}, error)
+}
+
+// Result of a LiveSource check
+type Status struct {
+	Live  bool
+	Title string
+	// url of the stream given to yt-dlp, the channel url if empty
+	StreamURL string
+	// of the stream, if the platform has one
+	ID string
+}
+
+// Checks the channels with yt-dlp, any site it supports can be monitored
+type ytdlpSource struct{}
+
+func (ytdlpSource) Name() string { return defaultSource }
+
+func (ytdlpSource) Validate(c Channel) error { return nil }
+
+func (ytdlpSource) Check(ctx context.Context, c Channel) (Status, error) {
+	info, err := livestream.FetchInfo(ctx, c.URL)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return Status{Live: info.IsLive(), Title: info.Title}, nil
+}
+
+func validateHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("the url must be an http(s) url")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package channel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPJSONSource(t *testing.T) {
+	var body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		options map[string]string
+		want    Status
+	}{
+		{
+			name:    "truthy",
+			body:    `{"data": {"stream": {"live": true, "title": "hello"}}}`,
+			options: map[string]string{"live_path": "$.data.stream.live", "title_path": "$.data.stream.title"},
+			want:    Status{Live: true, Title: "hello"},
+		},
+		{
+			name:    "missing object",
+			body:    `{"data": {"stream": null}}`,
+			options: map[string]string{"live_path": "$.data.stream.live"},
+			want:    Status{},
+		},
+		{
+			name:    "expected value",
+			body:    `{"streams": [{"state": "online"}]}`,
+			options: map[string]string{"live_path": "$.streams[0]['state']", "live_value": "online"},
+			want:    Status{Live: true},
+		},
+		{
+			name:    "unexpected value",
+			body:    `{"streams": [{"state": "offline"}]}`,
+			options: map[string]string{"live_path": "$.streams[0].state", "live_value": "online"},
+			want:    Status{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = tt.body
+			tt.options["status_url"] = srv.URL
+
+			c := Channel{
+				URL:      "https://example.com/channel",
+				Settings: Settings{Source: "http-json", Options: tt.options},
+			}
+
+			var s HTTPJSONSource
+
+			if err := s.Validate(c); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Check(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPJSONSourceValidate(t *testing.T) {
+	invalid := []map[string]string{
+		{"live_path": "$.live"},
+		{"status_url": "ftp://example.com", "live_path": "$.live"},
+		{"status_url": "https://example.com"},
+		{"status_url": "https://example.com", "live_path": "live"},
+		{"status_url": "https://example.com", "live_path": "$.streams[first]"},
+	}
+
+	for _, options := range invalid {
+		c := Channel{URL: "https://example.com/channel", Settings: Settings{Options: options}}
+		if err := (HTTPJSONSource{}).Validate(c); err == nil {
+			t.Errorf("%v: expected an error", options)
+		}
+	}
+}
+
+func TestKickSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/channels/streamer":
+			w.Write([]byte(`{"slug": "streamer", "livestream": {"is_live": true, "session_title": "hello"}}`))
+		case "/channels/sleeper":
+			w.Write([]byte(`{"slug": "sleeper", "livestream": null}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	k := NewKickSource()
+	k.BaseURL = srv.URL
+
+	live, err := k.Check(context.Background(), Channel{URL: "https://kick.com/Streamer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !live.Live || live.Title != "hello" {
+		t.Errorf("unexpected status %+v", live)
+	}
+
+	offline, err := k.Check(context.Background(), Channel{URL: "https://kick.com/sleeper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offline.Live {
+		t.Errorf("unexpected status %+v", offline)
+	}
+
+	if _, err := k.Check(context.Background(), Channel{URL: "https://kick.com/nobody"}); err == nil {
+		t.Error("expected an error for a missing channel")
+	}
+
+	if err := k.Validate(Channel{URL: "https://www.twitch.tv/streamer"}); err == nil {
+		t.Error("expected an error for a non kick url")
+	}
+}
@@ -0,0 +1,33 @@
+package channel
+
+import "time"
+
+const (
+	StateUnknown = "unknown"
+	StateOffline = "offline"
+	StateLive    = "live"
+)
+
+// Recording options of a monitored channel
+type Settings struct {
+	PipelineId string `json:"pipeline_id,omitempty"`
+	// directory of the recordings, must be under the download path
+	Path string `json:"path,omitempty"`
+	// name of the LiveSource checking the channel, yt-dlp if empty
+	Source string `json:"source,omitempty"`
+	// source specific, e.g. the rule of the http-json source
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// A channel checked for live streams, persisted in the channel-monitor bucket
+type Channel struct {
+	URL      string   `json:"url"`
+	Settings Settings `json:"settings"`
+
+	// not persisted, reset on restart
+	State       string    `json:"state"`
+	Title       string    `json:"title,omitempty"`
+	StreamURL   string    `json:"stream_url,omitempty"`
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
@@ -0,0 +1,235 @@
+package clip
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+)
+
+type Service struct {
+	store *Store
+	mdb   *kv.Store
+	mq    *queue.MessageQueue
+}
+
+func NewService(store *Store, mdb *kv.Store, mq *queue.MessageQueue) *Service {
+	s := &Service{
+		store: store,
+		mdb:   mdb,
+		mq:    mq,
+	}
+
+	// remote clips path is known only once yt-dlp has finished
+	mq.OnCompleted(s.link)
+
+	return s
+}
+
+func (s *Service) Store() *Store { return s.store }
+
+// Queue a job for each of the requested ranges, returns the ids of the jobs.
+func (s *Service) Submit(req Request) ([]string, error) {
+	if len(req.Ranges) == 0 {
+		return nil, errors.New("at least one time range is required")
+	}
+
+	if req.Mode == "" {
+		req.Mode = ModeKeyframe
+	}
+	if req.Mode != ModeKeyframe && req.Mode != ModeReencode {
+		return nil, fmt.Errorf("unknown clip mode %s", req.Mode)
+	}
+
+	if req.Path != "" {
+		if err := internal.ValidateSubPath(req.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	type span struct{ start, end float64 }
+
+	spans := make([]span, len(req.Ranges))
+	for i, r := range req.Ranges {
+		start, err := parseTimestamp(r.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimestamp(r.End)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("invalid range %s-%s", r.Start, r.End)
+		}
+		spans[i] = span{start, end}
+	}
+
+	remote := isRemote(req.Source)
+
+	if !remote {
+		if err := internal.ValidateSubPath(req.Source); err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(req.Source)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, errors.New("the clip source must be a file")
+		}
+	}
+
+	ids := make([]string, len(spans))
+
+	for i, sp := range spans {
+		var d downloaders.Downloader
+		if remote {
+			d = s.remoteClip(req, sp.start, sp.end)
+		} else {
+			d = s.localClip(req, sp.start, sp.end)
+		}
+
+		c := &Clip{
+			Id:        d.GetId(),
+			Source:    req.Source,
+			Start:     sp.start,
+			End:       sp.end,
+			Mode:      req.Mode,
+			CreatedAt: time.Now(),
+		}
+		if !remote {
+			c.Path = filepath.Join(d.Status().Output.Path, d.Status().Output.Filename)
+		}
+
+		if err := s.store.Save(c); err != nil {
+			return nil, err
+		}
+
+		s.mdb.Set(d)
+		s.mq.Publish(d)
+
+		ids[i] = d.GetId()
+	}
+
+	return ids, nil
+}
+
+func (s *Service) List() ([]Clip, error) {
+	return s.store.List()
+}
+
+// Remote clips are downloaded by yt-dlp only for the requested sections
+func (s *Service) remoteClip(req Request, start, end float64) downloaders.Downloader {
+	params := []string{
+		"--download-sections",
+		fmt.Sprintf("*%s-%s", formatSeconds(start), formatSeconds(end)),
+	}
+
+	if req.Mode == ModeReencode {
+		params = append(params, "--force-keyframes-at-cuts")
+	}
+
+	d := downloaders.NewGenericDownload(req.Source, params)
+	d.SetOutput(internal.DownloadOutput{
+		Path:     req.Path,
+		Filename: fmt.Sprintf("%%(title)s [clip %s].%%(ext)s", clipSuffix(start, end)),
+	})
+
+	return d
+}
+
+// Local clips are cut by ffmpeg, seeking on the input side
+func (s *Service) localClip(req Request, start, end float64) downloaders.Downloader {
+	var (
+		dir  = filepath.Dir(req.Source)
+		ext  = filepath.Ext(req.Source)
+		base = strings.TrimSuffix(filepath.Base(req.Source), ext)
+	)
+
+	if req.Path != "" {
+		dir = req.Path
+	}
+
+	output := filepath.Join(dir, fmt.Sprintf("%s [clip %s]%s", base, clipSuffix(start, end), ext))
+
+	inputArgs := []string{
+		"-ss", formatSeconds(start),
+		"-t", formatSeconds(end - start),
+	}
+
+	// without codec options ffmpeg re-encodes with the default
+	// encoders of the output container
+	var args []string
+	if req.Mode == ModeKeyframe {
+		args = []string{"-c", "copy", "-avoid_negative_ts", "make_zero"}
+	}
+
+	return downloaders.NewFFmpegDownload("clip", req.Source, output, end-start, inputArgs, args)
+}
+
+// Completion hook, records where a remote clip has been saved
+func (s *Service) link(d downloaders.Downloader) {
+	c, err := s.store.Get(d.GetId())
+	if err != nil || c == nil || c.Path != "" {
+		return
+	}
+
+	c.Path = d.Status().Output.SavedFilePath
+
+	if err := s.store.Save(c); err != nil {
+		slog.Error("failed to link clip to its source", slog.String("id", c.Id), slog.Any("err", err))
+	}
+}
+
+func isRemote(source string) bool {
+	u, err := url.Parse(source)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// Parse seconds (90, 90.5) or [HH:]MM:SS[.ms] timestamps
+func parseTimestamp(ts string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(ts), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %s", ts)
+	}
+
+	var seconds float64
+
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %s", ts)
+		}
+		// only the last component can have a fractional part
+		if i < len(parts)-1 && v != float64(int(v)) {
+			return 0, fmt.Errorf("invalid timestamp %s", ts)
+		}
+		seconds = seconds*60 + v
+	}
+
+	return seconds, nil
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
+
+// Filename friendly representation of a range, e.g. 00.01.30-00.02.00
+func clipSuffix(start, end float64) string {
+	format := func(s float64) string {
+		t := int(s)
+		return fmt.Sprintf("%02d.%02d.%02d", t/3600, t%3600/60, t%60)
+	}
+	return format(start) + "-" + format(end)
+}
@@ -0,0 +1,93 @@
+package clip
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("clips")
+
+// Clips are indexed by the id of the job producing them
+type Store struct {
+	db *bolt.DB
+}
+
+func NewStore(db *bolt.DB) (*Store, error) {
+	// init bucket
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Save(c *Clip) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		return b.Put([]byte(c.Id), data)
+	})
+}
+
+func (s *Store) Get(id string) (*Clip, error) {
+	var c *Clip
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		c = new(Clip)
+		return json.Unmarshal(v, c)
+	})
+
+	return c, err
+}
+
+func (s *Store) List() ([]Clip, error) {
+	clips := make([]Clip, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		return b.ForEach(func(k, v []byte) error {
+			var c Clip
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			clips = append(clips, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return clips, nil
+}
+
+// Map each produced clip path to its source
+func (s *Store) Sources() (map[string]string, error) {
+	clips, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string, len(clips))
+	for _, c := range clips {
+		if c.Path != "" {
+			sources[c.Path] = c.Source
+		}
+	}
+
+	return sources, nil
+}
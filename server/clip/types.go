@@ -0,0 +1,37 @@
+package clip
+
+import "time"
+
+const (
+	// Stream copy, cuts are snapped to the nearest keyframe
+	ModeKeyframe = "keyframe"
+	// Frame accurate cuts, the clip is re-encoded
+	ModeReencode = "reencode"
+)
+
+// A time range, both ends accept seconds (90, 90.5) or [HH:]MM:SS[.ms]
+type Range struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// struct representing the intent to extract one or more clips.
+// Source is either the path of a downloaded file or a remote url.
+type Request struct {
+	Source string  `json:"source"`
+	Ranges []Range `json:"ranges"`
+	Mode   string  `json:"mode"`
+	Path   string  `json:"path"`
+}
+
+// Links a produced clip to its source.
+// Path is empty until the job producing the clip has completed.
+type Clip struct {
+	Id        string    `json:"id"`
+	Source    string    `json:"source"`
+	Path      string    `json:"path"`
+	Start     float64   `json:"start"`
+	End       float64   `json:"end"`
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -12,6 +12,7 @@ type DownloadMetadata struct {
 	VCodec      string    `json:"vcodec"`
 	ACodec      string    `json:"acodec"`
 	Extension   string    `json:"ext"`
+	Duration    float64   `json:"duration"`
 	OriginalURL string    `json:"original_url"`
 	FileName    string    `json:"filename"`
 	CreatedAt   time.Time `json:"created_at"`
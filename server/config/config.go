@@ -7,14 +7,19 @@ import (
 )
 
 type Config struct {
-	Server         ServerConfig   `mapstructure:"server"`
-	Logging        LoggingConfig  `mapstructure:"logging"`
-	Paths          PathsConfig    `mapstructure:"paths"`
-	Authentication AuthConfig     `mapstructure:"authentication"`
-	OpenId         OpenIdConfig   `mapstructure:"openid"`
-	Frontend       FrontendConfig `mapstructure:"frontend"`
-	AutoArchive    bool           `mapstructure:"auto_archive"`
-	Twitch         TwitchConfig   `mapstructure:"twitch"`
+	Server         ServerConfig        `mapstructure:"server"`
+	Logging        LoggingConfig       `mapstructure:"logging"`
+	Paths          PathsConfig         `mapstructure:"paths"`
+	Authentication AuthConfig          `mapstructure:"authentication"`
+	OpenId         OpenIdConfig        `mapstructure:"openid"`
+	Frontend       FrontendConfig      `mapstructure:"frontend"`
+	AutoArchive    bool                `mapstructure:"auto_archive"`
+	Twitch         TwitchConfig        `mapstructure:"twitch"`
+	Verification   VerifyConfig        `mapstructure:"verification"`
+	PostProcessing PostProcessConfig   `mapstructure:"postprocessing"`
+	HLS            HLSConfig           `mapstructure:"hls"`
+	Channels       ChannelsConfig      `mapstructure:"channels"`
+	Subscriptions  SubscriptionsConfig `mapstructure:"subscriptions"`
 	path           string
 }
 
@@ -35,6 +40,8 @@ type PathsConfig struct {
 	DownloaderPath    string `mapstructure:"downloader_path"`
 	LocalDatabasePath string `mapstructure:"local_database_path"`
 	JSRuntimePath     string `mapstructure:"js_runtime_path"`
+	FFprobePath       string `mapstructure:"ffprobe_path"`
+	FFmpegPath        string `mapstructure:"ffmpeg_path"`
 }
 
 type AuthConfig struct {
@@ -57,11 +64,57 @@ type FrontendConfig struct {
 }
 
 type TwitchConfig struct {
-	ClientId      string        `mapstructure:"client_id"`
-	ClientSecret  string        `mapstructure:"client_secret"`
+	ClientId     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// public url of the /twitch/eventsub route, the users are polled if empty
+	CallbackURL string `mapstructure:"callback_url"`
+	// signs the eventsub notifications, 10 to 100 characters
+	WebhookSecret string `mapstructure:"webhook_secret"`
+	// Helix and OAuth endpoints, the official ones if empty
+	APIURL  string `mapstructure:"api_url"`
+	AuthURL string `mapstructure:"auth_url"`
+	// IRC over WebSocket endpoint of the chat, the official one if empty
+	ChatURL string `mapstructure:"chat_url"`
+	// period of the vods and clips backfill of the users that enabled it
+	SyncInterval time.Duration `mapstructure:"sync_interval"`
+}
+
+// Generic "go live" monitor
+type ChannelsConfig struct {
 	CheckInterval time.Duration `mapstructure:"check_interval"`
 }
 
+type SubscriptionsConfig struct {
+	// new entries queued by a run at most, unless the subscription sets its own
+	MaxEntries int `mapstructure:"max_entries"`
+	// consecutive failed runs disabling a subscription, 0 to never disable it
+	MaxFailures int `mapstructure:"max_failures"`
+	// period of the janitor enforcing the retention of the subscriptions
+	RetentionInterval time.Duration `mapstructure:"retention_interval"`
+}
+
+// Post-completion integrity check of the downloaded files
+type VerifyConfig struct {
+	Enabled           bool    `mapstructure:"enabled"`
+	DurationTolerance float64 `mapstructure:"duration_tolerance"` // seconds
+	MaxRetries        int     `mapstructure:"max_retries"`
+}
+
+// File based ffmpeg jobs run on the finished downloads
+type PostProcessConfig struct {
+	QueueSize int `mapstructure:"queue_size"`
+	// preset applied to each completed download, empty to disable
+	AutoPreset string `mapstructure:"auto_preset"`
+}
+
+// Preview of the livestreams being recorded
+type HLSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// seconds of the recording that can be played back
+	Window          int `mapstructure:"window"`
+	SegmentDuration int `mapstructure:"segment_duration"`
+}
+
 var (
 	instance     *Config
 	instanceOnce sync.Once
@@ -71,7 +124,9 @@ func Instance() *Config {
 	if instance == nil {
 		instanceOnce.Do(func() {
 			instance = &Config{}
-			instance.Twitch.CheckInterval = time.Minute * 5
+			instance.Twitch.SyncInterval = time.Hour * 6
+			instance.Channels.CheckInterval = time.Minute * 5
+			instance.Subscriptions.RetentionInterval = time.Hour
 		})
 	}
 	return instance
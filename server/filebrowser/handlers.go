@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
@@ -14,9 +15,11 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/clip"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
@@ -29,8 +32,64 @@ import (
 
 var (
 	videoRe = regexp.MustCompile(`(?i)/\.mov|\.mp4|\.webm|\.mvk|/gmi`)
+
+	servedHooks   []func(path string)
+	servedHooksMu sync.RWMutex
 )
 
+// Register a function called each time a file is played or downloaded
+// through the file browser, up to its end.
+func OnServed(hook func(path string)) {
+	servedHooksMu.Lock()
+	servedHooks = append(servedHooks, hook)
+	servedHooksMu.Unlock()
+}
+
+func served(path string) {
+	servedHooksMu.RLock()
+	defer servedHooksMu.RUnlock()
+
+	for _, hook := range servedHooks {
+		hook(path)
+	}
+}
+
+// Counts what's written of a served file
+type servedWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (s *servedWriter) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *servedWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.written += int64(n)
+	return n, err
+}
+
+// Whether the whole file of the given size, or a range up to its end, has
+// been written. A player reads the file with a request for each range.
+func (s *servedWriter) reachedEnd(size int64) bool {
+	switch s.status {
+	case http.StatusOK:
+		return s.written == size
+	case http.StatusPartialContent:
+		var start, end, total int64
+		_, err := fmt.Sscanf(s.Header().Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		return err == nil && end == total-1 && s.written == end-start+1
+	default:
+		return false
+	}
+}
+
 func isVideo(d fs.DirEntry) bool {
 	return videoRe.MatchString(d.Name())
 }
@@ -48,6 +107,7 @@ type DirectoryEntry struct {
 	ModTime     time.Time `json:"modTime"`
 	IsVideo     bool      `json:"isVideo"`
 	IsDirectory bool      `json:"isDirectory"`
+	ClipOf      string    `json:"clipOf,omitempty"`
 }
 
 func walkDir(root string) (*[]DirectoryEntry, error) {
@@ -88,31 +148,44 @@ type ListRequest struct {
 	OrderBy string `json:"orderBy"`
 }
 
-func ListDownloaded(w http.ResponseWriter, r *http.Request) {
-	root := config.Instance().Paths.DownloadPath
-	req := new(ListRequest)
+func ListDownloaded(clips *clip.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := config.Instance().Paths.DownloadPath
+		req := new(ListRequest)
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	files, err := walkDir(filepath.Join(root, req.SubDir))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		files, err := walkDir(filepath.Join(root, req.SubDir))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if req.OrderBy == "modtime" {
-		sort.SliceStable(*files, func(i, j int) bool {
-			return (*files)[i].ModTime.After((*files)[j].ModTime)
-		})
-	}
+		// link the clips back to the file they've been extracted from
+		sources, err := clips.Sources()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	w.WriteHeader(http.StatusOK)
+		for i, f := range *files {
+			(*files)[i].ClipOf = sources[f.Path]
+		}
+
+		if req.OrderBy == "modtime" {
+			sort.SliceStable(*files, func(i, j int) bool {
+				return (*files)[i].ModTime.After((*files)[j].ModTime)
+			})
+		}
+
+		w.WriteHeader(http.StatusOK)
 
-	if err := json.NewEncoder(w).Encode(files); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(files); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 	}
 }
 
@@ -160,7 +233,12 @@ func SendFile(w http.ResponseWriter, r *http.Request) {
 	root := config.Instance().Paths.DownloadPath
 
 	if strings.Contains(filepath.Dir(filepath.Clean(filename)), filepath.Clean(root)) {
-		http.ServeFile(w, r, filename)
+		sw := &servedWriter{ResponseWriter: w}
+		http.ServeFile(sw, r, filename)
+
+		if info, err := os.Stat(filename); err == nil && sw.reachedEnd(info.Size()) {
+			served(filename)
+		}
 		return
 	}
 
@@ -200,8 +278,14 @@ func DownloadFile(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		defer fd.Close()
+
+		sw := &servedWriter{ResponseWriter: w}
+		io.Copy(sw, fd)
 
-		io.Copy(w, fd)
+		if info, err := fd.Stat(); err == nil && sw.reachedEnd(info.Size()) {
+			served(filename)
+		}
 		return
 	}
 
@@ -0,0 +1,83 @@
+package filebrowser
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+func TestServedUpToTheEnd(t *testing.T) {
+	root := t.TempDir()
+
+	prev := config.Instance().Paths.DownloadPath
+	config.Instance().Paths.DownloadPath = root
+	t.Cleanup(func() { config.Instance().Paths.DownloadPath = prev })
+
+	video := filepath.Join(root, "videos", "video.mp4")
+	if err := os.MkdirAll(filepath.Dir(video), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(video, []byte(strings.Repeat("x", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		watched int
+	)
+	OnServed(func(path string) {
+		mu.Lock()
+		watched++
+		mu.Unlock()
+	})
+
+	r := chi.NewRouter()
+	r.Get("/play/{id}", SendFile)
+	r.Get("/download/{id}", DownloadFile)
+
+	id := url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(video)))
+
+	tests := []struct {
+		route   string
+		ranges  string
+		watched bool
+	}{
+		{"/play/", "", true},
+		{"/play/", "bytes=0-99", false},
+		{"/play/", "bytes=500-", true},
+		{"/play/", "bytes=900-999", true},
+		{"/download/", "", true},
+	}
+
+	for _, tt := range tests {
+		mu.Lock()
+		watched = 0
+		mu.Unlock()
+
+		req := httptest.NewRequest(http.MethodGet, tt.route+id, nil)
+		if tt.ranges != "" {
+			req.Header.Set("Range", tt.ranges)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK && rec.Code != http.StatusPartialContent {
+			t.Fatalf("%s %s: status %d", tt.route, tt.ranges, rec.Code)
+		}
+
+		mu.Lock()
+		if (watched == 1) != tt.watched {
+			t.Errorf("%s %s: watched %d times", tt.route, tt.ranges, watched)
+		}
+		mu.Unlock()
+	}
+}
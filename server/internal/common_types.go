@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"time"
+
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
 )
 
@@ -14,6 +16,12 @@ type ProgressTemplate struct {
 
 type PostprocessTemplate struct {
 	FilePath string `json:"filepath"`
+	// of the format actually downloaded
+	VCodec string `json:"vcodec"`
+	ACodec string `json:"acodec"`
+	// make up the download archive entry
+	ExtractorKey string `json:"extractor_key"`
+	ID           string `json:"id"`
 }
 
 // Defines where and how the download needs to be saved
@@ -21,6 +29,9 @@ type DownloadOutput struct {
 	Path          string
 	Filename      string
 	SavedFilePath string `json:"savedFilePath"`
+	// Record the download in the yt-dlp download archive, an archived one
+	// isn't downloaded again
+	Archive bool `json:"archive,omitempty"`
 }
 
 // Progress for the Running call
@@ -40,6 +51,62 @@ type ProcessSnapshot struct {
 	Output         DownloadOutput          `json:"output"`
 	Params         []string                `json:"params"`
 	DownloaderName string                  `json:"downloader_name"`
+	Verification   *MediaVerification      `json:"verification,omitempty"`
+	Pipeline       []PipeStatus            `json:"pipeline,omitempty"`
+	// Id of the pipeline applied to the download, resolved again on restore
+	PipelineId string `json:"pipeline_id,omitempty"`
+	// Leading Params placed before the input, only for the ffmpeg jobs
+	InputParams []string `json:"input_params,omitempty"`
+}
+
+// State of a single step of the pipeline attached to a download
+type PipeStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Only for fan-out steps
+	Branches []BranchStatus `json:"branches,omitempty"`
+	// Only for steps pushing the stream to a remote endpoint
+	Health *PipeHealth `json:"health,omitempty"`
+}
+
+// Connection state of a step pushing the stream to a remote endpoint
+type PipeHealth struct {
+	State      string    `json:"state"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"last_error,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+// State of a branch of a fan-out step
+type BranchStatus struct {
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Steps  []PipeStatus `json:"steps"`
+}
+
+// A single stream of a probed media file
+type MediaStream struct {
+	Index      int    `json:"index"`
+	Type       string `json:"type"`
+	Codec      string `json:"codec"`
+	Profile    string `json:"profile,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	SampleRate string `json:"sample_rate,omitempty"`
+}
+
+// Outcome of the post-completion integrity check of a download
+type MediaVerification struct {
+	Valid            bool          `json:"valid"`
+	Duration         float64       `json:"duration"`
+	ExpectedDuration float64       `json:"expected_duration"`
+	Streams          []MediaStream `json:"streams"`
+	Error            string        `json:"error,omitempty"`
+	Attempts         int           `json:"attempts"`
+	CheckedAt        time.Time     `json:"checked_at"`
 }
 
 // struct representing the current status of the memoryDB
@@ -55,11 +122,12 @@ type AbortRequest struct {
 
 // struct representing the intent to start a download
 type DownloadRequest struct {
-	Id     string
-	URL    string   `json:"url"`
-	Path   string   `json:"path"`
-	Rename string   `json:"rename"`
-	Params []string `json:"params"`
+	Id         string
+	URL        string   `json:"url"`
+	Path       string   `json:"path"`
+	Rename     string   `json:"rename"`
+	Params     []string `json:"params"`
+	PipelineId string   `json:"pipeline_id"`
 }
 
 // struct representing request of creating a netscape cookies file
@@ -80,4 +148,5 @@ const (
 	StatusCompleted
 	StatusErrored
 	StatusLiveStream
+	StatusCorrupt
 )
@@ -3,6 +3,7 @@ package downloaders
 import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 )
 
 type Downloader interface {
@@ -14,6 +15,7 @@ type Downloader interface {
 	SetProgress(progress internal.DownloadProgress)
 	SetMetadata(fetcher func(url string) (*common.DownloadMetadata, error))
 	SetPending(p bool)
+	SetPipeline(p *pipeline.Pipeline)
 
 	IsCompleted() bool
 
@@ -1,5 +0,0 @@
-package downloaders
-
-var (
-	ErrIsNotSubPath = "the provided output path is not valid. It should be under the configured download path."
-)
@@ -0,0 +1,224 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+)
+
+// Runs ffmpeg over an already downloaded file.
+// Unlike the other downloaders the source is a local path and the metadata
+// is provided by the caller instead of being fetched with yt-dlp.
+type FFmpegDownloader struct {
+	// Reported as DownloaderName, e.g. "clip"
+	Kind string
+	// Options placed before -i (seeking etc.)
+	InputArgs []string
+	// Options placed between the input and the output file
+	Args []string
+
+	progress internal.DownloadProgress
+	output   internal.DownloadOutput
+
+	proc *os.Process
+
+	logConsumer LogConsumer
+
+	// embedded
+	DownloaderBase
+}
+
+// The duration (in seconds) of the produced file is used to compute the progress.
+func NewFFmpegDownload(kind, input, output string, duration float64, inputArgs, args []string) Downloader {
+	f := &FFmpegDownloader{
+		Kind:        kind,
+		InputArgs:   inputArgs,
+		Args:        args,
+		logConsumer: NewFFmpegProgressConsumer(),
+		output: internal.DownloadOutput{
+			Path:     filepath.Dir(output),
+			Filename: filepath.Base(output),
+		},
+	}
+	// in base
+	f.Id = uuid.NewString()
+	f.URL = input
+	f.Metadata = common.DownloadMetadata{
+		URL:       input,
+		Title:     filepath.Base(output),
+		Extension: filepath.Ext(output),
+		Duration:  duration,
+	}
+	return f
+}
+
+func (f *FFmpegDownloader) Start() error {
+	f.SetPending(true)
+
+	outputPath := filepath.Join(f.output.Path, f.output.Filename)
+
+	if err := internal.ValidateSubPath(outputPath); err != nil {
+		return err
+	}
+
+	params := []string{"-hide_banner", "-nostats", "-n"}
+	params = append(params, f.InputArgs...)
+	params = append(params, "-i", f.URL)
+	params = append(params, f.Args...)
+	params = append(params, "-progress", "pipe:1", outputPath)
+
+	slog.Info("requesting ffmpeg job",
+		slog.String("kind", f.Kind),
+		slog.String("input", f.URL),
+		slog.Any("params", params),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cmd := exec.CommandContext(ctx, config.Instance().Paths.FFmpegPath, params...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+
+	f.proc = cmd.Process
+
+	logs := make(chan []byte, 2)
+	go produceLogs(stdout, logs)
+	go consumeLogs(ctx, logs, f.logConsumer, f)
+	go printYtDlpErrors(stderr, f.Id, f.URL)
+
+	f.SetPending(false)
+
+	err = cmd.Wait()
+
+	// detach the log consumer before setting the final state
+	cancel()
+	f.Complete()
+
+	if err != nil {
+		f.progress.Status = internal.StatusErrored
+		return err
+	}
+
+	f.output.SavedFilePath = outputPath
+	f.progress = internal.DownloadProgress{
+		Status:     internal.StatusCompleted,
+		Percentage: "100.0%",
+	}
+
+	return nil
+}
+
+func (f *FFmpegDownloader) Stop() error {
+	defer func() {
+		f.progress.Status = internal.StatusCompleted
+		f.Complete()
+	}()
+
+	if f.proc == nil {
+		return errors.New("*os.Process not set")
+	}
+
+	pgid, err := syscall.Getpgid(f.proc.Pid)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Kill(-pgid, syscall.SIGTERM)
+}
+
+func (f *FFmpegDownloader) Status() internal.ProcessSnapshot {
+	return internal.ProcessSnapshot{
+		Id:             f.Id,
+		Info:           f.Metadata,
+		Progress:       f.progress,
+		Output:         f.output,
+		Params:         append(append([]string{}, f.InputArgs...), f.Args...),
+		InputParams:    f.InputArgs,
+		DownloaderName: f.Kind,
+	}
+}
+
+func (f *FFmpegDownloader) UpdateSavedFilePath(p string) { f.output.SavedFilePath = p }
+
+func (f *FFmpegDownloader) SetOutput(o internal.DownloadOutput)     { f.output = o }
+func (f *FFmpegDownloader) SetProgress(p internal.DownloadProgress) { f.progress = p }
+
+// Metadata is provided at construction time, nothing to fetch.
+func (f *FFmpegDownloader) SetMetadata(fetcher func(url string) (*common.DownloadMetadata, error)) {}
+
+func (f *FFmpegDownloader) SetPending(p bool) {
+	f.Pending = p
+}
+
+// ffmpeg jobs already work on local files, pipelines are not supported.
+func (f *FFmpegDownloader) SetPipeline(p *pipeline.Pipeline) {}
+
+func (f *FFmpegDownloader) GetId() string  { return f.Id }
+func (f *FFmpegDownloader) GetUrl() string { return f.URL }
+
+func (f *FFmpegDownloader) RestoreFromSnapshot(snap *internal.ProcessSnapshot) error {
+	if snap == nil {
+		return errors.New("cannot restore nil snapshot")
+	}
+
+	s := *snap
+
+	f.Id = s.Id
+	f.URL = s.Info.URL
+	f.Metadata = s.Info
+	f.progress = s.Progress
+	f.output = s.Output
+	f.Kind = s.DownloaderName
+
+	if len(s.InputParams) > len(s.Params) {
+		return errors.New("input params exceed the params of the snapshot")
+	}
+	f.InputArgs = s.InputParams
+	f.Args = s.Params[len(s.InputParams):]
+
+	switch s.Progress.Status {
+	case internal.StatusCompleted, internal.StatusErrored:
+		f.Complete()
+	case internal.StatusDownloading:
+		// the output of an interrupted job is partial, ffmpeg doesn't
+		// overwrite it when started again
+		output := filepath.Join(f.output.Path, f.output.Filename)
+		if err := internal.ValidateSubPath(output); err != nil {
+			return err
+		}
+		if err := os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		f.progress = internal.DownloadProgress{Status: internal.StatusPending}
+	}
+
+	return nil
+}
+
+func (f *FFmpegDownloader) IsCompleted() bool { return f.Completed }
@@ -3,6 +3,7 @@ package downloaders
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -12,9 +13,12 @@ import (
 	"syscall"
 
 	"github.com/google/uuid"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
 )
 
 const downloadTemplate = `download:
@@ -27,7 +31,11 @@ const downloadTemplate = `download:
 // filename not returning the correct extension after postprocess
 const postprocessTemplate = `postprocess:
 {
-	"filepath":"%(info.filepath)s"
+	"filepath":"%(info.filepath)s",
+	"vcodec":"%(info.vcodec)s",
+	"acodec":"%(info.acodec)s",
+	"extractor_key":"%(info.extractor_key)s",
+	"id":"%(info.id)s"
 }
 `
 
@@ -36,8 +44,19 @@ type GenericDownloader struct {
 
 	AutoRemove bool
 
-	progress internal.DownloadProgress
-	output   internal.DownloadOutput
+	progress     internal.DownloadProgress
+	output       internal.DownloadOutput
+	verification *internal.MediaVerification
+	// codecs of the downloaded format, reported with the output file
+	vcodec, acodec string
+	// line recorded in the download archive, if the output is archived
+	archiveEntry string
+	// yt-dlp stopped on an archived download, there's no output to verify
+	alreadyArchived bool
+
+	// applied on the downloaded file
+	pipeline *pipeline.Pipeline
+	chain    *pipes.Chain
 
 	proc *os.Process
 
@@ -102,23 +121,30 @@ func (g *GenericDownloader) Start() error {
 		"ejs:github",
 	}
 
+	params := append(baseParams, g.Params...)
+
+	// added after the sanitizer, the archive path isn't chosen by the user
+	if g.output.Archive {
+		params = append(params,
+			"--break-on-existing",
+			"--download-archive",
+			filepath.Join(config.Instance().Dir(), "archive.txt"),
+		)
+	}
+
 	// if user asked to manually override the output path...
+	// the output path is not appended to g.Params, otherwise a restarted
+	// download would be rejected by the sanitizer.
 	if !(slices.Contains(g.Params, "-P") || slices.Contains(g.Params, "--paths")) {
 		outputPath := filepath.Join(out.Path, out.Filename)
 
-		rel, err := filepath.Rel(config.Instance().Paths.DownloadPath, outputPath)
-		if err != nil {
+		if err := internal.ValidateSubPath(outputPath); err != nil {
 			return err
 		}
-		if strings.HasPrefix(rel, "..") {
-			return errors.New(ErrIsNotSubPath)
-		}
 
-		g.Params = append(g.Params, "-o")
-		g.Params = append(g.Params, outputPath)
+		params = append(params, "-o", outputPath)
 	}
 
-	params := append(baseParams, g.Params...)
 	params = append(params, "--no-exec")
 
 	slog.Info("requesting download", slog.String("url", g.URL), slog.Any("params", params))
@@ -147,10 +173,12 @@ func (g *GenericDownloader) Start() error {
 
 	g.proc = cmd.Process
 
+	status := internal.StatusCompleted
+
 	stop := func() {
 		stdout.Close()
 		g.Complete()
-		g.progress.Status = internal.StatusCompleted
+		g.progress.Status = status
 		cancel()
 	}
 	defer stop()
@@ -159,7 +187,11 @@ func (g *GenericDownloader) Start() error {
 	go produceLogs(stdout, logs)
 	go consumeLogs(ctx, logs, g.logConsumer, g)
 
+	// read to the end before reaping the process, Wait closes the pipe
+	// and the read error would mark the download as stopped
+	logged := make(chan struct{})
 	go func() {
+		defer close(logged)
 		err := printYtDlpErrors(stderr, g.Id, g.URL)
 		if err != nil {
 			stop()
@@ -167,7 +199,108 @@ func (g *GenericDownloader) Start() error {
 	}()
 
 	g.SetPending(false)
-	return cmd.Wait()
+
+	<-logged
+
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		// --break-on-existing, the download is in the archive already
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 101 {
+			g.alreadyArchived = true
+			return nil
+		}
+		// a download stopped by the user is completed
+		if !g.IsCompleted() {
+			status = internal.StatusErrored
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Completion hook feeding the verified downloads to their pipeline, if any.
+// The pipeline is run in its own goroutine, the download worker is released.
+func RunPipeline(d Downloader) {
+	if g, ok := d.(*GenericDownloader); ok {
+		go g.runPipeline()
+	}
+}
+
+// Chain of the attached pipeline, its files are named after the downloaded one
+func (g *GenericDownloader) buildPipeline() (*pipes.Chain, error) {
+	var (
+		saved = g.output.SavedFilePath
+		ext   = filepath.Ext(saved)
+		base  = strings.TrimSuffix(saved, ext) + " [" + strings.ReplaceAll(g.pipeline.Name, "/", "_") + "]"
+	)
+	return pipeline.Build(g.pipeline, base, ext)
+}
+
+// Feed the downloaded file to the attached pipeline.
+// A failing pipeline doesn't invalidate the download, errors are
+// reported in the snapshot.
+func (g *GenericDownloader) runPipeline() {
+	g.mutex.Lock()
+	if g.pipeline == nil || g.output.SavedFilePath == "" {
+		g.mutex.Unlock()
+		return
+	}
+
+	saved := g.output.SavedFilePath
+
+	chain, err := g.buildPipeline()
+	if err != nil {
+		g.mutex.Unlock()
+		slog.Error("failed to build pipeline", slog.String("id", g.Id), slog.Any("err", err))
+		return
+	}
+	g.chain = chain
+	g.mutex.Unlock()
+
+	fd, err := os.Open(saved)
+	if err != nil {
+		slog.Error("failed to open downloaded file", slog.String("id", g.Id), slog.Any("err", err))
+		return
+	}
+	defer fd.Close()
+
+	slog.Info("running pipeline", slog.String("id", g.Id), slog.String("pipeline", g.pipeline.Name))
+
+	tail, err := chain.Connect(fd)
+	if err != nil {
+		slog.Error("pipeline failed", slog.String("id", g.Id), slog.Any("err", err))
+		return
+	}
+
+	io.Copy(io.Discard, tail)
+
+	if err := chain.Wait(); err != nil {
+		slog.Error("pipeline failed", slog.String("id", g.Id), slog.Any("err", err))
+	}
+}
+
+// Remove the files written by the pipeline from the downloaded file
+func (g *GenericDownloader) removePipelineOutputs() error {
+	if g.pipeline == nil || g.output.SavedFilePath == "" {
+		return nil
+	}
+
+	chain := g.chain
+	if chain == nil {
+		var err error
+		// a pipeline that can't be built hasn't written anything
+		if chain, err = g.buildPipeline(); err != nil {
+			return nil
+		}
+	}
+
+	for _, path := range chain.Outputs() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
 }
 
 func (g *GenericDownloader) Stop() error {
@@ -195,18 +328,39 @@ func (g *GenericDownloader) Stop() error {
 }
 
 func (g *GenericDownloader) Status() internal.ProcessSnapshot {
-	return internal.ProcessSnapshot{
+	snap := internal.ProcessSnapshot{
 		Id:             g.Id,
 		Info:           g.Metadata,
 		Progress:       g.progress,
 		Output:         g.output,
 		Params:         g.Params,
 		DownloaderName: "generic",
+		Verification:   g.verification,
+	}
+
+	if g.pipeline != nil {
+		snap.PipelineId = g.pipeline.ID
 	}
+	if g.chain != nil {
+		snap.Pipeline = g.chain.Status()
+	}
+
+	return snap
 }
 
 func (g *GenericDownloader) UpdateSavedFilePath(p string) { g.output.SavedFilePath = p }
 
+func (g *GenericDownloader) updatePostprocess(p internal.PostprocessTemplate) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.vcodec, g.acodec = p.VCodec, p.ACodec
+	if g.output.Archive {
+		// as written by yt-dlp
+		g.archiveEntry = strings.ToLower(p.ExtractorKey) + " " + p.ID
+	}
+}
+
 func (g *GenericDownloader) SetOutput(o internal.DownloadOutput)     { g.output = o }
 func (g *GenericDownloader) SetProgress(p internal.DownloadProgress) { g.progress = p }
 
@@ -218,6 +372,10 @@ func (g *GenericDownloader) SetPending(p bool) {
 	g.Pending = p
 }
 
+func (g *GenericDownloader) SetPipeline(p *pipeline.Pipeline) {
+	g.pipeline = p
+}
+
 func (g *GenericDownloader) GetId() string  { return g.Id }
 func (g *GenericDownloader) GetUrl() string { return g.URL }
 
@@ -234,8 +392,88 @@ func (g *GenericDownloader) RestoreFromSnapshot(snap *internal.ProcessSnapshot)
 	g.progress = s.Progress
 	g.output = s.Output
 	g.Params = s.Params
+	g.verification = s.Verification
 
 	return nil
 }
 
 func (g *GenericDownloader) IsCompleted() bool { return g.Completed }
+
+func (g *GenericDownloader) Verify() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// the metadata describes the default format, not the one selected
+	// by the params. Without a reported format the streams aren't checked.
+	if g.alreadyArchived {
+		return true
+	}
+
+	meta := g.Metadata
+	meta.VCodec, meta.ACodec = g.vcodec, g.acodec
+
+	v := verifyOutput(context.Background(), g.output.SavedFilePath, meta, g.Params)
+	v.Attempts = 1
+	if g.verification != nil {
+		v.Attempts += g.verification.Attempts
+	}
+
+	g.verification = &v
+
+	if !v.Valid {
+		g.progress.Status = internal.StatusCorrupt
+		slog.Warn("download failed verification",
+			slog.String("id", g.Id),
+			slog.String("url", g.URL),
+			slog.String("path", g.output.SavedFilePath),
+			slog.String("err", v.Error),
+		)
+	}
+
+	return v.Valid
+}
+
+func (g *GenericDownloader) Attempts() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.verification == nil {
+		return 0
+	}
+	return g.verification.Attempts
+}
+
+func (g *GenericDownloader) Reset() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// written from the previous output, they'd be left behind or overwritten
+	if err := g.removePipelineOutputs(); err != nil {
+		return err
+	}
+
+	// yt-dlp would otherwise skip the download as already done
+	if g.output.SavedFilePath != "" {
+		if err := os.Remove(g.output.SavedFilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// recorded before the verification, yt-dlp would stop on it
+	if g.archiveEntry != "" {
+		if err := archive.RemoveEntry(g.archiveEntry); err != nil {
+			return err
+		}
+		g.archiveEntry = ""
+	}
+
+	g.output.SavedFilePath = ""
+	g.vcodec, g.acodec = "", ""
+	g.alreadyArchived = false
+	g.chain = nil
+	g.progress = internal.DownloadProgress{Status: internal.StatusPending}
+	g.Completed = false
+	g.proc = nil
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package downloaders
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+func TestStartExitStatus(t *testing.T) {
+	prev := config.Instance().Paths
+	t.Cleanup(func() { config.Instance().Paths = prev })
+
+	config.Instance().Paths.DownloadPath = t.TempDir()
+
+	tests := []struct {
+		code   int
+		status int
+		failed bool
+	}{
+		{0, internal.StatusCompleted, false},
+		{1, internal.StatusErrored, true},
+		// stopped on an archived download
+		{101, internal.StatusCompleted, false},
+	}
+
+	for _, tt := range tests {
+		// stands in for yt-dlp
+		ytdlp := filepath.Join(t.TempDir(), "yt-dlp")
+		script := "#!/bin/sh\nexit " + strconv.Itoa(tt.code) + "\n"
+		if err := os.WriteFile(ytdlp, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		config.Instance().Paths.DownloaderPath = ytdlp
+
+		g := NewGenericDownload("https://example.com/video", nil).(*GenericDownloader)
+
+		err := g.Start()
+		if (err != nil) != tt.failed {
+			t.Errorf("exit %d: unexpected error %v", tt.code, err)
+		}
+		if status := g.Status().Progress.Status; status != tt.status {
+			t.Errorf("exit %d: status %d, want %d", tt.code, status, tt.status)
+		}
+		// nothing has been downloaded, there's nothing to verify
+		if tt.code == 101 && !g.Verify() {
+			t.Errorf("exit %d: the archived download failed verification", tt.code)
+		}
+	}
+}
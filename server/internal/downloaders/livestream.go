@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,26 +18,45 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
 )
 
 type LiveStreamDownloader struct {
 	progress internal.DownloadProgress
+	// directory and name (without extension) of the recording, optional
+	output internal.DownloadOutput
 
 	proc *os.Process
 
 	logConsumer LogConsumer
 
-	pipes []pipes.Pipe
+	// extra yt-dlp options, e.g. the format selector
+	params []string
+
+	pipes    []pipes.Pipe
+	pipeline *pipeline.Pipeline
+	chain    *pipes.Chain
+
+	// closed once the recording ends, see Done
+	done      chan struct{}
+	doneInit  sync.Once
+	doneClose sync.Once
+
+	// closed once the stream starts flowing, see Started
+	started      chan struct{}
+	startedInit  sync.Once
+	startedClose sync.Once
 
 	// embedded
 	DownloaderBase
 }
 
-func NewLiveStreamDownloader(url string, pipes []pipes.Pipe) Downloader {
+func NewLiveStreamDownloader(url string, pipes []pipes.Pipe, params ...string) Downloader {
 	l := &LiveStreamDownloader{
 		logConsumer: NewFFMpegLogConsumer(),
 		pipes:       pipes,
+		params:      params,
 	}
 	// in base
 	l.Id = uuid.NewString()
@@ -46,6 +66,9 @@ func NewLiveStreamDownloader(url string, pipes []pipes.Pipe) Downloader {
 }
 
 func (l *LiveStreamDownloader) Start() error {
+	// whatever the outcome, the waiters of Done (e.g. the chat capture) exit
+	defer l.finish()
+
 	l.SetPending(true)
 
 	baseParams := []string{
@@ -56,7 +79,30 @@ func (l *LiveStreamDownloader) Start() error {
 		"--no-exec",
 	}
 
-	params := append(baseParams, "-o", "-")
+	params := append(baseParams, l.params...)
+	params = append(params, "-o", "-")
+
+	base, err := l.basePath()
+	if err != nil {
+		return err
+	}
+
+	// build pipeline, a saved pipeline takes precedence over the given pipes
+	chain := pipes.NewChain(l.pipes...)
+	if l.pipeline != nil {
+		var err error
+		chain, err = pipeline.Build(l.pipeline, base, "mp4")
+		if err != nil {
+			slog.Error("failed to build pipeline", slog.String("id", l.Id), slog.Any("err", err))
+			return err
+		}
+	}
+
+	// the preview sees the stream as downloaded, before any other pipe
+	if config.Instance().HLS.Enabled {
+		chain = pipes.NewChain(append([]pipes.Pipe{pipes.NewHLS(l.Id)}, chain.Pipes()...)...)
+	}
+	l.chain = chain
 
 	cmd := exec.Command(config.Instance().Paths.DownloaderPath, params...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
@@ -88,39 +134,41 @@ func (l *LiveStreamDownloader) Start() error {
 		cancel()
 	}()
 
-	// build pipeline
-	reader := io.Reader(media)
-	for _, pipe := range l.pipes {
-		nr, err := pipe.Connect(reader)
-		if err != nil {
-			slog.Error("pipe failed", slog.String("pipe", pipe.Name()), slog.Any("err", err))
-			return err
-		}
-		reader = nr
+	reader, err := chain.Connect(startReader{Reader: media, start: l.begin})
+	if err != nil {
+		slog.Error("pipe failed", slog.Any("err", err))
+		l.Stop()
+		cmd.Wait()
+		return err
 	}
 
-	if !l.hasFileWriter() {
-		go func() {
-			filepath.Join(
-				config.Instance().Paths.DownloadPath,
-				fmt.Sprintf("%s (live) %s.mp4", l.Id, time.Now().Format(time.ANSIC)),
-			)
+	written := make(chan struct{})
 
-			defaultPath := filepath.Join(config.Instance().Paths.DownloadPath)
-			f, err := os.Create(defaultPath)
-			if err != nil {
-				slog.Error("failed to create fallback file", slog.Any("err", err))
-				return
-			}
-			defer f.Close()
+	go func() {
+		defer close(written)
 
-			_, err = io.Copy(f, reader)
-			if err != nil {
-				slog.Error("copy error", slog.Any("err", err))
-			}
-			slog.Info("download saved", slog.String("path", defaultPath))
-		}()
-	}
+		if l.hasFileWriter() {
+			// the tail of the pipeline must be drained anyway
+			io.Copy(io.Discard, reader)
+			return
+		}
+
+		defaultPath := base + ".mp4"
+
+		f, err := os.Create(defaultPath)
+		if err != nil {
+			slog.Error("failed to create fallback file", slog.Any("err", err))
+			io.Copy(io.Discard, reader)
+			return
+		}
+		defer f.Close()
+
+		_, err = io.Copy(f, reader)
+		if err != nil {
+			slog.Error("copy error", slog.Any("err", err))
+		}
+		slog.Info("download saved", slog.String("path", defaultPath))
+	}()
 
 	logs := make(chan []byte)
 	go produceLogs(stderr, logs)
@@ -128,6 +176,14 @@ func (l *LiveStreamDownloader) Start() error {
 
 	l.progress.Status = internal.StatusLiveStream
 
+	// yt-dlp closes the media stream once exited, wait for the pipeline to
+	// consume it before reaping the process.
+	<-written
+
+	if err := chain.Wait(); err != nil {
+		slog.Error("pipeline failed", slog.String("id", l.Id), slog.Any("err", err))
+	}
+
 	return cmd.Wait()
 }
 
@@ -135,6 +191,7 @@ func (l *LiveStreamDownloader) Stop() error {
 	defer func() {
 		l.progress.Status = internal.StatusCompleted
 		l.Complete()
+		l.finish()
 	}()
 	// yt-dlp uses multiple child process the parent process
 	// has been spawned with setPgid = true. To properly kill
@@ -156,17 +213,25 @@ func (l *LiveStreamDownloader) Stop() error {
 }
 
 func (l *LiveStreamDownloader) Status() internal.ProcessSnapshot {
-	return internal.ProcessSnapshot{
+	snap := internal.ProcessSnapshot{
 		Id:             l.Id,
 		Info:           l.Metadata,
 		Progress:       l.progress,
+		Output:         l.output,
+		Params:         l.params,
 		DownloaderName: "livestream",
 	}
+
+	if l.chain != nil {
+		snap.Pipeline = l.chain.Status()
+	}
+
+	return snap
 }
 
 func (l *LiveStreamDownloader) UpdateSavedFilePath(p string) {}
 
-func (l *LiveStreamDownloader) SetOutput(o internal.DownloadOutput)     {}
+func (l *LiveStreamDownloader) SetOutput(o internal.DownloadOutput)     { l.output = o }
 func (l *LiveStreamDownloader) SetProgress(p internal.DownloadProgress) { l.progress = p }
 
 func (l *LiveStreamDownloader) SetMetadata(fetcher func(url string) (*common.DownloadMetadata, error)) {
@@ -177,6 +242,10 @@ func (l *LiveStreamDownloader) SetPending(p bool) {
 	l.Pending = p
 }
 
+func (l *LiveStreamDownloader) SetPipeline(p *pipeline.Pipeline) {
+	l.pipeline = p
+}
+
 func (l *LiveStreamDownloader) GetId() string  { return l.Id }
 func (l *LiveStreamDownloader) GetUrl() string { return l.URL }
 
@@ -191,14 +260,89 @@ func (l *LiveStreamDownloader) RestoreFromSnapshot(snap *internal.ProcessSnapsho
 	l.URL = s.Info.URL
 	l.Metadata = s.Info
 	l.progress = s.Progress
+	l.output = s.Output
+	l.params = s.Params
 
 	return nil
 }
 
 func (l *LiveStreamDownloader) IsCompleted() bool { return l.Completed }
 
+// Closed once the recording ends, either successfully or not
+func (l *LiveStreamDownloader) Done() <-chan struct{} { return l.doneChan() }
+
+func (l *LiveStreamDownloader) doneChan() chan struct{} {
+	l.doneInit.Do(func() { l.done = make(chan struct{}) })
+	return l.done
+}
+
+func (l *LiveStreamDownloader) finish() {
+	l.doneClose.Do(func() { close(l.doneChan()) })
+}
+
+// Closed once the first bytes of the stream are read, the recording starts
+// from there. It's never closed if the recording fails to start, see Done.
+func (l *LiveStreamDownloader) Started() <-chan struct{} { return l.startedChan() }
+
+func (l *LiveStreamDownloader) startedChan() chan struct{} {
+	l.startedInit.Do(func() { l.started = make(chan struct{}) })
+	return l.started
+}
+
+func (l *LiveStreamDownloader) begin() {
+	l.startedClose.Do(func() { close(l.startedChan()) })
+}
+
+// Calls start on the first bytes read
+type startReader struct {
+	io.Reader
+	start func()
+}
+
+func (s startReader) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	if n > 0 {
+		s.start()
+	}
+	return n, err
+}
+
+// Branches of a fan-out write their own outputs
 func (l *LiveStreamDownloader) hasFileWriter() bool {
-	return slices.ContainsFunc(l.pipes, func(p pipes.Pipe) bool {
-		return p.Name() == "file-writer"
+	return slices.ContainsFunc(l.chain.Pipes(), func(p pipes.Pipe) bool {
+		return p.Name() == "file-writer" || p.Name() == "fan-out"
 	})
 }
+
+// Path of the recording without extension
+func (l *LiveStreamDownloader) basePath() (string, error) {
+	var (
+		dir  = config.Instance().Paths.DownloadPath
+		name = fmt.Sprintf("%s (live) %s", l.Id, time.Now().Format(time.ANSIC))
+	)
+
+	if l.output.Path != "" {
+		if err := internal.ValidateSubPath(l.output.Path); err != nil {
+			return "", err
+		}
+		dir = l.output.Path
+	}
+
+	if l.output.Filename != "" {
+		name = l.output.Filename
+		if filepath.Base(name) != name || name == "." || name == ".." {
+			return "", errors.New("the recording filename must not contain a path")
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	if err := internal.ValidateSubPath(path); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
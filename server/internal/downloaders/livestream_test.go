@@ -0,0 +1,72 @@
+package downloaders
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+func TestLiveStreamDoneOnFailedStart(t *testing.T) {
+	config.Instance().Paths.DownloadPath = t.TempDir()
+
+	l := NewLiveStreamDownloader("https://example.com/live", nil).(*LiveStreamDownloader)
+	l.SetOutput(internal.DownloadOutput{Path: filepath.Join(t.TempDir(), "outside")})
+
+	if err := l.Start(); err == nil {
+		t.Fatal("expected an error for an output path outside of the download path")
+	}
+
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done isn't closed after a failed start")
+	}
+}
+
+func TestLiveStreamRejectsUnsafeFilenames(t *testing.T) {
+	config.Instance().Paths.DownloadPath = t.TempDir()
+
+	for _, name := range []string{"..", ".", "../outside", "dir/name"} {
+		l := NewLiveStreamDownloader("https://example.com/live", nil).(*LiveStreamDownloader)
+		l.SetOutput(internal.DownloadOutput{Filename: name})
+
+		if path, err := l.basePath(); err == nil {
+			t.Errorf("%q: recorded as %s", name, path)
+		}
+	}
+}
+
+func TestLiveStreamStarted(t *testing.T) {
+	prev := config.Instance().Paths
+	t.Cleanup(func() { config.Instance().Paths = prev })
+
+	config.Instance().Paths.DownloadPath = t.TempDir()
+
+	for _, script := range []string{"printf stream", "exit 1"} {
+		// stands in for yt-dlp, writes the stream to stdout
+		ytdlp := filepath.Join(t.TempDir(), "yt-dlp")
+		if err := os.WriteFile(ytdlp, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		config.Instance().Paths.DownloaderPath = ytdlp
+
+		l := NewLiveStreamDownloader("https://example.com/live", nil).(*LiveStreamDownloader)
+		l.Start()
+
+		var started bool
+		select {
+		case <-l.Started():
+			started = true
+		default:
+		}
+
+		// nothing streamed, nothing recorded
+		if want := script != "exit 1"; started != want {
+			t.Errorf("%q: started %v, want %v", script, started, want)
+		}
+	}
+}
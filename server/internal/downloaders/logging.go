@@ -2,7 +2,9 @@ package downloaders
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
@@ -44,6 +46,12 @@ func (j *JSONLogConsumer) ParseLogEntry(entry []byte, d Downloader) {
 
 	if err := json.Unmarshal(entry, &postprocess); err == nil {
 		d.UpdateSavedFilePath(postprocess.FilePath)
+
+		if p, ok := d.(interface {
+			updatePostprocess(internal.PostprocessTemplate)
+		}); ok && postprocess.FilePath != "" {
+			p.updatePostprocess(postprocess)
+		}
 	}
 }
 
@@ -68,3 +76,52 @@ func (f *FFMpegLogConsumer) ParseLogEntry(entry []byte, d Downloader) {
 		slog.String("output", string(entry)),
 	)
 }
+
+// Parses the key=value blocks written by ffmpeg -progress pipe:1.
+// The total duration is read from the downloader metadata.
+type FFmpegProgressConsumer struct {
+	outTime float64
+	speed   float64
+}
+
+func NewFFmpegProgressConsumer() LogConsumer {
+	return &FFmpegProgressConsumer{}
+}
+
+func (f *FFmpegProgressConsumer) GetName() string { return "ffmpeg-progress-consumer" }
+
+func (f *FFmpegProgressConsumer) ParseLogEntry(entry []byte, d Downloader) {
+	key, value, ok := strings.Cut(strings.TrimSpace(string(entry)), "=")
+	if !ok {
+		return
+	}
+
+	switch key {
+	case "out_time_us":
+		if us, err := strconv.ParseFloat(value, 64); err == nil {
+			f.outTime = us / 1e6
+		}
+	case "speed":
+		if x, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			f.speed = x
+		}
+	case "progress":
+		total := d.Status().Info.Duration
+		if total <= 0 {
+			return
+		}
+
+		percentage := min(f.outTime/total*100, 100)
+
+		var eta float64
+		if f.speed > 0 {
+			eta = (total - f.outTime) / f.speed
+		}
+
+		d.SetProgress(internal.DownloadProgress{
+			Status:     internal.StatusDownloading,
+			Percentage: fmt.Sprintf("%.1f%%", percentage),
+			ETA:        max(eta, 0),
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/common"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/ffmpeg"
+)
+
+// Implemented by downloaders producing a file that can be checked
+// once yt-dlp has exited.
+type Verifiable interface {
+	// Probe the produced file, returns false if it's corrupt
+	Verify() bool
+	// How many times the output has been verified so far
+	Attempts() int
+	// Discard the corrupt output and make the download startable again
+	Reset() error
+}
+
+var audioOnlyExtensions = []string{
+	".mp3", ".m4a", ".opus", ".ogg", ".oga", ".flac", ".wav", ".aac", ".alac", ".vorbis",
+}
+
+// these flags alter the length of the output file, comparing the duration
+// against the one reported in the metadata would always fail
+var durationAlteringFlags = []string{
+	"--download-sections",
+	"--sponsorblock-remove",
+	"--remove-chapters",
+	"--split-chapters",
+}
+
+// Check the file at path against the metadata yt-dlp reported for the same url
+func verifyOutput(
+	ctx context.Context,
+	path string,
+	meta common.DownloadMetadata,
+	params []string,
+) internal.MediaVerification {
+	v := internal.MediaVerification{
+		ExpectedDuration: meta.Duration,
+		CheckedAt:        time.Now(),
+	}
+
+	fail := func(err error) internal.MediaVerification {
+		v.Valid = false
+		v.Error = err.Error()
+		return v
+	}
+
+	if path == "" {
+		return fail(errors.New("no output file has been reported by yt-dlp"))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	probed, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		return fail(err)
+	}
+
+	v.Duration = probed.Duration
+	v.Streams = probed.Streams
+
+	if len(probed.Streams) == 0 {
+		return fail(errors.New("no media streams found"))
+	}
+
+	var (
+		audioOnly   = slices.Contains(audioOnlyExtensions, strings.ToLower(filepath.Ext(path)))
+		expectVideo = !audioOnly && hasCodec(meta.VCodec)
+		expectAudio = hasCodec(meta.ACodec)
+	)
+
+	if expectVideo && !probed.Has("video") {
+		return fail(errors.New("missing video stream"))
+	}
+	if expectAudio && !probed.Has("audio") {
+		return fail(errors.New("missing audio stream"))
+	}
+
+	alteredDuration := slices.ContainsFunc(params, func(p string) bool {
+		return slices.Contains(durationAlteringFlags, p)
+	})
+
+	if meta.Duration > 0 && !alteredDuration {
+		tolerance := config.Instance().Verification.DurationTolerance
+		if delta := math.Abs(meta.Duration - probed.Duration); delta > tolerance {
+			return fail(fmt.Errorf(
+				"duration mismatch: expected %.2fs got %.2fs",
+				meta.Duration,
+				probed.Duration,
+			))
+		}
+	}
+
+	v.Valid = true
+	return v
+}
+
+// yt-dlp reports "none" when a format lacks a given stream, "NA" when the
+// codec is unknown
+func hasCodec(codec string) bool { return codec != "" && codec != "none" && codec != "NA" }
@@ -0,0 +1,163 @@
+package downloaders
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+)
+
+func TestVerifyAndReset(t *testing.T) {
+	g := NewGenericDownload("https://example.com/video", nil).(*GenericDownloader)
+
+	// yt-dlp didn't report the output file
+	if g.Verify() {
+		t.Fatal("a download without output has been verified")
+	}
+
+	status := g.Status()
+	if status.Progress.Status != internal.StatusCorrupt {
+		t.Errorf("unexpected status %d", status.Progress.Status)
+	}
+	if status.Verification == nil || status.Verification.Valid || status.Verification.Error == "" {
+		t.Errorf("unexpected verification %+v", status.Verification)
+	}
+
+	g.Verify()
+	if g.Attempts() != 2 {
+		t.Errorf("%d attempts, want 2", g.Attempts())
+	}
+
+	saved := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(saved, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.UpdateSavedFilePath(saved)
+	g.Complete()
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(saved); !os.IsNotExist(err) {
+		t.Error("the corrupt output hasn't been removed")
+	}
+	if g.IsCompleted() || g.Status().Progress.Status != internal.StatusPending || g.Status().Output.SavedFilePath != "" {
+		t.Errorf("the download can't be started again: %+v", g.Status())
+	}
+	// the attempts are kept across resets
+	if g.Attempts() != 2 {
+		t.Errorf("%d attempts after the reset, want 2", g.Attempts())
+	}
+
+	// the output could be already gone
+	if err := g.Reset(); err != nil {
+		t.Errorf("second reset: %v", err)
+	}
+}
+
+func TestVerifyDownloadedFormat(t *testing.T) {
+	g := NewGenericDownload("https://example.com/video", []string{"-x"}).(*GenericDownloader)
+	// the default format, not the one downloaded
+	g.Metadata.VCodec, g.Metadata.ACodec = "avc1", "mp4a"
+
+	consumer := NewJSONLogConsumer()
+	consumer.ParseLogEntry([]byte(`{"filepath":"video.opus","vcodec":"none","acodec":"opus"}`), g)
+
+	if g.output.SavedFilePath != "video.opus" || g.vcodec != "none" || g.acodec != "opus" {
+		t.Fatalf("unexpected output %s with %s and %s", g.output.SavedFilePath, g.vcodec, g.acodec)
+	}
+
+	// the progress lines don't reset the format
+	consumer.ParseLogEntry([]byte(`{"percentage":"50%","eta":1,"speed":1}`), g)
+	if g.vcodec != "none" || g.acodec != "opus" {
+		t.Errorf("format reset to %s and %s", g.vcodec, g.acodec)
+	}
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if g.vcodec != "" || g.acodec != "" {
+		t.Errorf("format kept after the reset")
+	}
+}
+
+func TestResetRemovesArchiveEntry(t *testing.T) {
+	// the archive is next to the config file
+	t.Chdir(t.TempDir())
+
+	const entry = "youtube abc"
+	if err := os.WriteFile("archive.txt", []byte("youtube other\n"+entry+"\ntwitchvod v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGenericDownload("https://example.com/video", nil).(*GenericDownloader)
+	g.SetOutput(internal.DownloadOutput{Archive: true})
+
+	NewJSONLogConsumer().ParseLogEntry(
+		[]byte(`{"filepath":"video.mp4","extractor_key":"Youtube","id":"abc"}`),
+		g,
+	)
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile("archive.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "youtube other\ntwitchvod v1\n" {
+		t.Errorf("unexpected archive %q", data)
+	}
+}
+
+func TestResetRemovesPipelineOutputs(t *testing.T) {
+	dir := t.TempDir()
+
+	saved := filepath.Join(dir, "video.mp4")
+	if err := os.WriteFile(saved, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGenericDownload("https://example.com/video", nil).(*GenericDownloader)
+	g.UpdateSavedFilePath(saved)
+	g.SetPipeline(&pipeline.Pipeline{
+		Name: "copies",
+		Steps: []pipeline.Step{{
+			Type: pipeline.StepFanOut,
+			Branches: []pipeline.Branch{
+				{Name: "a", Steps: []pipeline.Step{{Type: pipeline.StepFileWriter}}},
+				{Name: "b", Steps: []pipeline.Step{{Type: pipeline.StepFileWriter}}},
+			},
+		}},
+	})
+
+	// run by the completion hook once verified
+	g.runPipeline()
+
+	outputs := []string{
+		filepath.Join(dir, "video [copies] [a].mp4"),
+		filepath.Join(dir, "video [copies] [b].mp4"),
+	}
+	for _, path := range outputs {
+		if data, err := os.ReadFile(path); err != nil || string(data) != "video" {
+			t.Fatalf("unexpected output %s: %q %v", path, data, err)
+		}
+	}
+
+	if err := g.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range append(outputs, saved) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s hasn't been removed", path)
+		}
+	}
+	if g.Status().Pipeline != nil {
+		t.Error("the pipeline status of the previous output is still reported")
+	}
+}
@@ -0,0 +1,120 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+// Encoders and muxers supported by the local ffmpeg build
+type Capabilities struct {
+	// encoder name -> type (video, audio, subtitle)
+	Encoders map[string]string
+	Muxers   map[string]bool
+}
+
+func (c *Capabilities) HasEncoder(name, codecType string) bool {
+	t, ok := c.Encoders[name]
+	return ok && (codecType == "" || t == codecType)
+}
+
+func (c *Capabilities) HasMuxer(name string) bool { return c.Muxers[name] }
+
+var (
+	capabilities   *Capabilities
+	capabilitiesMu sync.Mutex
+)
+
+// Query the local ffmpeg for its encoders and muxers.
+// The result is cached once ffmpeg has been successfully queried.
+func GetCapabilities(ctx context.Context) (*Capabilities, error) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+
+	if capabilities != nil {
+		return capabilities, nil
+	}
+
+	encoders, err := list(ctx, "-encoders")
+	if err != nil {
+		return nil, err
+	}
+	muxers, err := list(ctx, "-muxers")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Capabilities{
+		Encoders: make(map[string]string),
+		Muxers:   make(map[string]bool),
+	}
+
+	// e.g. " V....D libx264              libx264 H.264 / AVC ..."
+	for _, fields := range encoders {
+		var t string
+		switch fields[0][0] {
+		case 'V':
+			t = "video"
+		case 'A':
+			t = "audio"
+		case 'S':
+			t = "subtitle"
+		default:
+			continue
+		}
+		c.Encoders[fields[1]] = t
+	}
+
+	// e.g. "  E  matroska,webm    Matroska"
+	for _, fields := range muxers {
+		if !strings.Contains(fields[0], "E") {
+			continue
+		}
+		for name := range strings.SplitSeq(fields[1], ",") {
+			c.Muxers[name] = true
+		}
+	}
+
+	capabilities = c
+
+	return c, nil
+}
+
+// Run ffmpeg with one of the listing flags and return the first two fields
+// (flags and name) of each entry, the legend before the "--" separator is skipped.
+func list(ctx context.Context, flag string) ([][2]string, error) {
+	cmd := exec.CommandContext(ctx, config.Instance().Paths.FFmpegPath, "-hide_banner", flag)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries [][2]string
+		legend  = true
+		scanner = bufio.NewScanner(bytes.NewReader(out))
+	)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if legend {
+			legend = !strings.HasPrefix(line, "--")
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		entries = append(entries, [2]string{fields[0], fields[1]})
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,106 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+// Used to deser the ffprobe -show_format -show_streams output
+type probeOutput struct {
+	Streams []struct {
+		Index       int    `json:"index"`
+		CodecType   string `json:"codec_type"`
+		CodecName   string `json:"codec_name"`
+		Profile     string `json:"profile"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		Channels    int    `json:"channels"`
+		SampleRate  string `json:"sample_rate"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+type ProbeResult struct {
+	Duration float64
+	Streams  []internal.MediaStream
+}
+
+// Has at least one stream of the given type (video, audio, subtitle...)
+func (p *ProbeResult) Has(codecType string) bool {
+	for _, s := range p.Streams {
+		if s.Type == codecType {
+			return true
+		}
+	}
+	return false
+}
+
+// Probe runs ffprobe against a local file and returns its duration and streams.
+// Embedded cover arts are reported by ffprobe as video streams and are skipped.
+func Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		config.Instance().Paths.FFprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+
+	var out probeOutput
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		return nil, err
+	}
+
+	res := &ProbeResult{}
+
+	if out.Format.Duration != "" {
+		res.Duration, err = strconv.ParseFloat(out.Format.Duration, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range out.Streams {
+		if s.Disposition.AttachedPic == 1 {
+			continue
+		}
+		res.Streams = append(res.Streams, internal.MediaStream{
+			Index:      s.Index,
+			Type:       s.CodecType,
+			Codec:      s.CodecName,
+			Profile:    s.Profile,
+			Width:      s.Width,
+			Height:     s.Height,
+			Channels:   s.Channels,
+			SampleRate: s.SampleRate,
+		})
+	}
+
+	return res, nil
+}
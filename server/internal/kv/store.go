@@ -10,6 +10,7 @@ import (
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 
 	bolt "go.etcd.io/bbolt"
@@ -114,7 +115,14 @@ func (m *Store) All() *[]internal.ProcessSnapshot {
 }
 
 // Restore a persisted state
-func (m *Store) Restore(mq *queue.MessageQueue) {
+// Queue of the restored jobs of a kind, e.g. the post-processing queue
+type Publisher interface {
+	Publish(d downloaders.Downloader)
+}
+
+// Restore the snapshotted downloads, the ones not completed are published
+// again. The post-processing jobs go to postprocessing, the others to mq.
+func (m *Store) Restore(mq *queue.MessageQueue, postprocessing Publisher, pipelines *pipeline.Store) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -134,17 +142,37 @@ func (m *Store) Restore(mq *queue.MessageQueue) {
 
 	for _, snap := range snapshot {
 		var restored downloaders.Downloader
-		if snap.DownloaderName == "generic" {
+		switch snap.DownloaderName {
+		case "generic":
 			d := downloaders.NewGenericDownload("", []string{})
 			err := d.RestoreFromSnapshot(&snap)
 			if err != nil {
 				continue
 			}
+			if snap.PipelineId != "" {
+				d.SetPipeline(pipelines.ResolveOrNone(snap.PipelineId))
+			}
 			restored = d
 			m.table[snap.Id] = restored
 			if !restored.(*downloaders.GenericDownloader).DownloaderBase.Completed {
 				mq.Publish(restored)
 			}
+		case "clip", "postprocess":
+			// ffmpeg jobs, the interrupted ones are started over
+			d := downloaders.NewFFmpegDownload(snap.DownloaderName, "", "", 0, nil, nil)
+			if err := d.RestoreFromSnapshot(&snap); err != nil {
+				slog.Warn("failed to restore ffmpeg job", slog.String("id", snap.Id), slog.Any("err", err))
+				continue
+			}
+			m.table[snap.Id] = d
+			if d.IsCompleted() {
+				continue
+			}
+			if snap.DownloaderName == "postprocess" {
+				postprocessing.Publish(d)
+			} else {
+				mq.Publish(d)
+			}
 		}
 	}
 }
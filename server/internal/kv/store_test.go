@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Collects the ids of the published jobs
+type testPublisher struct {
+	ids []string
+}
+
+func (p *testPublisher) Publish(d downloaders.Downloader) { p.ids = append(p.ids, d.GetId()) }
+
+func TestRestoreFFmpegJobs(t *testing.T) {
+	dir := t.TempDir()
+
+	prevPath, prevSize := config.Instance().Paths.DownloadPath, config.Instance().Server.QueueSize
+	config.Instance().Paths.DownloadPath = dir
+	config.Instance().Server.QueueSize = 2
+	t.Cleanup(func() {
+		config.Instance().Paths.DownloadPath = prevPath
+		config.Instance().Server.QueueSize = prevSize
+	})
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var (
+		inputArgs = []string{"-ss", "10", "-to", "20"}
+		args      = []string{"-c", "copy"}
+	)
+
+	jobs := map[string]int{
+		"interrupted.mp4": internal.StatusDownloading,
+		"completed.mp4":   internal.StatusCompleted,
+		"failed.mp4":      internal.StatusErrored,
+	}
+
+	saved, err := NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	for name, status := range jobs {
+		output := filepath.Join(dir, name)
+		if err := os.WriteFile(output, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		d := downloaders.NewFFmpegDownload("clip", filepath.Join(dir, "source.mp4"), output, 10, inputArgs, args)
+		d.SetProgress(internal.DownloadProgress{Status: status})
+		ids[name] = saved.Set(d)
+	}
+
+	postprocessed := downloaders.NewFFmpegDownload(
+		"postprocess",
+		filepath.Join(dir, "source.mp4"),
+		filepath.Join(dir, "source [h265].mp4"),
+		10,
+		nil,
+		args,
+	)
+	postprocessed.SetProgress(internal.DownloadProgress{Status: internal.StatusDownloading})
+	postprocessId := saved.Set(postprocessed)
+
+	if err := saved.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	mq, err := queue.NewMessageQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipelines, err := pipeline.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postprocessing := &testPublisher{}
+	restored.Restore(mq, postprocessing, pipelines)
+
+	// not run by the download workers
+	if !slices.Equal(postprocessing.ids, []string{postprocessId}) {
+		t.Errorf("post-processing queue got %v, want %s", postprocessing.ids, postprocessId)
+	}
+
+	for name, status := range jobs {
+		d, err := restored.Get(ids[name])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		f := d.(*downloaders.FFmpegDownloader)
+		if f.Kind != "clip" || !slices.Equal(f.InputArgs, inputArgs) || !slices.Equal(f.Args, args) {
+			t.Errorf("%s: restored as %s with %v and %v", name, f.Kind, f.InputArgs, f.Args)
+		}
+
+		// only the interrupted job is started over, without its partial output
+		_, statErr := os.Stat(filepath.Join(dir, name))
+		interrupted := status == internal.StatusDownloading
+
+		if f.Pending != interrupted {
+			t.Errorf("%s: queued %v, want %v", name, f.Pending, interrupted)
+		}
+		if os.IsNotExist(statErr) != interrupted {
+			t.Errorf("%s: output removed %v, want %v", name, os.IsNotExist(statErr), interrupted)
+		}
+	}
+}
@@ -1,18 +1,20 @@
 package livestream
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
-	"io"
-	"os"
+	"log/slog"
 	"os/exec"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 )
@@ -24,181 +26,231 @@ const (
 	errored
 )
 
+const (
+	// not checked yet
+	StateChecking    = "checking"
+	StateUpcoming    = "upcoming"
+	StateLive        = "live"
+	StateEnded       = "ended"
+	StateUnavailable = "unavailable"
+)
+
+const (
+	pollInterval = 30 * time.Second
+	// an upcoming stream is checked at least this often, the schedule may change
+	maxPollInterval = 10 * time.Minute
+)
+
 // Defines a generic livestream.
 // A livestream is identified by its url.
 type LiveStream struct {
 	url          string
-	proc         *os.Process        // used to manually kill the yt-dlp process
 	status       int                // whether is monitoring or completed
+	state        string             // one of the State constants
 	done         chan *LiveStream   // where to signal the completition
 	waitTimeChan chan time.Duration // time to livestream start
 	waitTime     time.Duration
 	liveDate     time.Time
+	mu           sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mq       *queue.MessageQueue
+	store    *kv.Store
+	pipeline *pipeline.Pipeline    // applied on the recording
+	persist  func(l *LiveStream)   // called when the scheduled start changes
+	poll     func() (*Info, error) // replaced in tests
+}
 
-	mq    *queue.MessageQueue
-	store *kv.Store
+// Subset of the yt-dlp -J output
+type Info struct {
+	Title            string `json:"title"`
+	LiveStatus       string `json:"live_status"`
+	ReleaseTimestamp *int64 `json:"release_timestamp"`
 }
 
+func (i *Info) IsLive() bool { return i.LiveStatus == "is_live" }
+
 func New(url string, done chan *LiveStream, mq *queue.MessageQueue, store *kv.Store) *LiveStream {
-	return &LiveStream{
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := &LiveStream{
 		url:          url,
 		done:         done,
 		status:       waiting,
+		state:        StateChecking,
 		waitTime:     time.Second * 0,
 		waitTimeChan: make(chan time.Duration),
+		ctx:          ctx,
+		cancel:       cancel,
 		mq:           mq,
 		store:        store,
 	}
+	l.poll = func() (*Info, error) { return FetchInfo(l.ctx, l.url) }
+
+	return l
 }
 
-// Start the livestream monitoring process, once completion signals on the done channel
+// Start the livestream monitoring process, once completion signals on the done channel.
+// The metadata of the url is polled until the stream is live or has ended.
 func (l *LiveStream) Start() error {
-	cmd := exec.Command(
-		config.Instance().Paths.DownloaderPath,
-		l.url,
-		"--wait-for-video", "30", // wait for the stream to be live and recheck every 10 secs
-		"--no-colors", // no ansi color fuzz
-		"--simulate",
-		"--newline",
-		"--paths", config.Instance().Paths.DownloadPath,
-	)
+	for {
+		next := l.check()
+
+		switch l.State() {
+		case StateLive:
+			l.publish()
+			l.done <- l
+			return nil
+		case StateEnded:
+			l.done <- l
+			return nil
+		}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		l.status = errored
-		return err
+		select {
+		case <-l.ctx.Done():
+			// Kill already signaled the completion
+			return nil
+		case <-time.After(next):
+		}
 	}
-	defer stdout.Close()
+}
 
-	if err := cmd.Start(); err != nil {
-		l.status = errored
-		return err
+// Poll the livestream state, returns when it has to be checked again
+func (l *LiveStream) check() time.Duration {
+	info, err := l.poll()
+	if err != nil {
+		if l.ctx.Err() == nil {
+			slog.Warn("livestream unavailable", slog.String("url", l.url), slog.Any("err", err))
+		}
+		l.setState(StateUnavailable)
+		return pollInterval
 	}
 
-	l.proc = cmd.Process
-	l.status = waiting
+	switch info.LiveStatus {
+	case "is_live":
+		l.setState(StateLive)
+		return 0
 
-	// Start monitoring when the livestream is goin to be live.
-	// If already live do nothing.
-	go l.monitorStartTime(stdout)
+	case "is_upcoming":
+		l.setState(StateUpcoming)
 
-	// Wait to the simulated download process to finish.
-	cmd.Wait()
-
-	// Set the job as completed and notify the parent the completion.
-	l.status = completed
-	l.done <- l
+		if info.ReleaseTimestamp == nil {
+			return pollInterval
+		}
 
-	// Send the started livestream to the message queue! :D
+		l.setLiveDate(time.Unix(*info.ReleaseTimestamp, 0))
 
-	//TODO: add pipes
-	d := downloaders.NewLiveStreamDownloader(l.url, []pipes.Pipe{})
+		// check again right before the scheduled start
+		return min(max(time.Until(l.LiveDate())-pollInterval, pollInterval), maxPollInterval)
 
-	l.store.Set(d)
-	l.mq.Publish(d)
+	case "was_live", "post_live", "not_live":
+		l.setState(StateEnded)
+		return 0
 
-	return nil
+	default:
+		// unknown to yt-dlp for the given extractor
+		l.setState(StateUnavailable)
+		return pollInterval
+	}
 }
 
-func (l *LiveStream) monitorStartTime(r io.Reader) {
-	// yt-dlp shows the time in the stdout
-	scanner := bufio.NewScanner(r)
+// Query yt-dlp for the live status of url
+func FetchInfo(ctx context.Context, url string) (*Info, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		config.Instance().Paths.DownloaderPath,
+		url,
+		"-J",
+		"--no-playlist",
+		"--no-warnings",
+		"--ignore-no-formats-error", // upcoming streams have no formats yet
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 
-	defer func() {
-		l.status = inProgress
-		close(l.waitTimeChan)
-	}()
-
-	// however the time to live is not shown in a new line (and atm there's nothing to do about)
-	// use a custom split funciton to set the line separator to \r instead of \r\n or \n
-	scanner.Split(stdoutSplitFunc)
-
-	waitTimeScanner := func() {
-		for scanner.Scan() {
-			// l.log <- scanner.Bytes()
-
-			// if this substring is in the current line the download is starting,
-			// no need to monitor the time to live.
-			//TODO: silly
-			if !strings.Contains(scanner.Text(), "Remaining time until next attempt") {
-				return
-			}
-
-			parts := strings.Split(scanner.Text(), ": ")
-			if len(parts) < 2 {
-				continue
-			}
-
-			startsIn := parts[1]
-			parsed, err := parseTimeSpan(startsIn)
-			if err != nil {
-				continue
-			}
-
-			l.liveDate = parsed
-
-			//TODO: check if using channels is stupid or not
-			// l.waitTimeChan <- time.Until(start)
-			l.waitTime = time.Until(parsed)
+	stdout, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
 		}
+		return nil, err
 	}
 
-	scanner.Scan()
-
-	for !strings.Contains(scanner.Text(), "Waiting for") {
-		scanner.Scan()
+	var i Info
+	if err := json.Unmarshal(stdout, &i); err != nil {
+		return nil, err
 	}
 
-	waitTimeScanner()
+	return &i, nil
+}
+
+// Send the started livestream to the message queue! :D
+func (l *LiveStream) publish() {
+	d := downloaders.NewLiveStreamDownloader(l.url, []pipes.Pipe{})
+	d.SetPipeline(l.pipeline)
+
+	l.store.Set(d)
+	l.mq.Publish(d)
 }
 
 func (l *LiveStream) WaitTime() <-chan time.Duration {
 	return l.waitTimeChan
 }
 
-// Kills a livestream process and signal its completition
-func (l *LiveStream) Kill() error {
-	l.done <- l
-
-	if l.proc != nil {
-		return l.proc.Kill()
-	}
+func (l *LiveStream) State() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.state
+}
 
-	return errors.New("nil yt-dlp process")
+func (l *LiveStream) LiveDate() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.liveDate
 }
 
-// Parse the timespan returned from yt-dlp (time to live)
-//
-//	parsed := parseTimeSpan("76:12:15")
-//	fmt.Println(parsed) // 2024-07-21 13:59:59.634781 +0200 CEST
-func parseTimeSpan(timeStr string) (time.Time, error) {
-	parts := strings.Split(timeStr, ":")
+func (l *LiveStream) setState(state string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	hh, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return time.Time{}, err
-	}
-	mm, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return time.Time{}, err
-	}
-	ss, err := strconv.Atoi(parts[2])
-	if err != nil {
-		return time.Time{}, err
-	}
+	l.state = state
 
-	dd := 0
+	switch state {
+	case StateChecking, StateUpcoming:
+		l.status = waiting
+	case StateLive:
+		l.status = inProgress
+	case StateEnded:
+		l.status = completed
+	case StateUnavailable:
+		l.status = errored
+	}
+}
 
-	if hh > 24 {
-		dd = hh / 24
-		hh = hh % 24
+func (l *LiveStream) setLiveDate(t time.Time) {
+	l.mu.Lock()
+	changed := !t.Equal(l.liveDate)
+	l.liveDate = t
+	l.waitTime = time.Until(t)
+	l.mu.Unlock()
+
+	// nobody may be listening
+	select {
+	case l.waitTimeChan <- time.Until(t):
+	default:
 	}
 
-	start := time.Now()
-	start = start.AddDate(0, 0, dd)
-	start = start.Add(time.Duration(hh) * time.Hour)
-	start = start.Add(time.Duration(mm) * time.Minute)
-	start = start.Add(time.Duration(ss) * time.Second)
+	if changed && l.persist != nil {
+		l.persist(l)
+	}
+}
 
-	return start, nil
+// Kills a livestream process and signal its completition
+func (l *LiveStream) Kill() error {
+	l.cancel()
+	l.done <- l
+	return nil
 }
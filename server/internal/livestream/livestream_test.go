@@ -1,6 +1,7 @@
 package livestream
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -37,3 +38,60 @@ func TestLivestream(t *testing.T) {
 		}
 	}
 }
+
+func TestLivestreamStates(t *testing.T) {
+	release := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		info  *Info
+		err   error
+		state string
+	}{
+		{info: &Info{LiveStatus: "is_upcoming", ReleaseTimestamp: &release}, state: StateUpcoming},
+		{info: &Info{LiveStatus: "is_upcoming"}, state: StateUpcoming},
+		{info: &Info{LiveStatus: "is_live"}, state: StateLive},
+		{info: &Info{LiveStatus: "was_live"}, state: StateEnded},
+		{info: &Info{LiveStatus: "post_live"}, state: StateEnded},
+		{info: &Info{LiveStatus: "not_live"}, state: StateEnded},
+		{info: &Info{}, state: StateUnavailable},
+		{err: errors.New("channel is not currently live"), state: StateUnavailable},
+	}
+
+	for _, tt := range tests {
+		ls := New(URL, make(chan *LiveStream), &queue.MessageQueue{}, &kv.Store{})
+		ls.poll = func() (*Info, error) { return tt.info, tt.err }
+
+		next := ls.check()
+
+		if ls.State() != tt.state {
+			t.Errorf("%+v: expected %s got %s", tt.info, tt.state, ls.State())
+		}
+		if next < 0 || next > maxPollInterval {
+			t.Errorf("%+v: unexpected poll interval %s", tt.info, next)
+		}
+	}
+}
+
+func TestLivestreamScheduledStart(t *testing.T) {
+	release := time.Now().Add(time.Hour).Truncate(time.Second)
+	ts := release.Unix()
+
+	var persisted time.Time
+
+	ls := New(URL, make(chan *LiveStream), &queue.MessageQueue{}, &kv.Store{})
+	ls.poll = func() (*Info, error) {
+		return &Info{LiveStatus: "is_upcoming", ReleaseTimestamp: &ts}, nil
+	}
+	ls.persist = func(l *LiveStream) { persisted = l.LiveDate() }
+
+	if next := ls.check(); next != maxPollInterval {
+		t.Errorf("expected to be checked again in %s, got %s", maxPollInterval, next)
+	}
+
+	if !ls.LiveDate().Equal(release) {
+		t.Errorf("expected live date %s got %s", release, ls.LiveDate())
+	}
+	if !persisted.Equal(release) {
+		t.Errorf("the scheduled start has not been persisted")
+	}
+}
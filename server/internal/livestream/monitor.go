@@ -1,33 +1,47 @@
 package livestream
 
 import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	bolt "go.etcd.io/bbolt"
 )
 
 var bucket = []byte("livestreams")
 
+// Persisted options of a monitored livestream
+type options struct {
+	PipelineId string `json:"pipeline_id,omitempty"`
+	// known once the livestream has been found upcoming
+	ScheduledStart time.Time `json:"scheduled_start,omitzero"`
+}
+
 type Monitor struct {
-	db      *bolt.DB
-	store   *kv.Store              // where the just started livestream will be published
-	mq      *queue.MessageQueue    // where the just started livestream will be published
-	streams map[string]*LiveStream // keeps track of the livestreams
-	done    chan *LiveStream       // to signal individual processes completition
+	db        *bolt.DB
+	store     *kv.Store              // where the just started livestream will be published
+	mq        *queue.MessageQueue    // where the just started livestream will be published
+	pipelines *pipeline.Store        // where the pipelines attached to the livestreams are saved
+	streams   map[string]*LiveStream // keeps track of the livestreams
+	done      chan *LiveStream       // to signal individual processes completition
 }
 
-func NewMonitor(mq *queue.MessageQueue, store *kv.Store, db *bolt.DB) *Monitor {
+func NewMonitor(mq *queue.MessageQueue, store *kv.Store, pipelines *pipeline.Store, db *bolt.DB) *Monitor {
 	db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(bucket)
 		return err
 	})
 
 	return &Monitor{
-		mq:      mq,
-		db:      db,
-		store:   store,
-		streams: make(map[string]*LiveStream),
-		done:    make(chan *LiveStream),
+		mq:        mq,
+		db:        db,
+		store:     store,
+		pipelines: pipelines,
+		streams:   make(map[string]*LiveStream),
+		done:      make(chan *LiveStream),
 	}
 }
 
@@ -43,15 +57,53 @@ func (m *Monitor) Schedule() {
 	}
 }
 
-func (m *Monitor) Add(url string) {
+// Monitor a livestream, once live the recording is processed by
+// the pipeline identified by pipelineId (can be empty).
+func (m *Monitor) Add(url, pipelineId string) error {
+	return m.add(url, options{PipelineId: pipelineId})
+}
+
+func (m *Monitor) add(url string, opts options) error {
+	p, err := m.pipelines.Resolve(opts.PipelineId)
+	if err != nil {
+		return err
+	}
+
 	ls := New(url, m.done, m.mq, m.store)
+	ls.pipeline = p
+
+	// shown until the first check completes
+	if !opts.ScheduledStart.IsZero() {
+		ls.liveDate = opts.ScheduledStart
+		ls.waitTime = time.Until(opts.ScheduledStart)
+	}
+
+	ls.persist = func(l *LiveStream) {
+		opts.ScheduledStart = l.LiveDate()
+		if err := m.save(url, opts); err != nil {
+			slog.Error("failed to persist livestream", slog.String("url", url), slog.Any("err", err))
+		}
+	}
+
+	if err := m.save(url, opts); err != nil {
+		return err
+	}
 
 	go ls.Start()
 	m.streams[url] = ls
 
-	m.db.Update(func(tx *bolt.Tx) error {
+	return nil
+}
+
+func (m *Monitor) save(url string, opts options) error {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucket)
-		return b.Put([]byte(url), []byte{})
+		return b.Put([]byte(url), data)
 	})
 }
 
@@ -72,11 +124,14 @@ func (m *Monitor) Status() LiveStreamStatus {
 	status := make(LiveStreamStatus)
 
 	for k, v := range m.streams {
+		v.mu.RLock()
 		status[k] = Status{
 			Status:   v.status,
+			State:    v.state,
 			WaitTime: v.waitTime,
 			LiveDate: v.liveDate,
 		}
+		v.mu.RUnlock()
 	}
 
 	return status
@@ -84,11 +139,31 @@ func (m *Monitor) Status() LiveStreamStatus {
 
 // Restore a saved state and resume the monitored livestreams
 func (m *Monitor) Restore() error {
-	return m.db.View(func(tx *bolt.Tx) error {
+	saved := make(map[string]options)
+
+	err := m.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucket)
 		return b.ForEach(func(k, v []byte) error {
-			m.Add(string(k))
+			var opts options
+			if len(v) > 0 {
+				if err := json.Unmarshal(v, &opts); err != nil {
+					return err
+				}
+			}
+			saved[string(k)] = opts
 			return nil
 		})
 	})
+	if err != nil {
+		return err
+	}
+
+	// add writes to the db, it can't be called within the read transaction
+	for url, opts := range saved {
+		if err := m.add(url, opts); err != nil {
+			slog.Error("failed to restore livestream", slog.String("url", url), slog.Any("err", err))
+		}
+	}
+
+	return nil
 }
@@ -6,6 +6,7 @@ type LiveStreamStatus = map[string]Status
 
 type Status = struct {
 	Status   int           `json:"status"`
+	State    string        `json:"state"` // upcoming, live, ended, unavailable
 	WaitTime time.Duration `json:"waitTime"`
 	LiveDate time.Time     `json:"liveDate"`
 }
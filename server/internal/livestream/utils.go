@@ -1,16 +0,0 @@
-package livestream
-
-import "bufio"
-
-var stdoutSplitFunc = func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	for i := 0; i < len(data); i++ {
-		if data[i] == '\r' || data[i] == '\n' {
-			return i + 1, data[:i], nil
-		}
-	}
-	if !atEOF {
-		return 0, nil, nil
-	}
-
-	return 0, data, bufio.ErrFinalToken
-}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+var ErrIsNotSubPath = errors.New("the provided output path is not valid. It should be under the configured download path.")
+
+// Check that path is the configured download path or is inside of it
+func ValidateSubPath(path string) error {
+	root, err := filepath.Abs(config.Instance().Paths.DownloadPath)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return err
+	}
+	if rel != "." && !filepath.IsLocal(rel) {
+		return ErrIsNotSubPath
+	}
+
+	return nil
+}
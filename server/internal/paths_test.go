@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+func TestValidateSubPath(t *testing.T) {
+	root := t.TempDir()
+	config.Instance().Paths.DownloadPath = root
+
+	valid := []string{
+		root,
+		filepath.Join(root, "video.mp4"),
+		filepath.Join(root, "channel", "%(title)s.%(ext)s"),
+		filepath.Join(root, "channel", "..", "video.mp4"),
+	}
+	for _, p := range valid {
+		if err := ValidateSubPath(p); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+
+	invalid := []string{
+		filepath.Dir(root),
+		filepath.Join(root, "..", "video.mp4"),
+		filepath.Join(root+"-other", "video.mp4"),
+		"/etc/passwd",
+	}
+	for _, p := range invalid {
+		if err := ValidateSubPath(p); err == nil {
+			t.Errorf("%s: expected an error", p)
+		}
+	}
+}
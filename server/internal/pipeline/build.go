@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
+)
+
+const (
+	StepTranscoder = "transcoder"
+	StepFileWriter = "filewriter"
+	StepFanOut     = "fanout"
+	StepRestream   = "restream"
+)
+
+// Build the chain of pipes described by a saved pipeline.
+//
+// The files written by the filewriter steps are named after base (a path
+// without extension), ext is the extension of the stream entering the pipeline
+// and is used until a transcoder changes the container.
+func Build(p *Pipeline, base, ext string) (*pipes.Chain, error) {
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("pipeline %s has no steps", p.Name)
+	}
+
+	chain, err := build(p.Steps, base, strings.TrimPrefix(ext, "."), make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	return pipes.NewChain(chain...), nil
+}
+
+func build(steps []Step, base, ext string, used map[string]bool) ([]pipes.Pipe, error) {
+	chain := make([]pipes.Pipe, 0, len(steps))
+
+	for i, step := range steps {
+		switch step.Type {
+		case StepTranscoder:
+			if err := validateArgs(step.FFmpegArgs); err != nil {
+				return nil, err
+			}
+			chain = append(chain, &pipes.Transcoder{
+				Format:     step.container(),
+				VideoCodec: step.VideoCodec,
+				AudioCodec: step.AudioCodec,
+				Args:       step.FFmpegArgs,
+			})
+			ext = extension(step.container())
+
+		case StepFileWriter:
+			path, err := outputPath(step, base, ext, used)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, &pipes.FileWriter{
+				Path:    path,
+				IsFinal: i == len(steps)-1,
+			})
+
+		case StepRestream:
+			if _, err := pipes.RestreamFormat(step.URL); err != nil {
+				return nil, err
+			}
+			chain = append(chain, &pipes.Restream{URL: step.URL})
+
+		case StepFanOut:
+			if i != len(steps)-1 {
+				return nil, errors.New("fanout must be the last step")
+			}
+			if err := validateBranches(step.Branches); err != nil {
+				return nil, err
+			}
+
+			branches := make([]*pipes.Branch, len(step.Branches))
+			for j, b := range step.Branches {
+				// files of each branch are named after it
+				sub, err := build(b.Steps, fmt.Sprintf("%s [%s]", base, b.Name), ext, used)
+				if err != nil {
+					return nil, fmt.Errorf("branch %s: %w", b.Name, err)
+				}
+				branches[j] = pipes.NewBranch(b.Name, pipes.NewChain(sub...))
+			}
+			chain = append(chain, pipes.NewFanOut(branches...))
+
+		default:
+			return nil, fmt.Errorf("unknown step type %q", step.Type)
+		}
+	}
+
+	return chain, nil
+}
+
+func validateBranches(branches []Branch) error {
+	if len(branches) == 0 {
+		return errors.New("fanout without branches")
+	}
+
+	names := make(map[string]bool, len(branches))
+	for _, b := range branches {
+		if b.Name == "" {
+			return errors.New("fanout branches must be named")
+		}
+		if names[b.Name] {
+			return fmt.Errorf("duplicate fanout branch %s", b.Name)
+		}
+		if len(b.Steps) == 0 {
+			return fmt.Errorf("branch %s has no steps", b.Name)
+		}
+		names[b.Name] = true
+	}
+
+	return nil
+}
+
+// Writers of a chain, including the ones of fan-out branches
+func fileWriters(chain []pipes.Pipe) []*pipes.FileWriter {
+	var writers []*pipes.FileWriter
+
+	for _, p := range chain {
+		switch p := p.(type) {
+		case *pipes.FileWriter:
+			writers = append(writers, p)
+		case *pipes.FanOut:
+			for _, b := range p.Branches {
+				writers = append(writers, fileWriters(b.Chain.Pipes())...)
+			}
+		}
+	}
+
+	return writers
+}
+
+// Path of a filewriter step output. Step.Path, if set, is the directory
+// where the file is written and must be under the download path.
+func outputPath(step Step, base, ext string, used map[string]bool) (string, error) {
+	dir := filepath.Dir(base)
+
+	if step.Path != "" {
+		if err := validatePath(step.Path); err != nil {
+			return "", err
+		}
+		dir = step.Path
+	}
+
+	if step.Extension != "" {
+		ext = strings.TrimPrefix(step.Extension, ".")
+	}
+
+	name := filepath.Join(dir, filepath.Base(base))
+	path := name + "." + ext
+
+	// two writers of the same pipeline must not overwrite each other
+	for n := 1; used[path]; n++ {
+		path = fmt.Sprintf("%s (%d).%s", name, n, ext)
+	}
+	used[path] = true
+
+	return path, nil
+}
+
+func validatePath(path string) error {
+	if err := internal.ValidateSubPath(path); err != nil {
+		return errors.New("the filewriter path must be under the configured download path")
+	}
+	return nil
+}
+
+func (s Step) container() string {
+	if s.Container == "" {
+		return "webm"
+	}
+	return s.Container
+}
+
+// muxers whose name differs from the extension of the files they produce
+var muxerExtensions = map[string]string{
+	"matroska": "mkv",
+	"mpegts":   "ts",
+	"adts":     "aac",
+	"ipod":     "m4a",
+	"ogg":      "ogg",
+	"opus":     "opus",
+}
+
+func extension(muxer string) string {
+	if ext, ok := muxerExtensions[muxer]; ok {
+		return ext
+	}
+	return muxer
+}
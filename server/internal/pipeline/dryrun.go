@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/ffmpeg"
+)
+
+type DryRunOutput struct {
+	File     string                 `json:"file"`
+	Size     int64                  `json:"size"`
+	Duration float64                `json:"duration"`
+	Streams  []internal.MediaStream `json:"streams"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+type DryRunReport struct {
+	Valid   bool                  `json:"valid"`
+	Error   string                `json:"error,omitempty"`
+	Steps   []internal.PipeStatus `json:"steps"`
+	Outputs []DryRunOutput        `json:"outputs"`
+}
+
+// Run the pipeline against a few seconds of generated audio and video.
+// The files are written in a temporary directory which is removed afterwards,
+// the configured filewriter paths are only validated.
+func DryRun(ctx context.Context, p *Pipeline) (*DryRunReport, error) {
+	if err := Validate(ctx, p); err != nil {
+		return &DryRunReport{Error: err.Error()}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "yt-dlp-webui-pipeline-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	dry := *p
+	dry.Steps = dryRunSteps(p.Steps)
+
+	chain, err := Build(&dry, filepath.Join(dir, "dry-run"), "mkv")
+	if err != nil {
+		return &DryRunReport{Error: err.Error()}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	source := exec.CommandContext(ctx, config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "testsrc=duration=3:size=320x240:rate=25",
+		"-f", "lavfi", "-i", "sine=frequency=440:duration=3",
+		"-c:v", "mpeg4",
+		"-c:a", "aac",
+		"-shortest",
+		"-f", "matroska",
+		"pipe:1",
+	)
+
+	stdout, err := source.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := source.Start(); err != nil {
+		return nil, err
+	}
+
+	report := &DryRunReport{}
+
+	reader, err := chain.Connect(stdout)
+	if err != nil {
+		cancel()
+		source.Wait()
+		report.Error = err.Error()
+		report.Steps = chain.Status()
+		return report, nil
+	}
+
+	io.Copy(io.Discard, reader)
+
+	errs := []error{chain.Wait()}
+	if err := source.Wait(); err != nil {
+		errs = append(errs, errors.New("test source: "+err.Error()))
+	}
+
+	report.Steps = chain.Status()
+
+	for _, fw := range fileWriters(chain.Pipes()) {
+		out := probeOutput(ctx, fw.Path)
+		if out.Error != "" {
+			errs = append(errs, errors.New(out.File+": "+out.Error))
+		}
+		report.Outputs = append(report.Outputs, out)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		report.Error = err.Error()
+		return report, nil
+	}
+
+	report.Valid = true
+	return report, nil
+}
+
+// Copy of the steps writing in the directory of the base path.
+// Restream steps are left out, the test source must not reach a real ingest.
+func dryRunSteps(steps []Step) []Step {
+	steps = slices.DeleteFunc(slices.Clone(steps), func(s Step) bool {
+		return s.Type == StepRestream
+	})
+	for i := range steps {
+		steps[i].Path = ""
+		if len(steps[i].Branches) > 0 {
+			steps[i].Branches = slices.Clone(steps[i].Branches)
+			for j := range steps[i].Branches {
+				steps[i].Branches[j].Steps = dryRunSteps(steps[i].Branches[j].Steps)
+			}
+		}
+	}
+	return steps
+}
+
+func probeOutput(ctx context.Context, path string) DryRunOutput {
+	out := DryRunOutput{File: filepath.Base(path)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Size = info.Size()
+
+	probed, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+
+	out.Duration = probed.Duration
+	out.Streams = probed.Streams
+
+	if len(probed.Streams) == 0 {
+		out.Error = "no media streams found"
+	}
+
+	return out
+}
@@ -62,6 +62,11 @@ func (h *handler) SavePipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := Validate(r.Context(), &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	id, err := h.store.Save(req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -90,3 +95,26 @@ func (h *handler) DeletePipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (h *handler) ValidatePipeline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := chi.URLParam(r, "id")
+
+	p, err := h.store.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := DryRun(r.Context(), p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -3,6 +3,7 @@ package pipeline
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 
 	"github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
@@ -13,8 +14,18 @@ var bucket = []byte("pipelines")
 type Step struct {
 	Type       string   `json:"type"`                  // es. "transcoder", "filewriter"
 	FFmpegArgs []string `json:"ffmpeg_args,omitempty"` // args da passare a ffmpeg
+	Container  string   `json:"container,omitempty"`   // solo per transcoder, muxer ffmpeg (es. "mp4", "matroska")
+	VideoCodec string   `json:"video_codec,omitempty"` // solo per transcoder
+	AudioCodec string   `json:"audio_codec,omitempty"` // solo per transcoder
 	Path       string   `json:"path,omitempty"`        // solo per filewriter
 	Extension  string   `json:"extension,omitempty"`   // solo per filewriter
+	Branches   []Branch `json:"branches,omitempty"`    // solo per fanout, deve essere l'ultimo step
+	URL        string   `json:"url,omitempty"`         // solo per restream, ingest rtmp(s):// o srt://
+}
+
+type Branch struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
 }
 
 type Pipeline struct {
@@ -74,6 +85,27 @@ func (s *Store) Get(id string) (*Pipeline, error) {
 	return &p, nil
 }
 
+// Resolve the pipeline attached to a download request.
+// An empty id means that no pipeline has been requested.
+func (s *Store) Resolve(id string) (*Pipeline, error) {
+	if id == "" {
+		return nil, nil
+	}
+	return s.Get(id)
+}
+
+// Resolve the pipeline of a download started without a request, e.g. by a
+// schedule or a restore. A deleted pipeline is ignored with a warning, the
+// download is better than nothing.
+func (s *Store) ResolveOrNone(id string) *Pipeline {
+	p, err := s.Resolve(id)
+	if err != nil {
+		slog.Warn("pipeline not found, downloading without it", slog.String("id", id), slog.Any("err", err))
+		return nil
+	}
+	return p
+}
+
 func (s *Store) List() ([]Pipeline, error) {
 	var result []Pipeline
 
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/ffmpeg"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
+)
+
+// ffmpeg output options a transcoder step is allowed to use, mapped to
+// whether they take a value. Stream specifiers (-c:v, -b:a:0...) are matched
+// on the option name only. Anything able to add inputs or outputs is excluded.
+var allowedArgs = map[string]bool{
+	"-c":             true,
+	"-codec":         true,
+	"-b":             true,
+	"-q":             true,
+	"-qscale":        true,
+	"-crf":           true,
+	"-cq":            true,
+	"-qp":            true,
+	"-preset":        true,
+	"-tune":          true,
+	"-profile":       true,
+	"-level":         true,
+	"-pix_fmt":       true,
+	"-vf":            true,
+	"-af":            true,
+	"-filter":        true,
+	"-r":             true,
+	"-s":             true,
+	"-aspect":        true,
+	"-ar":            true,
+	"-ac":            true,
+	"-g":             true,
+	"-keyint_min":    true,
+	"-bf":            true,
+	"-maxrate":       true,
+	"-minrate":       true,
+	"-bufsize":       true,
+	"-map":           true,
+	"-metadata":      true,
+	"-disposition":   true,
+	"-movflags":      true,
+	"-threads":       true,
+	"-speed":         true,
+	"-deadline":      true,
+	"-cpu-used":      true,
+	"-row-mt":        true,
+	"-tile-columns":  true,
+	"-svtav1-params": true,
+	"-x264-params":   true,
+	"-x265-params":   true,
+	"-vn":            false,
+	"-an":            false,
+	"-sn":            false,
+	"-dn":            false,
+	"-shortest":      false,
+}
+
+// filters a transcoder step is allowed to use. It's an allowlist since many
+// filters read files of the host through their options (movie, subtitles,
+// drawtext, sendcmd, lut3d...) and new ones come with every ffmpeg release.
+var allowedFilters = map[string]bool{
+	"null":          true,
+	"anull":         true,
+	"copy":          true,
+	"scale":         true,
+	"zscale":        true,
+	"fps":           true,
+	"framerate":     true,
+	"format":        true,
+	"aformat":       true,
+	"crop":          true,
+	"pad":           true,
+	"tpad":          true,
+	"apad":          true,
+	"setsar":        true,
+	"setdar":        true,
+	"setpts":        true,
+	"asetpts":       true,
+	"transpose":     true,
+	"hflip":         true,
+	"vflip":         true,
+	"rotate":        true,
+	"yadif":         true,
+	"bwdif":         true,
+	"trim":          true,
+	"atrim":         true,
+	"fade":          true,
+	"afade":         true,
+	"eq":            true,
+	"hue":           true,
+	"colorspace":    true,
+	"tonemap":       true,
+	"unsharp":       true,
+	"hqdn3d":        true,
+	"nlmeans":       true,
+	"deband":        true,
+	"hwupload":      true,
+	"hwdownload":    true,
+	"volume":        true,
+	"aresample":     true,
+	"loudnorm":      true,
+	"dynaudnorm":    true,
+	"atempo":        true,
+	"pan":           true,
+	"channelmap":    true,
+	"highpass":      true,
+	"lowpass":       true,
+	"equalizer":     true,
+	"silenceremove": true,
+}
+
+func validateArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("unexpected ffmpeg argument %q", arg)
+		}
+
+		name, _, _ := strings.Cut(arg, ":")
+
+		takesValue, ok := allowedArgs[name]
+		if !ok {
+			return fmt.Errorf("ffmpeg option %s is not allowed", arg)
+		}
+		if !takesValue {
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return fmt.Errorf("ffmpeg option %s requires a value", arg)
+		}
+		i++
+
+		if name == "-vf" || name == "-af" || name == "-filter" {
+			if err := validateFilter(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check the filters of a graph against allowedFilters. The graph is split on
+// every separator, even the escaped or quoted ones: a filter option mistaken
+// for a filter is rejected, a filter can't be missed.
+func validateFilter(graph string) error {
+	for _, f := range strings.FieldsFunc(graph, func(r rune) bool { return r == ',' || r == ';' }) {
+		name := strings.TrimSpace(f)
+		// drop the input labels, e.g. [in]scale=...
+		for strings.HasPrefix(name, "[") {
+			_, name, _ = strings.Cut(name, "]")
+			name = strings.TrimSpace(name)
+		}
+		// the name ends at the options, the output labels or the instance
+		// name, e.g. scale@first=...
+		if i := strings.IndexAny(name, "=[@ \t\n"); i >= 0 {
+			name = name[:i]
+		}
+
+		if !allowedFilters[name] {
+			return fmt.Errorf("ffmpeg filter %q is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// Validate the steps of a pipeline. Containers and codecs of the transcoder
+// steps are checked against the encoders and muxers of the local ffmpeg.
+func Validate(ctx context.Context, p *Pipeline) error {
+	if len(p.Steps) == 0 {
+		return errors.New("a pipeline needs at least one step")
+	}
+
+	var caps *ffmpeg.Capabilities
+
+	return validateSteps(ctx, p.Steps, &caps)
+}
+
+// caps is queried only if a transcoder step is found
+func validateSteps(ctx context.Context, steps []Step, caps **ffmpeg.Capabilities) error {
+	for i, step := range steps {
+		switch step.Type {
+		case StepTranscoder:
+			if *caps == nil {
+				var err error
+				if *caps, err = ffmpeg.GetCapabilities(ctx); err != nil {
+					return fmt.Errorf("cannot query ffmpeg capabilities: %w", err)
+				}
+			}
+			if err := validateTranscoder(step, *caps); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+
+		case StepFileWriter:
+			if step.Path != "" {
+				if err := validatePath(step.Path); err != nil {
+					return fmt.Errorf("step %d: %w", i, err)
+				}
+			}
+
+		case StepRestream:
+			format, err := pipes.RestreamFormat(step.URL)
+			if err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+			if *caps == nil {
+				if *caps, err = ffmpeg.GetCapabilities(ctx); err != nil {
+					return fmt.Errorf("cannot query ffmpeg capabilities: %w", err)
+				}
+			}
+			if !(*caps).HasMuxer(format) {
+				return fmt.Errorf("step %d: container %s is not supported by ffmpeg", i, format)
+			}
+
+		case StepFanOut:
+			if i != len(steps)-1 {
+				return fmt.Errorf("step %d: fanout must be the last step", i)
+			}
+			if err := validateBranches(step.Branches); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+			for _, b := range step.Branches {
+				if err := validateSteps(ctx, b.Steps, caps); err != nil {
+					return fmt.Errorf("step %d, branch %s: %w", i, b.Name, err)
+				}
+			}
+
+		default:
+			return fmt.Errorf("step %d: unknown step type %q", i, step.Type)
+		}
+	}
+
+	return nil
+}
+
+func validateTranscoder(step Step, caps *ffmpeg.Capabilities) error {
+	if !caps.HasMuxer(step.container()) {
+		return fmt.Errorf("container %s is not supported by ffmpeg", step.container())
+	}
+
+	// copy is not an encoder but it's always available
+	if step.VideoCodec != "" && step.VideoCodec != "copy" && !caps.HasEncoder(step.VideoCodec, "video") {
+		return fmt.Errorf("video encoder %s is not supported by ffmpeg", step.VideoCodec)
+	}
+	if step.AudioCodec != "" && step.AudioCodec != "copy" && !caps.HasEncoder(step.AudioCodec, "audio") {
+		return fmt.Errorf("audio encoder %s is not supported by ffmpeg", step.AudioCodec)
+	}
+
+	return validateArgs(step.FFmpegArgs)
+}
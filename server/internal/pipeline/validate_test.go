@@ -0,0 +1,47 @@
+package pipeline
+
+import "testing"
+
+func TestValidateArgs(t *testing.T) {
+	valid := [][]string{
+		{"-crf", "30", "-preset", "8"},
+		{"-c:v", "libsvtav1", "-b:a:0", "128k", "-an"},
+		{"-vf", "scale=1280:-2,fps=30"},
+		{"-vf", "[in]scale@first=1280:-2[scaled];[scaled]hflip[out]"},
+		{"-af", "loudnorm=I=-16:TP=-1.5, aresample=48000"},
+		{"-filter:v", "yadif"},
+	}
+	for _, args := range valid {
+		if err := validateArgs(args); err != nil {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"-i", "/etc/passwd"},
+		{"-y"},
+		{"-crf"},
+		{"output.mp4"},
+		{"-vf", "movie=/etc/passwd"},
+		{"-vf", "[in]amovie=/etc/passwd[out]"},
+		{"-vf", "subtitles=/etc/passwd"},
+		{"-vf", "scale=1280:-2,subtitles=filename=/etc/passwd"},
+		{"-vf", "ass=/root/secret.ass"},
+		{"-vf", "drawtext=textfile=/etc/passwd"},
+		{"-vf", "sendcmd=f=/etc/passwd"},
+		{"-vf", "zmq"},
+		{"-vf", "lut3d=/etc/passwd"},
+		{"-vf", "lut1d=file=/etc/passwd"},
+		{"-vf", "haldclut"},
+		{"-af", "azmq"},
+		// escaped separators are split anyway
+		{"-vf", `scale=1280:-2\,movie=/etc/passwd`},
+		{"-filter:a", "[a] [b]  amovie=/etc/passwd"},
+		{"-vf", "scale@x=1280:-2;movie@y=/etc/passwd"},
+	}
+	for _, args := range invalid {
+		if err := validateArgs(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package pipes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+const (
+	fanOutChunkSize = 32 * 1024
+	// bytes buffered for each branch before it's considered slow
+	DefaultFanOutBuffer = 16 * 1024 * 1024
+	// how long the full branches can hold back the others before being dropped
+	DefaultFanOutStallTimeout = 30 * time.Second
+)
+
+var errBranchStalled = errors.New("branch stalled, dropped")
+
+type Branch struct {
+	Name  string
+	Chain *Chain
+
+	chunks *dropBuffer
+	pw     *io.PipeWriter
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	status string
+	err    error
+}
+
+// Splits the stream into named branches, each of them with its own chain.
+// Every branch has a bounded buffer: the stream goes at the pace of the
+// slowest branch, a branch whose buffer stays full for StallTimeout is
+// dropped and the others go on.
+// A FanOut is always the last pipe of a chain.
+type FanOut struct {
+	Branches []*Branch
+	// per branch, DefaultFanOutBuffer if 0
+	BufferSize   int
+	StallTimeout time.Duration
+
+	wg sync.WaitGroup
+}
+
+func NewFanOut(branches ...*Branch) *FanOut {
+	return &FanOut{Branches: branches}
+}
+
+func NewBranch(name string, chain *Chain) *Branch {
+	return &Branch{Name: name, Chain: chain}
+}
+
+func (f *FanOut) Name() string { return "fan-out" }
+
+func (f *FanOut) Connect(r io.Reader) (io.Reader, error) {
+	if len(f.Branches) == 0 {
+		return nil, errors.New("fan-out without branches")
+	}
+
+	bufferSize := f.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultFanOutBuffer
+	}
+
+	for _, b := range f.Branches {
+		pr, pw := io.Pipe()
+
+		tail, err := b.Chain.Connect(pr)
+		if err != nil {
+			pw.CloseWithError(err)
+			b.Chain.Wait()
+			b.set(StatusErrored, err)
+			f.abort()
+			return nil, fmt.Errorf("branch %s: %w", b.Name, err)
+		}
+
+		b.chunks = newDropBuffer(
+			max(bufferSize/fanOutChunkSize, 1),
+			"fan-out branch is falling behind",
+			slog.String("branch", b.Name),
+		)
+		b.pw = pw
+		b.done = make(chan struct{})
+		b.set(StatusRunning, nil)
+
+		f.wg.Add(1)
+		go b.write(tail, &f.wg)
+	}
+
+	go f.distribute(r)
+
+	// nothing is left for the next pipes
+	return bytes.NewReader(nil), nil
+}
+
+// Close the branches connected before a failed one
+func (f *FanOut) abort() {
+	for _, b := range f.Branches {
+		if b.pw == nil {
+			continue
+		}
+		b.pw.CloseWithError(errors.New("fan-out aborted"))
+		b.chunks.close()
+	}
+	f.wg.Wait()
+	for _, b := range f.Branches {
+		if b.pw != nil {
+			b.Chain.Wait()
+		}
+	}
+}
+
+func (f *FanOut) distribute(r io.Reader) {
+	timeout := f.StallTimeout
+	if timeout <= 0 {
+		timeout = DefaultFanOutStallTimeout
+	}
+
+	active := make([]*Branch, len(f.Branches))
+	copy(active, f.Branches)
+
+	drop := func(b *Branch, err error) {
+		slog.Warn("fan-out branch dropped", slog.String("branch", b.Name), slog.Any("err", err))
+		b.set(StatusErrored, err)
+		b.chunks.close()
+		// unblocks a writer stuck on a slow consumer
+		b.pw.CloseWithError(err)
+	}
+
+	var readErr error
+
+	for len(active) > 0 {
+		buf := make([]byte, fanOutChunkSize)
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			// branches only read the chunk, it can be shared
+			chunk := buf[:n]
+
+			var full []*Branch
+
+			active = slices.DeleteFunc(active, func(b *Branch) bool {
+				queued, err := b.queue(chunk)
+				if err != nil {
+					drop(b, err)
+					return true
+				}
+				if !queued {
+					full = append(full, b)
+				}
+				return false
+			})
+
+			// the full branches are waited together, a stalled one holds
+			// back the others for a single timeout
+			if len(full) > 0 {
+				expired := make(chan struct{})
+				timer := time.AfterFunc(timeout, func() { close(expired) })
+
+				for _, b := range full {
+					if err := b.wait(chunk, expired); err != nil {
+						drop(b, err)
+						active = slices.DeleteFunc(active, func(a *Branch) bool { return a == b })
+					}
+				}
+
+				timer.Stop()
+			}
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = err
+			}
+			break
+		}
+	}
+
+	for _, b := range active {
+		b.chunks.close()
+		if readErr != nil {
+			b.pw.CloseWithError(readErr)
+		}
+	}
+
+	if len(active) == 0 {
+		// keep consuming, a stuck fan-out would stall the upstream pipes
+		io.Copy(io.Discard, r)
+	}
+}
+
+// Queue a chunk for the branch without blocking, returns false if its
+// buffer is full and an error if the branch failed.
+func (b *Branch) queue(chunk []byte) (bool, error) {
+	select {
+	case <-b.done:
+		return false, b.failure()
+	default:
+	}
+
+	return b.chunks.push(chunk), nil
+}
+
+// Queue a chunk for the branch, waiting for room in its buffer until
+// expired is closed.
+func (b *Branch) wait(chunk []byte, expired <-chan struct{}) error {
+	select {
+	case <-b.done:
+		return b.failure()
+	default:
+	}
+
+	if !b.chunks.wait(chunk, expired) {
+		return errBranchStalled
+	}
+	return nil
+}
+
+func (b *Branch) write(tail io.Reader, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// the tail of each branch must be drained for its pipes to complete
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		io.Copy(io.Discard, tail)
+	}()
+
+	var err error
+	for chunk := range b.chunks.C {
+		if err != nil {
+			continue
+		}
+		if _, err = b.pw.Write(chunk); err != nil {
+			b.setFailure(err)
+			close(b.done)
+		}
+	}
+
+	if err == nil {
+		b.pw.Close()
+	}
+	<-drained
+}
+
+func (f *FanOut) Wait() error {
+	f.wg.Wait()
+
+	var errs []error
+
+	for _, b := range f.Branches {
+		err := b.Chain.Wait()
+
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		if b.err != nil {
+			b.status = StatusErrored
+			errs = append(errs, fmt.Errorf("branch %s: %w", b.Name, b.err))
+		} else {
+			b.status = StatusCompleted
+		}
+		b.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *FanOut) Outputs() []string {
+	var paths []string
+	for _, b := range f.Branches {
+		paths = append(paths, b.Chain.Outputs()...)
+	}
+	return paths
+}
+
+func (f *FanOut) BranchStatus() []internal.BranchStatus {
+	status := make([]internal.BranchStatus, len(f.Branches))
+
+	for i, b := range f.Branches {
+		b.mu.RLock()
+		status[i] = internal.BranchStatus{
+			Name:   b.Name,
+			Status: b.status,
+			Steps:  b.Chain.Status(),
+		}
+		if status[i].Status == "" {
+			status[i].Status = StatusPending
+		}
+		if b.err != nil {
+			status[i].Error = b.err.Error()
+		}
+		b.mu.RUnlock()
+	}
+
+	return status
+}
+
+func (b *Branch) set(status string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.status = status
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Branch) setFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Branch) failure() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.err
+}
@@ -1,45 +1,68 @@
 package pipes
 
 import (
+	"bytes"
 	"io"
 	"log/slog"
 	"os"
+	"sync"
 )
 
 type FileWriter struct {
 	Path    string
 	IsFinal bool
+
+	wg  sync.WaitGroup
+	err error
 }
 
 func (f *FileWriter) Name() string { return "file-writer" }
 
+func (f *FileWriter) Outputs() []string { return []string{f.Path} }
+
 func (f *FileWriter) Connect(r io.Reader) (io.Reader, error) {
 	file, err := os.Create(f.Path)
 	if err != nil {
 		return nil, err
 	}
 
+	f.wg.Add(1)
+
 	if f.IsFinal {
 		go func() {
+			defer f.wg.Done()
 			defer file.Close()
 			if _, err := io.Copy(file, r); err != nil {
 				slog.Error("FileWriter (final) error", slog.Any("err", err))
+				f.err = err
+				// keep consuming, a stuck writer would stall the upstream pipes
+				io.Copy(io.Discard, r)
 			}
 		}()
-		return r, nil
+		// nothing is left for the next pipes
+		return bytes.NewReader(nil), nil
 	}
 
 	pr, pw := io.Pipe()
 
 	go func() {
+		defer f.wg.Done()
 		defer file.Close()
 		defer pw.Close()
 
 		writer := io.MultiWriter(file, pw)
 		if _, err := io.Copy(writer, r); err != nil {
 			slog.Error("FileWriter (pipeline) error", slog.Any("err", err))
+			f.err = err
+			pw.CloseWithError(err)
+			io.Copy(io.Discard, r)
 		}
 	}()
 
 	return pr, nil
 }
+
+func (f *FileWriter) Wait() error {
+	f.wg.Wait()
+	return f.err
+}
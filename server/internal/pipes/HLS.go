@@ -0,0 +1,188 @@
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+const HLSPlaylist = "index.m3u8"
+
+// Directory holding the playlist and the segments of a job
+func HLSDir(id string) string {
+	return filepath.Join(os.TempDir(), "yt-dlp-webui", "hls", id)
+}
+
+// Remux the stream into a rolling HLS playlist while passing it through
+// unchanged. Only the last Window seconds are kept on disk, the directory is
+// removed once the stream ends.
+// A failing ffmpeg doesn't affect the stream: the preview is simply stopped.
+// If the preview can't be started at all the stream is returned as is.
+type HLS struct {
+	Dir string
+	// seconds kept in the playlist
+	Window          int
+	SegmentDuration int
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func NewHLS(id string) *HLS {
+	return &HLS{
+		Dir:             HLSDir(id),
+		Window:          config.Instance().HLS.Window,
+		SegmentDuration: config.Instance().HLS.SegmentDuration,
+	}
+}
+
+func (h *HLS) Name() string { return "hls" }
+
+func (h *HLS) Connect(r io.Reader) (io.Reader, error) {
+	if err := os.MkdirAll(h.Dir, os.ModePerm); err != nil {
+		slog.Error("hls preview disabled", slog.Any("err", err))
+		return r, nil
+	}
+
+	segment := max(h.SegmentDuration, 1)
+	size := max(h.Window/segment, 1)
+
+	cmd := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-i", "pipe:0",
+		"-c", "copy",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segment),
+		"-hls_list_size", strconv.Itoa(size),
+		"-hls_flags", "delete_segments+independent_segments",
+		"-hls_segment_type", "fmp4",
+		"-hls_segment_filename", filepath.Join(h.Dir, "segment%06d.m4s"),
+		filepath.Join(h.Dir, HLSPlaylist),
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		slog.Error("hls preview disabled", slog.Any("err", err))
+		os.RemoveAll(h.Dir)
+		return r, nil
+	}
+
+	h.cmd = cmd
+	h.done = make(chan struct{})
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			slog.Warn("ffmpeg hls", slog.String("log", scanner.Text()))
+		}
+	}()
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer close(h.done)
+		defer pw.Close()
+
+		preview := newDropWriter(stdin, hlsBufferChunks)
+		defer preview.Close()
+
+		if _, err := io.Copy(io.MultiWriter(pw, preview), r); err != nil {
+			slog.Error("hls pass-through error", slog.Any("err", err))
+			pw.CloseWithError(err)
+			io.Copy(io.Discard, r)
+		}
+	}()
+
+	return pr, nil
+}
+
+func (h *HLS) Wait() error {
+	if h.cmd == nil {
+		return nil
+	}
+
+	<-h.done
+	err := h.cmd.Wait()
+
+	if rmErr := os.RemoveAll(h.Dir); rmErr != nil {
+		slog.Error("failed to remove hls segments", slog.String("dir", h.Dir), slog.Any("err", rmErr))
+	}
+
+	if err != nil {
+		return fmt.Errorf("hls preview: %w", err)
+	}
+	return nil
+}
+
+// chunks of the stream buffered for the preview ffmpeg
+const hlsBufferChunks = 256
+
+// Writes to w in its own goroutine through a bounded buffer. The chunks
+// are dropped while the buffer is full and once w fails: the stream it's
+// copied from is never held back nor errored by w.
+type dropWriter struct {
+	w      io.WriteCloser
+	chunks *dropBuffer
+	done   chan struct{}
+	closed atomic.Bool
+}
+
+func newDropWriter(w io.WriteCloser, size int) *dropWriter {
+	d := &dropWriter{
+		w:      w,
+		chunks: newDropBuffer(size, "hls preview is falling behind, dropping data"),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(d.done)
+
+		var failed bool
+		for chunk := range d.chunks.C {
+			if failed {
+				continue
+			}
+			if _, err := d.w.Write(chunk); err != nil {
+				if !d.closed.Load() {
+					slog.Warn("hls preview stopped", slog.Any("err", err))
+				}
+				failed = true
+			}
+		}
+	}()
+
+	return d
+}
+
+func (d *dropWriter) Write(p []byte) (int, error) {
+	// the caller may reuse p
+	d.chunks.push(bytes.Clone(p))
+	return len(p), nil
+}
+
+// Close w, the chunks still buffered are dropped. A w stuck on a slow
+// reader is unblocked.
+func (d *dropWriter) Close() error {
+	d.closed.Store(true)
+	d.chunks.close()
+	err := d.w.Close()
+	<-d.done
+	return err
+}
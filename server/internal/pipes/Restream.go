@@ -0,0 +1,392 @@
+package pipes
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+const (
+	HealthConnecting   = "connecting"
+	HealthConnected    = "connected"
+	HealthReconnecting = "reconnecting"
+	HealthStopped      = "stopped"
+)
+
+const (
+	DefaultRestreamMinBackoff = time.Second
+	DefaultRestreamMaxBackoff = 30 * time.Second
+	restreamChunkSize         = 32 * 1024
+	// chunks, ~8MiB of slack before the restream starts losing data
+	restreamBuffer = 256
+)
+
+// Push the stream to an RTMP or SRT ingest while passing it through unchanged.
+// The restream never holds back the stream: if the ingest is too slow or
+// unreachable the data is dropped and ffmpeg is restarted with an exponential
+// backoff until the stream ends.
+// The stream is remuxed to mpegts before being pushed, whatever its container:
+// a restarted ffmpeg can only join an mpegts stream halfway.
+type Restream struct {
+	URL        string
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// input stream, fed to the remuxer
+	raw *dropBuffer
+	// remuxed stream, fed to the ingest
+	chunks    *dropBuffer
+	passDone  chan struct{}
+	remuxDone chan struct{}
+	done      chan struct{}
+	remuxErr  error
+	err       error
+
+	mu     sync.RWMutex
+	health internal.PipeHealth
+}
+
+func (r *Restream) Name() string { return "restream" }
+
+// Muxer expected by the ingest protocol
+func RestreamFormat(ingest string) (string, error) {
+	u, err := url.Parse(ingest)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "rtmp", "rtmps":
+		return "flv", nil
+	case "srt":
+		return "mpegts", nil
+	default:
+		return "", fmt.Errorf("unsupported restream protocol %q", u.Scheme)
+	}
+}
+
+func (r *Restream) Connect(src io.Reader) (io.Reader, error) {
+	format, err := RestreamFormat(r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.MinBackoff <= 0 {
+		r.MinBackoff = DefaultRestreamMinBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = DefaultRestreamMaxBackoff
+	}
+
+	remux := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-nostats",
+		"-i", "pipe:0",
+		"-c", "copy",
+		"-f", "mpegts",
+		"pipe:1",
+	)
+
+	stdin, err := remux.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := remux.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	remux.Stderr = &stderr
+
+	if err := remux.Start(); err != nil {
+		return nil, err
+	}
+
+	r.raw = newDropBuffer(restreamBuffer, "restream remuxer is falling behind, dropping data", slog.String("url", r.URL))
+	r.chunks = newDropBuffer(restreamBuffer, "restream is falling behind, dropping data", slog.String("url", r.URL))
+	r.passDone = make(chan struct{})
+	r.remuxDone = make(chan struct{})
+	r.done = make(chan struct{})
+	r.setHealth(HealthConnecting, nil)
+
+	pr, pw := io.Pipe()
+
+	go r.passThrough(src, pw)
+	go r.feed(stdin)
+	go func() {
+		defer close(r.remuxDone)
+
+		r.remuxed(stdout)
+
+		if err := remux.Wait(); err != nil {
+			if log := strings.TrimSpace(stderr.String()); log != "" {
+				err = fmt.Errorf("%w: %s", err, log)
+			}
+			r.remuxErr = fmt.Errorf("remuxer: %w", err)
+		}
+	}()
+	go r.supervise(format)
+
+	return pr, nil
+}
+
+func (r *Restream) passThrough(src io.Reader, pw *io.PipeWriter) {
+	defer close(r.passDone)
+	defer r.raw.close()
+
+	downstream := true
+
+	for {
+		buf := make([]byte, restreamChunkSize)
+		n, err := src.Read(buf)
+
+		if n > 0 {
+			if downstream {
+				if _, werr := pw.Write(buf[:n]); werr != nil {
+					slog.Error("restream pass-through error", slog.Any("err", werr))
+					pw.CloseWithError(werr)
+					downstream = false
+				}
+			}
+
+			// the stream is never held back, what the remuxer can't keep up
+			// with is dropped as for the ingest
+			r.raw.push(buf[:n])
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				pw.CloseWithError(err)
+			}
+			pw.Close()
+			return
+		}
+	}
+}
+
+// Write the input stream to the remuxer
+func (r *Restream) feed(stdin io.WriteCloser) {
+	defer stdin.Close()
+
+	var err error
+	for chunk := range r.raw.C {
+		if err != nil {
+			continue
+		}
+		if _, err = stdin.Write(chunk); err != nil {
+			slog.Error("restream remuxer error", slog.Any("err", err))
+		}
+	}
+}
+
+// Queue the remuxed stream for the ingest, it's dropped if the ingest can't
+// keep up. The remuxer is never held back.
+func (r *Restream) remuxed(stdout io.Reader) {
+	defer r.chunks.close()
+
+	for {
+		buf := make([]byte, restreamChunkSize)
+		n, err := stdout.Read(buf)
+
+		if n > 0 {
+			r.chunks.push(buf[:n])
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *Restream) supervise(format string) {
+	defer close(r.done)
+
+	backoff := r.MinBackoff
+
+	for {
+		started := time.Now()
+
+		finished, err := r.push(format)
+		r.err = err
+
+		if finished {
+			r.setHealth(HealthStopped, err)
+			return
+		}
+
+		r.mu.Lock()
+		r.health.Reconnects++
+		r.mu.Unlock()
+		r.setHealth(HealthReconnecting, err)
+
+		slog.Warn("restream disconnected",
+			slog.String("url", r.URL),
+			slog.Duration("backoff", backoff),
+			slog.Any("err", err),
+		)
+
+		// a connection which lasted long enough resets the backoff
+		if time.Since(started) > r.MaxBackoff {
+			backoff = r.MinBackoff
+		}
+
+		if !r.sleep(backoff) {
+			r.setHealth(HealthStopped, err)
+			return
+		}
+
+		backoff = min(backoff*2, r.MaxBackoff)
+	}
+}
+
+// Discard the stream for d, returns false if the stream ended meanwhile
+func (r *Restream) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case _, ok := <-r.chunks.C:
+			if !ok {
+				return false
+			}
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// Run ffmpeg until it fails or the stream ends, finished is true in the latter case
+func (r *Restream) push(format string) (finished bool, err error) {
+	r.setHealth(HealthConnecting, nil)
+
+	cmd := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error", "-nostats",
+		"-f", "mpegts",
+		"-i", "pipe:0",
+		"-c", "copy",
+		"-f", format,
+		"-progress", "pipe:1",
+		r.URL,
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return false, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+
+	// progress is reported only once the output has been opened
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "progress=") && r.Health().State == HealthConnecting {
+				r.setHealth(HealthConnected, nil)
+			}
+		}
+	}()
+
+	var lastLog string
+	logDone := make(chan struct{})
+	go func() {
+		defer close(logDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			lastLog = scanner.Text()
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		<-logDone
+		err = cmd.Wait()
+		close(exited)
+	}()
+
+	wrapped := func() error {
+		if err != nil && lastLog != "" {
+			return fmt.Errorf("%w: %s", err, lastLog)
+		}
+		return err
+	}
+
+	for {
+		select {
+		case chunk, ok := <-r.chunks.C:
+			if !ok {
+				stdin.Close()
+				<-exited
+				return true, wrapped()
+			}
+			if _, werr := stdin.Write(chunk); werr != nil {
+				cmd.Process.Kill()
+				<-exited
+				if err == nil {
+					err = werr
+				}
+				return false, wrapped()
+			}
+		case <-exited:
+			if err == nil {
+				err = errors.New("ffmpeg exited before the end of the stream")
+			}
+			return false, wrapped()
+		}
+	}
+}
+
+func (r *Restream) Wait() error {
+	if r.done == nil {
+		return nil
+	}
+
+	<-r.passDone
+	<-r.remuxDone
+	<-r.done
+
+	if err := errors.Join(r.remuxErr, r.err); err != nil {
+		return fmt.Errorf("restream: %w", err)
+	}
+	return nil
+}
+
+func (r *Restream) Health() internal.PipeHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.health
+}
+
+func (r *Restream) setHealth(state string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.health.State != state {
+		r.health.State = state
+		r.health.Since = time.Now()
+	}
+	if err != nil {
+		r.health.LastError = err.Error()
+	}
+}
@@ -3,22 +3,31 @@ package pipes
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os/exec"
 	"strings"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 )
 
 type Transcoder struct {
-	Args []string
+	// ffmpeg muxer of the output stream, webm if empty
+	Format     string
+	VideoCodec string
+	AudioCodec string
+	Args       []string
+
+	cmd     *exec.Cmd
+	lastLog string
+	logDone chan struct{}
 }
 
 func (t *Transcoder) Name() string { return "ffmpeg-transcoder" }
 
 func (t *Transcoder) Connect(r io.Reader) (io.Reader, error) {
-	cmd := exec.Command("ffmpeg",
-		append([]string{"-i", "pipe:0"}, append(t.Args, "-f", "webm", "pipe:1")...)...,
-	)
+	cmd := exec.Command(config.Instance().Paths.FFmpegPath, t.params()...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -33,7 +42,11 @@ func (t *Transcoder) Connect(r io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
+	t.logDone = make(chan struct{})
+
 	go func() {
+		defer close(t.logDone)
+
 		reader := bufio.NewReader(stderr)
 		var line string
 
@@ -46,8 +59,13 @@ func (t *Transcoder) Connect(r io.Reader) (io.Reader, error) {
 
 			line = strings.TrimRight(line, "\r\n")
 			slog.Info("ffmpeg transcoder", slog.String("log", line))
+			t.lastLog = line
 			line = ""
 		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			t.lastLog = line
+		}
 	}()
 
 	go func() {
@@ -55,6 +73,8 @@ func (t *Transcoder) Connect(r io.Reader) (io.Reader, error) {
 		_, err := io.Copy(stdin, r)
 		if err != nil && !errors.Is(err, io.EOF) {
 			slog.Error("transcoder stdin error", slog.Any("err", err))
+			// keep consuming, a stuck transcoder would stall the upstream pipes
+			io.Copy(io.Discard, r)
 		}
 	}()
 
@@ -62,5 +82,51 @@ func (t *Transcoder) Connect(r io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
+	t.cmd = cmd
+
 	return stdout, nil
 }
+
+func (t *Transcoder) Wait() error {
+	if t.cmd == nil {
+		return nil
+	}
+
+	<-t.logDone
+
+	if err := t.cmd.Wait(); err != nil {
+		if t.lastLog != "" {
+			return fmt.Errorf("%w: %s", err, t.lastLog)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (t *Transcoder) params() []string {
+	format := t.Format
+	if format == "" {
+		format = "webm"
+	}
+
+	params := []string{"-i", "pipe:0"}
+
+	if t.VideoCodec != "" {
+		params = append(params, "-c:v", t.VideoCodec)
+	}
+	if t.AudioCodec != "" {
+		params = append(params, "-c:a", t.AudioCodec)
+	}
+
+	params = append(params, t.Args...)
+
+	// the mp4 family needs to seek back to write the moov atom,
+	// which isn't possible on a pipe unless the output is fragmented
+	switch format {
+	case "mp4", "mov", "ipod":
+		params = append(params, "-movflags", "frag_keyframe+empty_moov")
+	}
+
+	return append(params, "-f", format, "pipe:1")
+}
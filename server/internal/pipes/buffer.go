@@ -0,0 +1,55 @@
+package pipes
+
+import "log/slog"
+
+// Bounded buffer of chunks between a stream that must not be held back and
+// a slower consumer ranging over C. While the buffer is full the chunks are
+// dropped, only the first of each streak is logged.
+type dropBuffer struct {
+	C chan []byte
+
+	msg   string
+	attrs []any
+	// the buffer has been found full, used to log only once
+	behind bool
+}
+
+// msg and attrs are logged when the buffer starts dropping chunks
+func newDropBuffer(size int, msg string, attrs ...any) *dropBuffer {
+	return &dropBuffer{
+		C:     make(chan []byte, size),
+		msg:   msg,
+		attrs: attrs,
+	}
+}
+
+// Queue chunk without blocking, returns false if it's been dropped
+func (d *dropBuffer) push(chunk []byte) bool {
+	select {
+	case d.C <- chunk:
+		d.behind = false
+		return true
+	default:
+	}
+
+	if !d.behind {
+		slog.Warn(d.msg, d.attrs...)
+		d.behind = true
+	}
+	return false
+}
+
+// Queue chunk waiting for room until expired is closed, returns false if
+// it's been dropped
+func (d *dropBuffer) wait(chunk []byte, expired <-chan struct{}) bool {
+	select {
+	case d.C <- chunk:
+		return true
+	case <-expired:
+		// the room could have been made right when it expired
+		return d.push(chunk)
+	}
+}
+
+// No more chunks are pushed, the consumer ends once C is drained
+func (d *dropBuffer) close() { close(d.C) }
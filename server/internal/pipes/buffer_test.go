@@ -0,0 +1,36 @@
+package pipes
+
+import "testing"
+
+func TestDropBuffer(t *testing.T) {
+	d := newDropBuffer(2, "test buffer is full")
+
+	for i, want := range []bool{true, true, false, false} {
+		if got := d.push([]byte{byte(i)}); got != want {
+			t.Errorf("push %d: queued %v, want %v", i, got, want)
+		}
+	}
+
+	// nobody reads, the wait expires
+	expired := make(chan struct{})
+	close(expired)
+	if d.wait([]byte{4}, expired) {
+		t.Error("queued in a full buffer")
+	}
+
+	// room is made while waiting
+	go func() { <-d.C }()
+	if !d.wait([]byte{5}, make(chan struct{})) {
+		t.Error("dropped while there was room")
+	}
+
+	d.close()
+
+	var got []byte
+	for chunk := range d.C {
+		got = append(got, chunk...)
+	}
+	if string(got) != "\x01\x05" {
+		t.Errorf("got chunks %v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package pipes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusErrored   = "errored"
+)
+
+// Implemented by the pipes splitting the stream, e.g. FanOut
+type branched interface {
+	BranchStatus() []internal.BranchStatus
+}
+
+// Implemented by the pipes pushing the stream to a remote endpoint
+type monitored interface {
+	Health() internal.PipeHealth
+}
+
+// Implemented by the pipes writing files, e.g. FileWriter
+type written interface {
+	Outputs() []string
+}
+
+// Connects a sequence of pipes and keeps track of the state of each of them.
+// A Chain is a Pipe itself.
+type Chain struct {
+	pipes  []Pipe
+	status []internal.PipeStatus
+	mu     sync.RWMutex
+}
+
+func NewChain(pipes ...Pipe) *Chain {
+	status := make([]internal.PipeStatus, len(pipes))
+	for i, p := range pipes {
+		status[i] = internal.PipeStatus{Name: p.Name(), Status: StatusPending}
+	}
+
+	return &Chain{
+		pipes:  pipes,
+		status: status,
+	}
+}
+
+func (c *Chain) Name() string { return "chain" }
+
+func (c *Chain) Pipes() []Pipe { return c.pipes }
+
+// Paths of the files written by the pipes, branches included
+func (c *Chain) Outputs() []string {
+	var paths []string
+	for _, p := range c.pipes {
+		if w, ok := p.(written); ok {
+			paths = append(paths, w.Outputs()...)
+		}
+	}
+	return paths
+}
+
+func (c *Chain) Connect(r io.Reader) (io.Reader, error) {
+	for i, pipe := range c.pipes {
+		nr, err := pipe.Connect(r)
+		if err != nil {
+			c.set(i, StatusErrored, err)
+			return nil, fmt.Errorf("%s: %w", pipe.Name(), err)
+		}
+		c.set(i, StatusRunning, nil)
+		r = nr
+	}
+	return r, nil
+}
+
+// Pipes are waited from the last to the first: once a pipe is done its
+// input has been entirely consumed and the upstream one can be released.
+func (c *Chain) Wait() error {
+	var errs []error
+
+	for i := len(c.pipes) - 1; i >= 0; i-- {
+		if c.get(i) != StatusRunning {
+			continue
+		}
+		if err := c.pipes[i].Wait(); err != nil {
+			c.set(i, StatusErrored, err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.pipes[i].Name(), err))
+			continue
+		}
+		c.set(i, StatusCompleted, nil)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Chain) Status() []internal.PipeStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := make([]internal.PipeStatus, len(c.status))
+	copy(status, c.status)
+
+	for i, p := range c.pipes {
+		if b, ok := p.(branched); ok {
+			status[i].Branches = b.BranchStatus()
+		}
+		if m, ok := p.(monitored); ok {
+			health := m.Health()
+			status[i].Health = &health
+		}
+	}
+
+	return status
+}
+
+func (c *Chain) get(i int) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status[i].Status
+}
+
+func (c *Chain) set(i int, status string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status[i].Status = status
+	if err != nil {
+		c.status[i].Error = err.Error()
+	}
+}
@@ -0,0 +1,212 @@
+package pipes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Last pipe of a branch, its input is consumed by consume
+type testSink struct {
+	consume func(r io.Reader) error
+	done    chan error
+}
+
+func newTestSink(consume func(r io.Reader) error) *testSink {
+	return &testSink{consume: consume, done: make(chan error, 1)}
+}
+
+func (s *testSink) Name() string { return "test-sink" }
+
+func (s *testSink) Connect(r io.Reader) (io.Reader, error) {
+	go func() { s.done <- s.consume(r) }()
+	return bytes.NewReader(nil), nil
+}
+
+func (s *testSink) Wait() error { return <-s.done }
+
+// Collects its whole input into received
+func collect(received *bytes.Buffer) func(r io.Reader) error {
+	return func(r io.Reader) error {
+		_, err := io.Copy(received, r)
+		return err
+	}
+}
+
+func randomData(t *testing.T, chunks int) []byte {
+	data := make([]byte, chunks*fanOutChunkSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func runFanOut(t *testing.T, f *FanOut, data []byte) error {
+	out, err := f.Connect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, out)
+	return f.Wait()
+}
+
+func TestFanOutBackpressure(t *testing.T) {
+	data := randomData(t, 32)
+
+	var fast, slow bytes.Buffer
+
+	f := NewFanOut(
+		NewBranch("fast", NewChain(newTestSink(collect(&fast)))),
+		NewBranch("slow", NewChain(newTestSink(func(r io.Reader) error {
+			buf := make([]byte, fanOutChunkSize)
+			for {
+				n, err := r.Read(buf)
+				slow.Write(buf[:n])
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}))),
+	)
+	// the slow branch is always full but keeps going, it's never stalled
+	f.BufferSize = fanOutChunkSize
+	f.StallTimeout = time.Second
+
+	if err := runFanOut(t, f, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fast.Bytes(), data) || !bytes.Equal(slow.Bytes(), data) {
+		t.Errorf("branches received %d and %d bytes, want %d", fast.Len(), slow.Len(), len(data))
+	}
+	for _, b := range f.BranchStatus() {
+		if b.Status != StatusCompleted {
+			t.Errorf("branch %s: status %s", b.Name, b.Status)
+		}
+	}
+}
+
+func TestFanOutDropsStalledBranches(t *testing.T) {
+	const timeout = 500 * time.Millisecond
+
+	data := randomData(t, 32)
+
+	var (
+		received bytes.Buffer
+		finished = make(chan time.Time, 1)
+		release  = make(chan struct{})
+	)
+
+	// never reads until released
+	stalled := func() *Branch {
+		return NewBranch("stalled", NewChain(newTestSink(func(r io.Reader) error {
+			<-release
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})))
+	}
+
+	f := NewFanOut(
+		stalled(),
+		stalled(),
+		stalled(),
+		NewBranch("fast", NewChain(newTestSink(func(r io.Reader) error {
+			defer func() { finished <- time.Now() }()
+			return collect(&received)(r)
+		}))),
+	)
+	f.BufferSize = fanOutChunkSize
+	f.StallTimeout = timeout
+
+	start := time.Now()
+
+	out, err := f.Connect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, out)
+
+	// the stalled branches are waited together
+	if elapsed := (<-finished).Sub(start); elapsed > 2*timeout {
+		t.Errorf("the fast branch was held back for %v", elapsed)
+	}
+
+	close(release)
+
+	err = f.Wait()
+	if !errors.Is(err, errBranchStalled) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if !bytes.Equal(received.Bytes(), data) {
+		t.Errorf("the fast branch received %d bytes, want %d", received.Len(), len(data))
+	}
+
+	for _, b := range f.BranchStatus() {
+		want := StatusErrored
+		if b.Name == "fast" {
+			want = StatusCompleted
+		}
+		if b.Status != want {
+			t.Errorf("branch %s: status %s, want %s", b.Name, b.Status, want)
+		}
+	}
+}
+
+func TestFanOutBranchErrors(t *testing.T) {
+	data := randomData(t, 16)
+
+	var received bytes.Buffer
+
+	f := NewFanOut(
+		// fails once done, its input is consumed anyway
+		NewBranch("failing", NewChain(newTestSink(func(r io.Reader) error {
+			io.Copy(io.Discard, r)
+			return errors.New("encoder failed")
+		}))),
+		// stops reading halfway
+		NewBranch("closed", NewChain(newTestSink(func(r io.Reader) error {
+			io.CopyN(io.Discard, r, int64(len(data)/2))
+			err := errors.New("connection reset")
+			r.(*io.PipeReader).CloseWithError(err)
+			return err
+		}))),
+		NewBranch("ok", NewChain(newTestSink(collect(&received)))),
+	)
+	f.BufferSize = fanOutChunkSize
+
+	err := runFanOut(t, f, data)
+	if err == nil {
+		t.Fatal("expected the branch errors")
+	}
+	for _, msg := range []string{"encoder failed", "connection reset"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q missing from %v", msg, err)
+		}
+	}
+
+	if !bytes.Equal(received.Bytes(), data) {
+		t.Errorf("the ok branch received %d bytes, want %d", received.Len(), len(data))
+	}
+
+	for _, b := range f.BranchStatus() {
+		want := StatusErrored
+		if b.Name == "ok" {
+			want = StatusCompleted
+		}
+		if b.Status != want {
+			t.Errorf("branch %s: status %s, want %s", b.Name, b.Status, want)
+		}
+		if want == StatusErrored && b.Error == "" {
+			t.Errorf("branch %s: no error reported", b.Name)
+		}
+	}
+}
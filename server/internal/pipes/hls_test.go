@@ -0,0 +1,49 @@
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDropWriter(t *testing.T) {
+	// a preview that never reads
+	_, stuck := io.Pipe()
+
+	d := newDropWriter(stuck, 4)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			if n, err := d.Write(make([]byte, 1024)); n != 1024 || err != nil {
+				t.Errorf("write returned %d, %v", n, err)
+			}
+		}
+		d.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the writer has been held back by the preview")
+	}
+
+	// the chunks are copied, the caller reuses its buffer
+	pr, pw := io.Pipe()
+	d = newDropWriter(pw, 4)
+
+	buf := []byte("first")
+	d.Write(buf)
+	copy(buf, "xxxxx")
+
+	got := make([]byte, 5)
+	if _, err := io.ReadFull(pr, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte("first")) {
+		t.Errorf("got %q", got)
+	}
+	d.Close()
+}
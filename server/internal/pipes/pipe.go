@@ -5,4 +5,7 @@ import "io"
 type Pipe interface {
 	Name() string
 	Connect(r io.Reader) (io.Reader, error)
+	// Blocks until the pipe has processed its whole input.
+	// Must be called once the reader returned by Connect has been consumed.
+	Wait() error
 }
@@ -0,0 +1,219 @@
+package pipes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+func setupRestreamTest(t *testing.T) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg not found")
+	}
+	config.Instance().Paths.FFmpegPath = ffmpeg
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// A few seconds of video in a codec flv can carry without transcoding
+func testSource(t *testing.T) []byte {
+	out, err := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "testsrc=duration=3:size=160x120:rate=25",
+		"-c:v", "flv",
+		"-f", "nut",
+		"pipe:1",
+	).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRestreamToIngest(t *testing.T) {
+	setupRestreamTest(t)
+
+	var (
+		source = testSource(t)
+		ingest = fmt.Sprintf("rtmp://127.0.0.1:%d/live/test", freePort(t))
+	)
+
+	listener := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-listen", "1",
+		"-f", "flv",
+		"-i", ingest,
+		"-c", "copy",
+		"-f", "null", "-",
+	)
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Process.Kill()
+
+	// give the listener time to bind, the data sent while reconnecting
+	// would be lost and the ingest would miss the stream header
+	time.Sleep(time.Second)
+
+	r := &Restream{URL: ingest}
+
+	out, err := r.Connect(newSlowReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passed, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(passed, source) {
+		t.Fatal("the stream has been altered by the restream")
+	}
+
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- listener.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ingest failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ingest did not receive the end of the stream")
+	}
+
+	if h := r.Health(); h.State != HealthStopped {
+		t.Fatalf("unexpected final state %s", h.State)
+	}
+}
+
+func TestRestreamReconnects(t *testing.T) {
+	setupRestreamTest(t)
+
+	// nothing is listening
+	ingest := fmt.Sprintf("rtmp://127.0.0.1:%d/live/test", freePort(t))
+
+	pr, pw := io.Pipe()
+
+	r := &Restream{
+		URL:        ingest,
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: 200 * time.Millisecond,
+	}
+
+	out, err := r.Connect(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, out)
+
+	source := testSource(t)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for r.Health().Reconnects < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the restream has not reconnected")
+		}
+		// keep the stream going, the recording must not be affected
+		if _, err := pw.Write(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pw.Close()
+
+	if err := r.Wait(); err == nil {
+		t.Fatal("expected the last connection error")
+	}
+
+	h := r.Health()
+	if h.State != HealthStopped || h.LastError == "" {
+		t.Fatalf("unexpected health %+v", h)
+	}
+}
+
+func TestRestreamJoinsHalfway(t *testing.T) {
+	setupRestreamTest(t)
+
+	var (
+		// not mpegts, it can't be joined halfway without the remux
+		source = testSource(t)
+		ingest = fmt.Sprintf("rtmp://127.0.0.1:%d/live/test", freePort(t))
+	)
+
+	r := &Restream{
+		URL:        ingest,
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+	}
+
+	// a few seconds of stream
+	out, err := r.Connect(&slowReader{r: bytes.NewReader(source), delay: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, out)
+
+	// the ingest comes up once the stream has started
+	for r.Health().Reconnects < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	listener := exec.Command(config.Instance().Paths.FFmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-listen", "1",
+		"-f", "flv",
+		"-i", ingest,
+		"-c", "copy",
+		"-f", "null", "-",
+	)
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Process.Kill()
+
+	connected := false
+	for !connected {
+		select {
+		case <-r.done:
+			t.Fatalf("the restream never connected, last error: %s", r.Health().LastError)
+		case <-time.After(10 * time.Millisecond):
+			connected = r.Health().State == HealthConnected
+		}
+	}
+
+	r.Wait()
+}
+
+// Emulates a live source
+type slowReader struct {
+	r     *bytes.Reader
+	delay time.Duration
+}
+
+func newSlowReader(b []byte) *slowReader {
+	return &slowReader{r: bytes.NewReader(b), delay: 20 * time.Millisecond}
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p[:min(len(p), 4096)])
+}
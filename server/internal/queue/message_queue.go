@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"sync"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
@@ -16,6 +17,8 @@ type MessageQueue struct {
 	metadataQueue chan downloaders.Downloader
 	ctx           context.Context
 	cancel        context.CancelFunc
+	hooks         []func(downloaders.Downloader)
+	hooksMu       sync.RWMutex
 }
 
 func NewMessageQueue() (*MessageQueue, error) {
@@ -82,11 +85,72 @@ func (m *MessageQueue) downloadWorker(workerId int) {
 			m.metadataQueue <- p
 			slog.Info("queued for metadata", slog.String("id", p.GetId()))
 
-			p.Start()
+			if err := p.Start(); err != nil {
+				slog.Warn("download worker process exited with error",
+					slog.String("id", p.GetId()),
+					slog.Any("err", err),
+				)
+				continue
+			}
+
+			if m.verify(p) {
+				m.completed(p)
+			}
 		}
 	}
 }
 
+// Register a function called each time a download successfully completes.
+// Hooks are run by the download worker, long running work must be spawned
+// in a separate goroutine.
+func (m *MessageQueue) OnCompleted(hook func(downloaders.Downloader)) {
+	m.hooksMu.Lock()
+	m.hooks = append(m.hooks, hook)
+	m.hooksMu.Unlock()
+}
+
+func (m *MessageQueue) completed(p downloaders.Downloader) {
+	m.hooksMu.RLock()
+	defer m.hooksMu.RUnlock()
+
+	for _, hook := range m.hooks {
+		hook(p)
+	}
+}
+
+// Check the integrity of a completed download, if it turns out to be corrupt
+// and retries are still available the download is queued again.
+// Returns true if the download can be considered completed.
+func (m *MessageQueue) verify(p downloaders.Downloader) bool {
+	if !config.Instance().Verification.Enabled {
+		return true
+	}
+
+	v, ok := p.(downloaders.Verifiable)
+	if !ok || v.Verify() {
+		return true
+	}
+
+	if v.Attempts() > config.Instance().Verification.MaxRetries {
+		slog.Error("download is corrupt, no retries left", slog.String("id", p.GetId()))
+		return false
+	}
+
+	if err := v.Reset(); err != nil {
+		slog.Error("failed to reset corrupt download", slog.String("id", p.GetId()), slog.Any("err", err))
+		return false
+	}
+
+	slog.Info("re-downloading corrupt download",
+		slog.String("id", p.GetId()),
+		slog.Int("attempt", v.Attempts()),
+	)
+
+	// publishing from a worker could block it if the queue is full
+	go m.Publish(p)
+	return false
+}
+
 func (m *MessageQueue) metadataWorker() {
 	slog.Info("metadata worker spawned", slog.Int("worker", 1))
 
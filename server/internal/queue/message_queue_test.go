@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+)
+
+// A downloader whose output is always found corrupt
+type corruptDownload struct {
+	downloaders.Downloader
+
+	attempts int
+	resets   int
+	resetErr error
+	pending  bool
+}
+
+func (c *corruptDownload) GetId() string     { return "corrupt" }
+func (c *corruptDownload) SetPending(p bool) { c.pending = p }
+func (c *corruptDownload) Attempts() int     { return c.attempts }
+
+func (c *corruptDownload) Verify() bool {
+	c.attempts++
+	return false
+}
+
+func (c *corruptDownload) Reset() error {
+	c.resets++
+	return c.resetErr
+}
+
+func TestVerify(t *testing.T) {
+	prev, prevSize := config.Instance().Verification, config.Instance().Server.QueueSize
+	t.Cleanup(func() {
+		config.Instance().Verification = prev
+		config.Instance().Server.QueueSize = prevSize
+	})
+
+	config.Instance().Server.QueueSize = 2
+	config.Instance().Verification = config.VerifyConfig{Enabled: true, MaxRetries: 1}
+
+	mq, err := NewMessageQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	republished := func() bool {
+		select {
+		case <-mq.downloadQueue:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	d := &corruptDownload{}
+
+	// the first failure is retried
+	if mq.verify(d) {
+		t.Fatal("a corrupt download has been completed")
+	}
+	if d.resets != 1 || !republished() {
+		t.Fatalf("the corrupt download hasn't been queued again, %d resets", d.resets)
+	}
+
+	// no retries left
+	if mq.verify(d) {
+		t.Fatal("a corrupt download has been completed")
+	}
+	if d.resets != 1 || republished() {
+		t.Fatal("the corrupt download has been retried past the max retries")
+	}
+
+	// a failed reset isn't retried
+	d = &corruptDownload{resetErr: errors.New("permission denied")}
+	if mq.verify(d) || republished() {
+		t.Fatal("the download has been retried after a failed reset")
+	}
+
+	// not verified at all
+	config.Instance().Verification.Enabled = false
+	if !mq.verify(&corruptDownload{}) {
+		t.Fatal("a download has been verified with the verification disabled")
+	}
+}
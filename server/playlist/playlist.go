@@ -14,10 +14,12 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 )
 
-func PlaylistDetect(req internal.DownloadRequest, mq *queue.MessageQueue, db *kv.Store) error {
+// The pipeline p (can be nil) is attached to each of the playlist entries.
+func PlaylistDetect(req internal.DownloadRequest, p *pipeline.Pipeline, mq *queue.MessageQueue, db *kv.Store) error {
 	params := append(req.Params, "--flat-playlist", "-J")
 	urlWithParams := append([]string{req.URL}, params...)
 
@@ -83,6 +85,7 @@ func PlaylistDetect(req internal.DownloadRequest, mq *queue.MessageQueue, db *kv
 
 			downloader := downloaders.NewGenericDownload(meta.URL, req.Params)
 			downloader.SetOutput(internal.DownloadOutput{Filename: req.Rename})
+			downloader.SetPipeline(p)
 			// downloader.SetMetadata(meta)
 
 			db.Set(downloader)
@@ -93,6 +96,7 @@ func PlaylistDetect(req internal.DownloadRequest, mq *queue.MessageQueue, db *kv
 	}
 
 	d := downloaders.NewGenericDownload(req.URL, req.Params)
+	d.SetPipeline(p)
 
 	db.Set(d)
 	mq.Publish(d)
@@ -0,0 +1,111 @@
+package postprocess
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A named set of ffmpeg options applied to a downloaded file
+type Preset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// returns the ffmpeg output options and the extension of the output file
+	args func(input string) ([]string, string)
+}
+
+var presets = []Preset{
+	{
+		Name:        "h265",
+		Description: "Re-encode the video stream to H.265, audio is copied",
+		args: func(input string) ([]string, string) {
+			ext := filepath.Ext(input)
+			// webm can't hold h265
+			if strings.EqualFold(ext, ".webm") {
+				ext = ".mkv"
+			}
+			return []string{
+				"-map", "0",
+				"-c", "copy",
+				"-c:v", "libx265",
+				"-crf", "28",
+				"-preset", "medium",
+			}, ext
+		},
+	},
+	{
+		Name:        "loudnorm",
+		Description: "Normalize the audio loudness (EBU R128), video is copied",
+		args: func(input string) ([]string, string) {
+			return []string{
+				"-c:v", "copy",
+				"-af", "loudnorm=I=-16:TP=-1.5:LRA=11",
+				// loudnorm resamples to 192kHz
+				"-ar", "48000",
+			}, filepath.Ext(input)
+		},
+	},
+	{
+		Name:        "burn-subs",
+		Description: "Burn the subtitles in the video, a .srt/.vtt/.ass file next to the input is preferred over the embedded ones",
+		args: func(input string) ([]string, string) {
+			subs := input
+			if sidecar := findSubtitles(input); sidecar != "" {
+				subs = sidecar
+			}
+			return []string{
+				"-vf", "subtitles=filename=" + escapeFilterValue(subs),
+				"-c:a", "copy",
+			}, filepath.Ext(input)
+		},
+	},
+}
+
+func Presets() []Preset { return presets }
+
+func findPreset(name string) (*Preset, error) {
+	for _, p := range presets {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown post-processing preset %s", name)
+}
+
+// yt-dlp saves the subtitles as <name>.<lang>.<ext> next to the video
+func findSubtitles(input string) string {
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+
+	for _, ext := range []string{".srt", ".ass", ".vtt"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+		matches, _ := filepath.Glob(escapeGlob(base) + ".*" + ext)
+		if len(matches) > 0 {
+			return matches[0]
+		}
+	}
+
+	return ""
+}
+
+// Escape a filter option value, ffmpeg unescapes it twice: once when
+// parsing the filtergraph and once when parsing the filter options.
+func escapeFilterValue(v string) string {
+	option := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	graph := strings.NewReplacer(
+		`\`, `\\`,
+		`'`, `\'`,
+		`[`, `\[`,
+		`]`, `\]`,
+		`,`, `\,`,
+		`;`, `\;`,
+	)
+	return graph.Replace(option.Replace(v))
+}
+
+func escapeGlob(v string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(v)
+}
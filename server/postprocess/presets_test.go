@@ -0,0 +1,89 @@
+package postprocess
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPresetArgs(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		preset string
+		input  string
+		args   []string
+		ext    string
+	}{
+		{
+			preset: "h265",
+			input:  "video.mp4",
+			args:   []string{"-map", "0", "-c", "copy", "-c:v", "libx265", "-crf", "28", "-preset", "medium"},
+			ext:    ".mp4",
+		},
+		{
+			// webm can't hold h265
+			preset: "h265",
+			input:  "video.WEBM",
+			args:   []string{"-map", "0", "-c", "copy", "-c:v", "libx265", "-crf", "28", "-preset", "medium"},
+			ext:    ".mkv",
+		},
+		{
+			preset: "loudnorm",
+			input:  "video.webm",
+			args:   []string{"-c:v", "copy", "-af", "loudnorm=I=-16:TP=-1.5:LRA=11", "-ar", "48000"},
+			ext:    ".webm",
+		},
+		{
+			// no sidecar, the embedded subtitles are burnt
+			preset: "burn-subs",
+			input:  "plain.mkv",
+			args:   []string{"-vf", "subtitles=filename=" + escapeFilterValue(filepath.Join(dir, "plain.mkv")), "-c:a", "copy"},
+			ext:    ".mkv",
+		},
+		{
+			preset: "burn-subs",
+			input:  "subbed [x].mp4",
+			args:   []string{"-vf", "subtitles=filename=" + escapeFilterValue(filepath.Join(dir, "subbed [x].en.srt")), "-c:a", "copy"},
+			ext:    ".mp4",
+		},
+	}
+
+	for _, name := range []string{"subbed [x].mp4", "subbed [x].en.srt", "plain.mkv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		p, err := findPreset(tt.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		args, ext := p.args(filepath.Join(dir, tt.input))
+		if !slices.Equal(args, tt.args) || ext != tt.ext {
+			t.Errorf("%s %s: got %v %s, want %v %s", tt.preset, tt.input, args, ext, tt.args, tt.ext)
+		}
+	}
+
+	if _, err := findPreset("unknown"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := map[string]string{
+		"/videos/plain.srt":       "/videos/plain.srt",
+		"/videos/it's:[1].srt":    `/videos/it\\\'s\\:\[1\].srt`,
+		`/videos/a,b;c\d.srt`:     `/videos/a\,b\;c\\\\d.srt`,
+		"/videos/[a] b, c; d.srt": `/videos/\[a\] b\, c\; d.srt`,
+	}
+
+	for in, want := range tests {
+		if got := escapeFilterValue(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package postprocess
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+)
+
+// Post-processing jobs are CPU bound, they have their own queue so that they
+// don't take slots away from the downloads.
+type Queue struct {
+	concurrency int
+	jobs        chan downloaders.Downloader
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func NewQueue() (*Queue, error) {
+	qs := config.Instance().PostProcessing.QueueSize
+	if qs <= 0 {
+		return nil, errors.New("invalid post-processing queue size")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		concurrency: qs,
+		jobs:        make(chan downloaders.Downloader, qs*4),
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+func (q *Queue) Publish(d downloaders.Downloader) {
+	d.SetPending(true)
+
+	select {
+	case q.jobs <- d:
+		slog.Info("published post-processing job", slog.String("id", d.GetId()))
+	case <-q.ctx.Done():
+		slog.Warn("post-processing queue stopped, dropping job", slog.String("id", d.GetId()))
+	}
+}
+
+func (q *Queue) SetupConsumers() {
+	for i := 1; i < q.concurrency+1; i++ {
+		go q.worker(i)
+	}
+}
+
+func (q *Queue) Stop() { q.cancel() }
+
+func (q *Queue) worker(workerId int) {
+	slog.Info("post-processing worker spawned", slog.Int("worker", workerId))
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case d := <-q.jobs:
+			if d == nil || d.IsCompleted() {
+				continue
+			}
+
+			slog.Info("post-processing worker starting job",
+				slog.Int("worker", workerId),
+				slog.String("id", d.GetId()),
+			)
+
+			if err := d.Start(); err != nil {
+				slog.Warn("post-processing job exited with error",
+					slog.String("id", d.GetId()),
+					slog.Any("err", err),
+				)
+			}
+		}
+	}
+}
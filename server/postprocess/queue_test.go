@@ -0,0 +1,68 @@
+package postprocess
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+)
+
+// Records the order the jobs are started in
+type testJob struct {
+	downloaders.Downloader
+
+	id        string
+	completed bool
+	started   chan<- string
+}
+
+func (j *testJob) GetId() string     { return j.id }
+func (j *testJob) IsCompleted() bool { return j.completed }
+func (j *testJob) SetPending(bool)   {}
+
+func (j *testJob) Start() error {
+	j.started <- j.id
+	return nil
+}
+
+func TestQueueOrder(t *testing.T) {
+	prev := config.Instance().PostProcessing.QueueSize
+	config.Instance().PostProcessing.QueueSize = 1
+	t.Cleanup(func() { config.Instance().PostProcessing.QueueSize = prev })
+
+	q, err := NewQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	started := make(chan string)
+
+	// published before the worker is up, they're run in order
+	for _, id := range []string{"first", "done", "second", "third"} {
+		q.Publish(&testJob{id: id, completed: id == "done", started: started})
+	}
+
+	q.SetupConsumers()
+
+	var order []string
+	for range 3 {
+		select {
+		case id := <-started:
+			order = append(order, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("jobs started so far %v", order)
+		}
+	}
+
+	if want := []string{"first", "second", "third"}; !slices.Equal(order, want) {
+		t.Errorf("jobs started in order %v, want %v", order, want)
+	}
+
+	config.Instance().PostProcessing.QueueSize = 0
+	if _, err := NewQueue(); err == nil {
+		t.Error("expected an error for an invalid queue size")
+	}
+}
@@ -0,0 +1,119 @@
+package postprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/ffmpeg"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+)
+
+type Request struct {
+	// Absolute path of a file under the download path
+	Path   string `json:"path"`
+	Preset string `json:"preset"`
+}
+
+type Service struct {
+	queue *Queue
+	mdb   *kv.Store
+}
+
+func NewService(q *Queue, mdb *kv.Store, mq *queue.MessageQueue) *Service {
+	s := &Service{
+		queue: q,
+		mdb:   mdb,
+	}
+
+	mq.OnCompleted(s.auto)
+
+	return s
+}
+
+// Queue a post-processing job, returns its id.
+// Jobs are stored along the downloads so their progress is reported the same way.
+func (s *Service) Submit(req Request) (string, error) {
+	preset, err := findPreset(req.Preset)
+	if err != nil {
+		return "", err
+	}
+
+	if err := internal.ValidateSubPath(req.Path); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errors.New("only files can be post-processed")
+	}
+
+	args, ext := preset.args(req.Path)
+
+	output := fmt.Sprintf(
+		"%s [%s]%s",
+		strings.TrimSuffix(req.Path, filepath.Ext(req.Path)),
+		preset.Name,
+		ext,
+	)
+
+	if _, err := os.Stat(output); err == nil {
+		return "", fmt.Errorf("%s already exists", filepath.Base(output))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the duration is needed only to report the progress
+	var duration float64
+	if probed, err := ffmpeg.Probe(ctx, req.Path); err == nil {
+		duration = probed.Duration
+	}
+
+	d := downloaders.NewFFmpegDownload("postprocess", req.Path, output, duration, nil, args)
+
+	s.mdb.Set(d)
+	s.queue.Publish(d)
+
+	return d.GetId(), nil
+}
+
+// Completion hook, applies the configured preset to each finished download
+func (s *Service) auto(d downloaders.Downloader) {
+	preset := config.Instance().PostProcessing.AutoPreset
+	if preset == "" {
+		return
+	}
+
+	snap := d.Status()
+	if snap.DownloaderName != "generic" || snap.Output.SavedFilePath == "" {
+		return
+	}
+
+	go func() {
+		id, err := s.Submit(Request{Path: snap.Output.SavedFilePath, Preset: preset})
+		if err != nil {
+			slog.Error("failed to queue post-processing job",
+				slog.String("download", d.GetId()),
+				slog.Any("err", err),
+			)
+			return
+		}
+		slog.Info("queued post-processing job",
+			slog.String("download", d.GetId()),
+			slog.String("id", id),
+		)
+	}()
+}
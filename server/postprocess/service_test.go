@@ -0,0 +1,80 @@
+package postprocess
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSubmit(t *testing.T) {
+	dir := t.TempDir()
+
+	prevPath, prevSize := config.Instance().Paths.DownloadPath, config.Instance().PostProcessing.QueueSize
+	config.Instance().Paths.DownloadPath = dir
+	config.Instance().PostProcessing.QueueSize = 1
+	t.Cleanup(func() {
+		config.Instance().Paths.DownloadPath = prevPath
+		config.Instance().PostProcessing.QueueSize = prevSize
+	})
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mdb, err := kv.NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Service{queue: q, mdb: mdb}
+
+	for _, name := range []string{"video.webm", "done.mp4", "done [loudnorm].mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id, err := s.Submit(Request{Path: filepath.Join(dir, "video.webm"), Preset: "h265"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := mdb.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-q.jobs; got != d {
+		t.Error("the job hasn't been queued")
+	}
+
+	job := d.(*downloaders.FFmpegDownloader)
+	if job.Kind != "postprocess" || job.Status().Output.Filename != "video [h265].mkv" {
+		t.Errorf("unexpected job %s writing %s", job.Kind, job.Status().Output.Filename)
+	}
+
+	invalid := map[string]Request{
+		"unknown preset":  {Path: filepath.Join(dir, "video.webm"), Preset: "unknown"},
+		"outside":         {Path: filepath.Join(t.TempDir(), "video.webm"), Preset: "h265"},
+		"missing":         {Path: filepath.Join(dir, "missing.mp4"), Preset: "h265"},
+		"directory":       {Path: dir, Preset: "h265"},
+		"existing output": {Path: filepath.Join(dir, "done.mp4"), Preset: "loudnorm"},
+	}
+	for name, req := range invalid {
+		if _, err := s.Submit(req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -3,14 +3,16 @@ package rest
 import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 
 	bolt "go.etcd.io/bbolt"
 )
 
 type ContainerArgs struct {
-	DB  *bolt.DB
-	MDB *kv.Store
-	MQ  *queue.MessageQueue
-	LM  *livestream.Monitor
+	DB        *bolt.DB
+	MDB       *kv.Store
+	MQ        *queue.MessageQueue
+	LM        *livestream.Monitor
+	Pipelines *pipeline.Store
 }
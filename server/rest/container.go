@@ -29,6 +29,7 @@ func ApplyRouter(args *ContainerArgs) func(chi.Router) {
 		r.Post("/execPlaylist", h.ExecPlaylist())
 		r.Post("/execLivestream", h.ExecLivestream())
 		r.Get("/running", h.Running())
+		r.Get("/livestream/{id}/hls/{file}", h.LivestreamPreview())
 		r.Get("/version", h.GetVersion())
 		r.Get("/cookies", h.GetCookies())
 		r.Post("/cookies", h.SetCookies())
@@ -3,9 +3,12 @@ package rest
 import (
 	"encoding/json"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
 )
 
 type Handler struct {
@@ -79,7 +82,10 @@ func (h *Handler) ExecLivestream() http.HandlerFunc {
 			return
 		}
 
-		h.service.ExecLivestream(req)
+		if err := h.service.ExecLivestream(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -107,6 +113,36 @@ func (h *Handler) Running() http.HandlerFunc {
 	}
 }
 
+// Serves the HLS playlist and segments of a livestream being recorded
+func (h *Handler) LivestreamPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			id   = chi.URLParam(r, "id")
+			file = chi.URLParam(r, "file")
+		)
+
+		if !filepath.IsLocal(id) || !filepath.IsLocal(file) || filepath.Base(file) != file {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+
+		path := filepath.Join(pipes.HLSDir(id), file)
+
+		if _, err := os.Stat(path); err != nil {
+			http.Error(w, "preview not available", http.StatusNotFound)
+			return
+		}
+
+		// the playlist is rewritten for each new segment
+		if file == pipes.HLSPlaylist {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		http.ServeFile(w, r, path)
+	}
+}
+
 func (h *Handler) GetCookies() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
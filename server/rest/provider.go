@@ -14,7 +14,7 @@ var (
 
 func ProvideService(args *ContainerArgs) *Service {
 	serviceOnce.Do(func() {
-		service = NewService(args.MDB, args.DB, args.MQ, args.LM)
+		service = NewService(args.MDB, args.DB, args.MQ, args.LM, args.Pipelines)
 	})
 	return service
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/playlist"
 
@@ -23,10 +24,11 @@ import (
 )
 
 type Service struct {
-	mdb *kv.Store
-	db  *bolt.DB
-	mq  *queue.MessageQueue
-	lm  *livestream.Monitor
+	mdb       *kv.Store
+	db        *bolt.DB
+	mq        *queue.MessageQueue
+	lm        *livestream.Monitor
+	pipelines *pipeline.Store
 }
 
 func NewService(
@@ -34,25 +36,33 @@ func NewService(
 	db *bolt.DB,
 	mq *queue.MessageQueue,
 	lm *livestream.Monitor,
+	pipelines *pipeline.Store,
 ) *Service {
 	db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte("templates"))
 		return err
 	})
 	return &Service{
-		mdb: mdb,
-		db:  db,
-		mq:  mq,
-		lm:  lm,
+		mdb:       mdb,
+		db:        db,
+		mq:        mq,
+		lm:        lm,
+		pipelines: pipelines,
 	}
 }
 
 func (s *Service) Exec(req internal.DownloadRequest) (string, error) {
+	p, err := s.pipelines.Resolve(req.PipelineId)
+	if err != nil {
+		return "", err
+	}
+
 	d := downloaders.NewGenericDownload(req.URL, req.Params)
 	d.SetOutput(internal.DownloadOutput{
 		Path:     req.Path,
 		Filename: req.Rename,
 	})
+	d.SetPipeline(p)
 
 	id := s.mdb.Set(d)
 	s.mq.Publish(d)
@@ -61,11 +71,16 @@ func (s *Service) Exec(req internal.DownloadRequest) (string, error) {
 }
 
 func (s *Service) ExecPlaylist(req internal.DownloadRequest) error {
-	return playlist.PlaylistDetect(req, s.mq, s.mdb)
+	p, err := s.pipelines.Resolve(req.PipelineId)
+	if err != nil {
+		return err
+	}
+
+	return playlist.PlaylistDetect(req, p, s.mq, s.mdb)
 }
 
-func (s *Service) ExecLivestream(req internal.DownloadRequest) {
-	s.lm.Add(req.URL)
+func (s *Service) ExecLivestream(req internal.DownloadRequest) error {
+	return s.lm.Add(req.URL, req.PipelineId)
 }
 
 func (s *Service) Running(ctx context.Context) (*[]internal.ProcessSnapshot, error) {
@@ -108,11 +123,13 @@ func (s *Service) SetCookies(ctx context.Context, cookies string) error {
 func (s *Service) SaveTemplate(ctx context.Context, template *internal.CustomTemplate) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("templates"))
+		// the id is stored too, so the template can be referenced
+		template.Id = uuid.NewString()
 		v, err := json.Marshal(template)
 		if err != nil {
 			return err
 		}
-		return b.Put([]byte(uuid.NewString()), v)
+		return b.Put([]byte(template.Id), v)
 	})
 }
 
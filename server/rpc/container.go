@@ -5,17 +5,24 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	middlewares "github.com/marcopiovanello/yt-dlp-web-ui/v4/server/middleware"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/openid"
 )
 
 // Dependency injection container.
-func Container(db *kv.Store, mq *queue.MessageQueue, lm *livestream.Monitor) *Service {
+func Container(
+	db *kv.Store,
+	mq *queue.MessageQueue,
+	lm *livestream.Monitor,
+	pipelines *pipeline.Store,
+) *Service {
 	return &Service{
-		db: db,
-		mq: mq,
-		lm: lm,
+		db:        db,
+		mq:        mq,
+		lm:        lm,
+		pipelines: pipelines,
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/playlist"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/sys"
@@ -16,9 +17,10 @@ import (
 )
 
 type Service struct {
-	db *kv.Store
-	mq *queue.MessageQueue
-	lm *livestream.Monitor
+	db        *kv.Store
+	mq        *queue.MessageQueue
+	lm        *livestream.Monitor
+	pipelines *pipeline.Store
 }
 
 type Running []internal.ProcessSnapshot
@@ -29,11 +31,17 @@ type NoArgs struct{}
 // Exec spawns a Process.
 // The result of the execution is the newly spawned process Id.
 func (s *Service) Exec(args internal.DownloadRequest, result *string) error {
+	p, err := s.pipelines.Resolve(args.PipelineId)
+	if err != nil {
+		return err
+	}
+
 	d := downloaders.NewGenericDownload(args.URL, args.Params)
 	d.SetOutput(internal.DownloadOutput{
 		Path:     args.Path,
 		Filename: args.Rename,
 	})
+	d.SetPipeline(p)
 
 	s.db.Set(d)
 	s.mq.Publish(d)
@@ -45,7 +53,12 @@ func (s *Service) Exec(args internal.DownloadRequest, result *string) error {
 // Exec spawns a Process.
 // The result of the execution is the newly spawned process Id.
 func (s *Service) ExecPlaylist(args internal.DownloadRequest, result *string) error {
-	err := playlist.PlaylistDetect(args, s.mq, s.db)
+	p, err := s.pipelines.Resolve(args.PipelineId)
+	if err != nil {
+		return err
+	}
+
+	err = playlist.PlaylistDetect(args, p, s.mq, s.db)
 	if err != nil {
 		return err
 	}
@@ -56,7 +69,9 @@ func (s *Service) ExecPlaylist(args internal.DownloadRequest, result *string) er
 
 // TODO: docs
 func (s *Service) ExecLivestream(args internal.DownloadRequest, result *string) error {
-	s.lm.Add(args.URL)
+	if err := s.lm.Add(args.URL, args.PipelineId); err != nil {
+		return err
+	}
 
 	*result = args.URL
 	return nil
@@ -107,7 +122,11 @@ func (s *Service) Formats(args internal.DownloadRequest, meta *formats.Metadata)
 	}
 
 	if metadata.IsPlaylist() {
-		go playlist.PlaylistDetect(args, s.mq, s.db)
+		p, err := s.pipelines.Resolve(args.PipelineId)
+		if err != nil {
+			return err
+		}
+		go playlist.PlaylistDetect(args, p, s.mq, s.db)
 	}
 
 	*meta = *metadata
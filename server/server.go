@@ -17,15 +17,22 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archiver"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/clip"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/filebrowser"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/livestream"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/logging"
 	middlewares "github.com/marcopiovanello/yt-dlp-web-ui/v4/server/middleware"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/openid"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/postprocess"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/rest"
 	ytdlpRPC "github.com/marcopiovanello/yt-dlp-web-ui/v4/server/rpc"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/status"
@@ -43,14 +50,19 @@ type RunConfig struct {
 }
 
 type serverConfig struct {
-	frontend      fs.FS
-	swagger       fs.FS
-	mdb           *kv.Store
-	db            *bolt.DB
-	mq            *queue.MessageQueue
-	lm            *livestream.Monitor
-	taskRunner    task.TaskRunner
-	twitchMonitor *twitch.Monitor
+	frontend     fs.FS
+	swagger      fs.FS
+	mdb          *kv.Store
+	db           *bolt.DB
+	mq           *queue.MessageQueue
+	lm           *livestream.Monitor
+	pipelines    *pipeline.Store
+	taskRunner   task.TaskRunner
+	twitchSource *twitch.Source
+	backfill     *twitch.Backfill
+	channels     *channel.Monitor
+	clips        *clip.Service
+	postprocess  *postprocess.Service
 }
 
 // TODO: change scope
@@ -102,44 +114,90 @@ func Run(ctx context.Context, rc *RunConfig) error {
 	// make the new logger the default one with all the new writers
 	slog.SetDefault(logger)
 
+	// previews of the recordings interrupted by the last shutdown
+	os.RemoveAll(pipes.HLSDir(""))
+
 	mq, err := queue.NewMessageQueue()
 	if err != nil {
 		return err
 	}
 	mq.SetupConsumers()
-	go mdb.Restore(mq)
+	// the pipelines are fed once the downloads are verified
+	mq.OnCompleted(downloaders.RunPipeline)
+
+	pipelines, err := pipeline.NewStore(boltdb)
+	if err != nil {
+		return err
+	}
+
+	ppq, err := postprocess.NewQueue()
+	if err != nil {
+		return err
+	}
+	ppq.SetupConsumers()
+
+	go mdb.Restore(mq, ppq, pipelines)
 	go mdb.EventListener()
 
-	lm := livestream.NewMonitor(mq, mdb, boltdb)
+	lm := livestream.NewMonitor(mq, mdb, pipelines, boltdb)
 	go lm.Schedule()
 	go lm.Restore()
 
-	tm := twitch.NewMonitor(
+	ts := twitch.NewSource(
 		twitch.NewAuthenticationManager(
 			config.Instance().Twitch.ClientId,
 			config.Instance().Twitch.ClientSecret,
 		),
 		boltdb,
+		mdb,
+		mq,
+		pipelines,
 	)
-	go tm.Monitor(
+
+	cm := channel.NewMonitor(boltdb, pipelines)
+	cm.Register(ts)
+	if err := cm.Restore(); err != nil {
+		slog.Error("failed to restore monitored channels", slog.Any("err", err))
+	}
+	if err := twitch.Migrate(boltdb, cm); err != nil {
+		slog.Error("failed to migrate the monitored twitch users", slog.Any("err", err))
+	}
+	go cm.Monitor(
 		ctx,
-		config.Instance().Twitch.CheckInterval,
-		twitch.DEFAULT_DOWNLOAD_HANDLER(mdb, mq),
+		config.Instance().Channels.CheckInterval,
+		channel.DEFAULT_DOWNLOAD_HANDLER(mdb, mq, pipelines),
 	)
-	go tm.Restore()
 
-	cronTaskRunner := task.NewCronTaskRunner(mq, mdb)
+	tb := twitch.NewBackfill(ts, cm, mdb, mq, pipelines)
+	go tb.Sync(ctx, config.Instance().Twitch.SyncInterval)
+
+	cronTaskRunner := task.NewCronTaskRunner(mq, mdb, pipelines, boltdb)
 	go cronTaskRunner.Spawner(ctx)
+	go cronTaskRunner.Recoverer(ctx)
+	go cronTaskRunner.Janitor(ctx, config.Instance().Subscriptions.RetentionInterval)
+
+	clipStore, err := clip.NewStore(boltdb)
+	if err != nil {
+		return err
+	}
+	clips := clip.NewService(clipStore, mdb, mq)
+
+	pp := postprocess.NewService(ppq, mdb, mq)
 
 	scfg := serverConfig{
-		frontend:      rc.App,
-		swagger:       rc.Swagger,
-		mdb:           mdb,
-		db:            boltdb,
-		mq:            mq,
-		lm:            lm,
-		twitchMonitor: tm,
-		taskRunner:    cronTaskRunner,
+		frontend:     rc.App,
+		swagger:      rc.Swagger,
+		mdb:          mdb,
+		db:           boltdb,
+		mq:           mq,
+		lm:           lm,
+		pipelines:    pipelines,
+		twitchSource: ts,
+		backfill:     tb,
+		channels:     cm,
+		taskRunner:   cronTaskRunner,
+		clips:        clips,
+		postprocess:  pp,
 	}
 
 	srv := newServer(scfg)
@@ -173,8 +231,8 @@ func Run(ctx context.Context, rc *RunConfig) error {
 }
 
 func newServer(c serverConfig) *http.Server {
-	// archiver.Register(c.db)
-	service := ytdlpRPC.Container(c.mdb, c.mq, c.lm)
+	archiver.Register(c.db, c.mq)
+	service := ytdlpRPC.Container(c.mdb, c.mq, c.lm, c.pipelines)
 	rpc.Register(service)
 
 	r := chi.NewRouter()
@@ -206,7 +264,7 @@ func newServer(c serverConfig) *http.Server {
 	// Filebrowser routes
 	r.Route("/filebrowser", func(r chi.Router) {
 		r.Use(middlewares.ApplyAuthenticationByConfig)
-		r.Post("/downloaded", filebrowser.ListDownloaded)
+		r.Post("/downloaded", filebrowser.ListDownloaded(c.clips.Store()))
 		r.Post("/delete", filebrowser.DeleteFile)
 		r.Get("/d/{id}", filebrowser.DownloadFile)
 		r.Get("/v/{id}", filebrowser.SendFile)
@@ -214,7 +272,7 @@ func newServer(c serverConfig) *http.Server {
 	})
 
 	// Archive routes
-	// r.Route("/archive", archive.ApplyRouter(c.db))
+	r.Route("/archive", archive.ApplyRouter(c.db))
 
 	// Authentication routes
 	r.Route("/auth", func(r chi.Router) {
@@ -233,10 +291,11 @@ func newServer(c serverConfig) *http.Server {
 
 	// REST API handlers
 	r.Route("/api/v1", rest.ApplyRouter(&rest.ContainerArgs{
-		DB:  c.db,
-		MDB: c.mdb,
-		MQ:  c.mq,
-		LM:  c.lm,
+		DB:        c.db,
+		MDB:       c.mdb,
+		MQ:        c.mq,
+		LM:        c.lm,
+		Pipelines: c.pipelines,
 	}))
 
 	// Logging
@@ -246,14 +305,43 @@ func newServer(c serverConfig) *http.Server {
 	r.Route("/status", status.ApplyRouter(c.mdb))
 
 	// Subscriptions
-	r.Route("/subscriptions", subscription.Container(c.db, c.taskRunner).ApplyRouter())
+	r.Route("/subscriptions", subscription.Container(c.db, c.taskRunner, c.pipelines).ApplyRouter())
 
 	// Twitch
 	r.Route("/twitch", func(r chi.Router) {
+		// called by twitch, authenticated by the message signature
+		r.Post("/eventsub", c.twitchSource.EventSubHandler())
+
+		// the users are monitored as channels of the twitch source
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.ApplyAuthenticationByConfig)
+			r.Post("/user/{user}/backfill", twitch.BackfillUser(c.backfill))
+		})
+	})
+
+	// Channels
+	r.Route("/channels", func(r chi.Router) {
+		r.Use(middlewares.ApplyAuthenticationByConfig)
+		r.Get("/", channel.ListChannelsHandler(c.channels))
+		r.Get("/sources", channel.ListSourcesHandler(c.channels))
+		r.Post("/", channel.AddChannelHandler(c.channels))
+		r.Delete("/", channel.DeleteChannelHandler(c.channels))
+	})
+
+	// Clips
+	r.Route("/clips", func(r chi.Router) {
+		h := clip.NewRestHandler(c.clips)
+		r.Use(middlewares.ApplyAuthenticationByConfig)
+		r.Get("/", h.List)
+		r.Post("/", h.Submit)
+	})
+
+	// Post-processing
+	r.Route("/postprocess", func(r chi.Router) {
+		h := postprocess.NewRestHandler(c.postprocess)
 		r.Use(middlewares.ApplyAuthenticationByConfig)
-		r.Get("/users", twitch.GetMonitoredUsers(c.twitchMonitor))
-		r.Post("/user", twitch.MonitorUserHandler(c.twitchMonitor))
-		r.Delete("/user/{user}", twitch.DeleteUser(c.twitchMonitor))
+		r.Get("/presets", h.Presets)
+		r.Post("/", h.Submit)
 	})
 
 	// Pipelines
@@ -263,6 +351,7 @@ func newServer(c serverConfig) *http.Server {
 		r.Get("/id/{id}", h.GetPipeline)
 		r.Get("/all", h.GetAllPipelines)
 		r.Post("/", h.SavePipeline)
+		r.Post("/id/{id}/validate", h.ValidatePipeline)
 		r.Delete("/id/{id}", h.DeletePipeline)
 	})
 
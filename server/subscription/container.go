@@ -1,16 +1,17 @@
 package subscription
 
 import (
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/task"
 
 	bolt "go.etcd.io/bbolt"
 )
 
-func Container(db *bolt.DB, runner task.TaskRunner) domain.RestHandler {
+func Container(db *bolt.DB, runner task.TaskRunner, pipelines *pipeline.Store) domain.RestHandler {
 	var (
 		r = provideRepository(db)
-		s = provideService(r, runner)
+		s = provideService(r, runner, pipelines)
 		h = provideHandler(s)
 	)
 	return h
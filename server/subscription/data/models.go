@@ -1,8 +1,45 @@
 package data
 
+import "time"
+
 type Subscription struct {
-	Id       string
-	URL      string
-	Params   string
-	CronExpr string
+	Id         string
+	URL        string
+	Params     string
+	CronExpr   string
+	PipelineId string
+	FeedURL    string
+
+	OutputPath       string
+	FilenameTemplate string
+	TemplateId       string
+
+	MaxEntries int
+	// initial backfill
+	BackfillCount int
+	BackfillAfter string
+	Filters       Filters
+	Retention     Retention
+
+	Disabled       bool
+	DisabledReason string
+	EnabledAt      time.Time
+}
+
+type Filters struct {
+	TitleInclude   string
+	TitleExclude   string
+	MinDuration    int
+	MaxDuration    int
+	ExcludeShorts  bool
+	ExcludeLive    bool
+	UploadedAfter  string
+	UploadedBefore string
+	MaxAge         int
+}
+
+type Retention struct {
+	KeepLast      int
+	MaxAge        int
+	KeepUnwatched bool
 }
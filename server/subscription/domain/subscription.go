@@ -2,17 +2,138 @@ package domain
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/data"
 )
 
 type Subscription struct {
-	Id       string `json:"id"`
-	URL      string `json:"url"`
-	Params   string `json:"params"`
-	CronExpr string `json:"cron_expression"`
+	Id         string `json:"id"`
+	URL        string `json:"url"`
+	Params     string `json:"params"`
+	CronExpr   string `json:"cron_expression"`
+	PipelineId string `json:"pipeline_id"`
+	// Atom or RSS feed of URL, polled instead of listing the entries with
+	// yt-dlp, e.g. https://www.youtube.com/feeds/videos.xml?channel_id=...
+	// Its entries can only be filtered by title and upload date.
+	FeedURL string `json:"feed_url,omitempty"`
+	// directory of the downloads, must be under the download path
+	OutputPath string `json:"output_path,omitempty"`
+	// yt-dlp output template, e.g. "%(upload_date)s %(title)s.%(ext)s"
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// saved template whose parameters precede Params
+	TemplateId string `json:"template_id,omitempty"`
+	// new entries queued by a run at most, subscriptions.max_entries if 0
+	MaxEntries int `json:"max_entries,omitempty"`
+	// Queued by the first run, either the latest BackfillCount entries or
+	// the ones uploaded since BackfillAfter (YYYY-MM-DD). Without a backfill
+	// the first run queues only the latest entry.
+	BackfillCount int       `json:"backfill_count,omitempty"`
+	BackfillAfter string    `json:"backfill_after,omitempty"`
+	Filters       Filters   `json:"filters,omitzero"`
+	Retention     Retention `json:"retention,omitzero"`
+	// set when too many consecutive runs failed or by the user, the
+	// subscription isn't scheduled
+	Disabled       bool   `json:"disabled,omitempty"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// runs before the last time the subscription was enabled don't count
+	// towards disabling it
+	EnabledAt time.Time `json:"enabled_at,omitzero"`
+}
+
+// Evaluated against the flat playlist metadata before queueing an entry.
+// An entry missing the metadata checked by a filter passes it.
+type Filters struct {
+	// regular expressions matched against the title
+	TitleInclude string `json:"title_include,omitempty"`
+	TitleExclude string `json:"title_exclude,omitempty"`
+	// seconds
+	MinDuration   int  `json:"min_duration,omitempty"`
+	MaxDuration   int  `json:"max_duration,omitempty"`
+	ExcludeShorts bool `json:"exclude_shorts,omitempty"`
+	// replays of past livestreams
+	ExcludeLive bool `json:"exclude_live,omitempty"`
+	// upload date window, YYYY-MM-DD
+	UploadedAfter  string `json:"uploaded_after,omitempty"`
+	UploadedBefore string `json:"uploaded_before,omitempty"`
+	// days since the upload
+	MaxAge int `json:"max_age,omitempty"`
+}
+
+// Files downloaded by a subscription deleted by the janitor, a file is deleted
+// as soon as one of the rules expires it. The entries stay seen, and in the
+// download archive, so they aren't downloaded again.
+type Retention struct {
+	// newest files kept
+	KeepLast int `json:"keep_last,omitempty"`
+	// days since the download
+	MaxAge int `json:"max_age,omitempty"`
+	// the files watched through the file browser are deleted
+	KeepUnwatched bool `json:"keep_unwatched,omitempty"`
+}
+
+// An entry not queued because of the filters
+type SkippedEntry struct {
+	Id     string `json:"id"`
+	Title  string `json:"title,omitempty"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// Kinds of run, a fetch of the new entries if empty
+const RunKindRetention = "retention"
+
+// A run of a subscription
+type Run struct {
+	Kind  string    `json:"kind,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// entries listed
+	Found int `json:"found"`
+	// downloads queued
+	Queued  int            `json:"queued"`
+	Skipped []SkippedEntry `json:"skipped,omitempty"`
+	// files removed by the retention, sidecars included
+	Deleted []string `json:"deleted,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type RunHistory struct {
+	// zero if the subscription isn't scheduled
+	NextRun time.Time `json:"next_run,omitzero"`
+	Runs    []Run     `json:"runs"`
+}
+
+// Subscription exchange formats
+const (
+	FormatOPML = "opml"
+	FormatCSV  = "csv"
+)
+
+type ImportOptions struct {
+	Format string
+	// applied to the imported subscriptions that don't specify their own
+	CronExpr   string
+	TemplateId string
+	// validate and report without submitting anything
+	DryRun bool
+}
+
+type ImportResult struct {
+	DryRun bool `json:"dry_run"`
+	// submitted, or to be submitted if DryRun
+	Imported []Subscription `json:"imported"`
+	// urls already subscribed or repeated in the file
+	Duplicates []string      `json:"duplicates"`
+	Invalid    []ImportError `json:"invalid"`
+}
+
+type ImportError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
 }
 
 type PaginatedResponse[T any] struct {
@@ -27,6 +148,9 @@ type Repository interface {
 	UpdateByExample(ctx context.Context, example *data.Subscription) error
 	Delete(ctx context.Context, id string) error
 	GetCursor(ctx context.Context, id string) (int64, error)
+	Get(ctx context.Context, id string) (*data.Subscription, error)
+	Disable(ctx context.Context, id, reason string) error
+	Enable(ctx context.Context, id string) error
 }
 
 type Service interface {
@@ -35,6 +159,12 @@ type Service interface {
 	UpdateByExample(ctx context.Context, example *Subscription) error
 	Delete(ctx context.Context, id string) error
 	GetCursor(ctx context.Context, id string) (int64, error)
+	Runs(ctx context.Context, id string) (*RunHistory, error)
+	RunNow(ctx context.Context, id string) error
+	Enable(ctx context.Context, id string) error
+	Disable(ctx context.Context, id string) error
+	Import(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportResult, error)
+	Export(ctx context.Context, w io.Writer, format string) error
 }
 
 type RestHandler interface {
@@ -43,5 +173,11 @@ type RestHandler interface {
 	UpdateByExample() http.HandlerFunc
 	Delete() http.HandlerFunc
 	GetCursor() http.HandlerFunc
+	Runs() http.HandlerFunc
+	RunNow() http.HandlerFunc
+	Enable() http.HandlerFunc
+	Disable() http.HandlerFunc
+	Import() http.HandlerFunc
+	Export() http.HandlerFunc
 	ApplyRouter() func(chi.Router)
 }
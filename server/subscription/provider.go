@@ -3,6 +3,7 @@ package subscription
 import (
 	"sync"
 
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/repository"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/rest"
@@ -29,9 +30,9 @@ func provideRepository(db *bolt.DB) domain.Repository {
 	return repo
 }
 
-func provideService(r domain.Repository, runner task.TaskRunner) domain.Service {
+func provideService(r domain.Repository, runner task.TaskRunner, pipelines *pipeline.Store) domain.Service {
 	svcOnce.Do(func() {
-		svc = service.New(r, runner)
+		svc = service.New(r, runner, pipelines)
 	})
 	return svc
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/data"
@@ -116,6 +117,16 @@ func (s *Repository) UpdateByExample(ctx context.Context, example *data.Subscrip
 				sub.URL = example.URL
 				sub.Params = example.Params
 				sub.CronExpr = example.CronExpr
+				sub.PipelineId = example.PipelineId
+				sub.FeedURL = example.FeedURL
+				sub.OutputPath = example.OutputPath
+				sub.FilenameTemplate = example.FilenameTemplate
+				sub.TemplateId = example.TemplateId
+				sub.MaxEntries = example.MaxEntries
+				sub.BackfillCount = example.BackfillCount
+				sub.BackfillAfter = example.BackfillAfter
+				sub.Filters = example.Filters
+				sub.Retention = example.Retention
 
 				data, err := json.Marshal(sub)
 				if err != nil {
@@ -132,6 +143,67 @@ func (s *Repository) UpdateByExample(ctx context.Context, example *data.Subscrip
 	})
 }
 
+// Get implements domain.Repository.
+func (s *Repository) Get(ctx context.Context, id string) (*data.Subscription, error) {
+	var sub data.Subscription
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("subscription %s not found", id)
+		}
+		return json.Unmarshal(v, &sub)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// Disable implements domain.Repository.
+func (s *Repository) Disable(ctx context.Context, id, reason string) error {
+	return s.modify(id, func(sub *data.Subscription) {
+		sub.Disabled = true
+		sub.DisabledReason = reason
+	})
+}
+
+// Enable implements domain.Repository.
+func (s *Repository) Enable(ctx context.Context, id string) error {
+	return s.modify(id, func(sub *data.Subscription) {
+		sub.Disabled = false
+		sub.DisabledReason = ""
+		sub.EnabledAt = time.Now()
+	})
+}
+
+func (s *Repository) modify(id string, fn func(sub *data.Subscription)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+
+		v := b.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("subscription %s not found", id)
+		}
+
+		var sub data.Subscription
+		if err := json.Unmarshal(v, &sub); err != nil {
+			return err
+		}
+
+		fn(&sub)
+
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(id), data)
+	})
+}
+
 func New(db *bolt.DB) domain.Repository {
 	db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(bucketName)
@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -12,6 +15,9 @@ import (
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
 )
 
+// Larger files are rejected by the import
+const maxImportSize = 10 << 20
+
 type RestHandler struct {
 	svc domain.Service
 }
@@ -28,6 +34,12 @@ func (h *RestHandler) ApplyRouter() func(chi.Router) {
 
 		r.Delete("/{id}", h.Delete())
 		r.Get("/cursor", h.GetCursor())
+		r.Get("/export", h.Export())
+		r.Post("/import", h.Import())
+		r.Get("/{id}/runs", h.Runs())
+		r.Post("/{id}/run", h.RunNow())
+		r.Post("/{id}/enable", h.Enable())
+		r.Post("/{id}/disable", h.Disable())
 		r.Get("/", h.List())
 		r.Post("/", h.Submit())
 		r.Patch("/", h.UpdateByExample())
@@ -76,6 +88,153 @@ func (h *RestHandler) GetCursor() http.HandlerFunc {
 	}
 }
 
+// Runs implements domain.RestHandler.
+func (h *RestHandler) Runs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		res, err := h.svc.Runs(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RunNow implements domain.RestHandler.
+func (h *RestHandler) RunNow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.svc.RunNow(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Enable implements domain.RestHandler.
+func (h *RestHandler) Enable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.svc.Enable(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Disable implements domain.RestHandler.
+func (h *RestHandler) Disable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.svc.Disable(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Import implements domain.RestHandler.
+//
+// The body is the OPML or csv file, the format query parameter is detected
+// from the content type or the content itself if missing. With dry_run=true
+// the result is a preview, nothing is submitted.
+func (h *RestHandler) Import() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		q := r.URL.Query()
+
+		format := q.Get("format")
+		if format == "" {
+			switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+			case "text/csv":
+				format = domain.FormatCSV
+			case "text/x-opml", "text/xml", "application/xml":
+				format = domain.FormatOPML
+			}
+		}
+
+		dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+
+		res, err := h.svc.Import(r.Context(), http.MaxBytesReader(w, r.Body, maxImportSize), domain.ImportOptions{
+			Format:     format,
+			CronExpr:   q.Get("cron_expression"),
+			TemplateId: q.Get("template_id"),
+			DryRun:     dryRun,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Export implements domain.RestHandler.
+func (h *RestHandler) Export() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		format := cmp.Or(r.URL.Query().Get("format"), domain.FormatOPML)
+
+		var buf bytes.Buffer
+		if err := h.svc.Export(r.Context(), &buf, format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contentType := "text/x-opml"
+		if format == domain.FormatCSV {
+			contentType = "text/csv"
+		}
+
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"subscriptions."+format+"\"")
+		w.Write(buf.Bytes())
+	}
+}
+
 // List implements domain.RestHandler.
 func (h *RestHandler) List() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+// Settings of a subscription besides its url. They're the csv columns and,
+// outside of the OPML spec, the attributes of the outlines, so both formats
+// move a subscription between instances. Empty values are left to the
+// defaults.
+var fields = []struct {
+	name string
+	get  func(s *domain.Subscription) string
+	set  func(s *domain.Subscription, v string) error
+}{
+	{
+		name: "cron_expression",
+		get:  func(s *domain.Subscription) string { return s.CronExpr },
+		set:  func(s *domain.Subscription, v string) error { s.CronExpr = v; return nil },
+	},
+	{
+		name: "params",
+		get:  func(s *domain.Subscription) string { return s.Params },
+		set:  func(s *domain.Subscription, v string) error { s.Params = v; return nil },
+	},
+	{
+		name: "template_id",
+		get:  func(s *domain.Subscription) string { return s.TemplateId },
+		set:  func(s *domain.Subscription, v string) error { s.TemplateId = v; return nil },
+	},
+	{
+		name: "pipeline_id",
+		get:  func(s *domain.Subscription) string { return s.PipelineId },
+		set:  func(s *domain.Subscription, v string) error { s.PipelineId = v; return nil },
+	},
+	{
+		name: "feed_url",
+		get:  func(s *domain.Subscription) string { return s.FeedURL },
+		set:  func(s *domain.Subscription, v string) error { s.FeedURL = v; return nil },
+	},
+	{
+		name: "output_path",
+		get:  func(s *domain.Subscription) string { return s.OutputPath },
+		set:  func(s *domain.Subscription, v string) error { s.OutputPath = v; return nil },
+	},
+	{
+		name: "filename_template",
+		get:  func(s *domain.Subscription) string { return s.FilenameTemplate },
+		set:  func(s *domain.Subscription, v string) error { s.FilenameTemplate = v; return nil },
+	},
+	{
+		name: "max_entries",
+		get:  func(s *domain.Subscription) string { return itoa(s.MaxEntries) },
+		set:  func(s *domain.Subscription, v string) (err error) { s.MaxEntries, err = atoi(v); return },
+	},
+	{
+		name: "backfill_count",
+		get:  func(s *domain.Subscription) string { return itoa(s.BackfillCount) },
+		set:  func(s *domain.Subscription, v string) (err error) { s.BackfillCount, err = atoi(v); return },
+	},
+	{
+		name: "backfill_after",
+		get:  func(s *domain.Subscription) string { return s.BackfillAfter },
+		set:  func(s *domain.Subscription, v string) error { s.BackfillAfter = v; return nil },
+	},
+	{
+		// json encoded
+		name: "filters",
+		get: func(s *domain.Subscription) string {
+			if s.Filters == (domain.Filters{}) {
+				return ""
+			}
+			b, _ := json.Marshal(s.Filters)
+			return string(b)
+		},
+		set: func(s *domain.Subscription, v string) error {
+			if v == "" {
+				return nil
+			}
+			return json.Unmarshal([]byte(v), &s.Filters)
+		},
+	},
+	{
+		// json encoded
+		name: "retention",
+		get: func(s *domain.Subscription) string {
+			if s.Retention == (domain.Retention{}) {
+				return ""
+			}
+			b, _ := json.Marshal(s.Retention)
+			return string(b)
+		},
+		set: func(s *domain.Subscription, v string) error {
+			if v == "" {
+				return nil
+			}
+			return json.Unmarshal([]byte(v), &s.Retention)
+		},
+	},
+}
+
+func itoa(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func atoi(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func setField(sub *domain.Subscription, name, value string) error {
+	for _, f := range fields {
+		if f.name == name {
+			if err := f.set(sub, strings.TrimSpace(value)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+type opml struct {
+	XMLName xml.Name  `xml:"opml"`
+	Version string    `xml:"version,attr"`
+	Title   string    `xml:"head>title"`
+	Body    []outline `xml:"body>outline"`
+}
+
+// Feed readers nest the feeds in category outlines
+type outline struct {
+	Text     string     `xml:"text,attr"`
+	Title    string     `xml:"title,attr,omitempty"`
+	Type     string     `xml:"type,attr,omitempty"`
+	XMLURL   string     `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string     `xml:"htmlUrl,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Outlines []outline  `xml:"outline"`
+}
+
+// Decode the subscriptions of an OPML or csv file, the format is detected
+// if empty. The invalid entries are reported without failing the decoding.
+func decode(r io.Reader, format string) ([]domain.Subscription, []domain.ImportError, error) {
+	br := bufio.NewReader(r)
+
+	if format == "" {
+		head, _ := br.Peek(512)
+		head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\ufeff")), " \t\r\n")
+		format = domain.FormatCSV
+		if bytes.HasPrefix(head, []byte("<")) {
+			format = domain.FormatOPML
+		}
+	}
+
+	switch format {
+	case domain.FormatOPML:
+		return decodeOPML(br)
+	case domain.FormatCSV:
+		return decodeCSV(br)
+	default:
+		return nil, nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func decodeOPML(r io.Reader) ([]domain.Subscription, []domain.ImportError, error) {
+	var doc opml
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("malformed opml: %w", err)
+	}
+
+	var (
+		subs    []domain.Subscription
+		invalid []domain.ImportError
+	)
+
+	var walk func(outlines []outline)
+	walk = func(outlines []outline) {
+		for _, o := range outlines {
+			u := cmp.Or(youtubeChannelURL(o.XMLURL), o.HTMLURL, o.XMLURL)
+			if u == "" {
+				walk(o.Outlines) // category
+				continue
+			}
+
+			sub := domain.Subscription{URL: u}
+			// the feed is polled instead of listing the url with yt-dlp. The
+			// YouTube ones aren't: their entries lack what the filters need.
+			if o.XMLURL != "" && youtubeChannelURL(o.XMLURL) == "" {
+				sub.FeedURL = o.XMLURL
+			}
+
+			var errs []error
+			for _, a := range o.Attrs {
+				errs = append(errs, setField(&sub, a.Name.Local, a.Value))
+			}
+			errs = append(errs, validateURL(u))
+			if sub.FeedURL != "" {
+				errs = append(errs, validateURL(sub.FeedURL))
+			}
+
+			if err := errors.Join(errs...); err != nil {
+				invalid = append(invalid, domain.ImportError{URL: u, Error: err.Error()})
+				continue
+			}
+			subs = append(subs, sub)
+		}
+	}
+	walk(doc.Body)
+
+	return subs, invalid, nil
+}
+
+// Besides the exported files, the YouTube takeout subscriptions.csv is
+// understood: its Channel Url column, or Channel Id, is the url.
+func decodeCSV(r io.Reader) ([]domain.Subscription, []domain.ImportError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed csv: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		columns[i] = strings.ReplaceAll(h, " ", "_")
+	}
+
+	if !slices.Contains(columns, "url") &&
+		!slices.Contains(columns, "channel_url") &&
+		!slices.Contains(columns, "channel_id") {
+		return nil, nil, errors.New("the csv has neither a url nor a channel id column")
+	}
+
+	var (
+		subs    []domain.Subscription
+		invalid []domain.ImportError
+	)
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed csv: %w", err)
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		var (
+			sub       domain.Subscription
+			channelId string
+			errs      []error
+		)
+
+		for i, v := range record {
+			if i >= len(columns) {
+				break
+			}
+			switch v = strings.TrimSpace(v); columns[i] {
+			case "url", "channel_url":
+				sub.URL = cmp.Or(sub.URL, v)
+			case "channel_id":
+				channelId = v
+			default:
+				errs = append(errs, setField(&sub, columns[i], v))
+			}
+		}
+
+		if sub.URL == "" && channelId != "" {
+			sub.URL = "https://www.youtube.com/channel/" + channelId
+		}
+		errs = append(errs, validateURL(sub.URL))
+
+		if err := errors.Join(errs...); err != nil {
+			invalid = append(invalid, domain.ImportError{URL: sub.URL, Error: err.Error()})
+			continue
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, invalid, nil
+}
+
+func encode(w io.Writer, format string, subs []domain.Subscription) error {
+	slices.SortFunc(subs, func(a, b domain.Subscription) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	switch format {
+	case domain.FormatOPML:
+		return encodeOPML(w, subs)
+	case domain.FormatCSV:
+		return encodeCSV(w, subs)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func encodeOPML(w io.Writer, subs []domain.Subscription) error {
+	doc := opml{
+		Version: "2.0",
+		Title:   "yt-dlp-webui subscriptions",
+		Body:    make([]outline, len(subs)),
+	}
+
+	for i, s := range subs {
+		o := outline{
+			Text:    s.URL,
+			HTMLURL: s.URL,
+			XMLURL:  cmp.Or(s.FeedURL, youtubeFeedURL(s.URL)),
+		}
+		if o.XMLURL != "" {
+			o.Type = "rss"
+		}
+		for _, f := range fields {
+			if v := f.get(&s); v != "" {
+				o.Attrs = append(o.Attrs, xml.Attr{Name: xml.Name{Local: f.name}, Value: v})
+			}
+		}
+		doc.Body[i] = o
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func encodeCSV(w io.Writer, subs []domain.Subscription) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"url"}
+	for _, f := range fields {
+		header = append(header, f.name)
+	}
+	cw.Write(header)
+
+	for _, s := range subs {
+		record := []string{s.URL}
+		for _, f := range fields {
+			record = append(record, f.get(&s))
+		}
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http url", s)
+	}
+	return nil
+}
+
+// Channel or playlist of a YouTube feed url, empty if it isn't one
+func youtubeChannelURL(feed string) string {
+	u, err := url.Parse(feed)
+	if err != nil || !isYoutube(u) || u.Path != "/feeds/videos.xml" {
+		return ""
+	}
+
+	q := u.Query()
+
+	switch {
+	case q.Get("channel_id") != "":
+		return "https://www.youtube.com/channel/" + q.Get("channel_id")
+	case q.Get("playlist_id") != "":
+		return "https://www.youtube.com/playlist?list=" + q.Get("playlist_id")
+	case q.Get("user") != "":
+		return "https://www.youtube.com/user/" + q.Get("user")
+	default:
+		return ""
+	}
+}
+
+// Feed of a YouTube channel or playlist url, for the feed readers
+func youtubeFeedURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || !isYoutube(u) {
+		return ""
+	}
+
+	const feed = "https://www.youtube.com/feeds/videos.xml?"
+
+	if id, ok := strings.CutPrefix(u.Path, "/channel/"); ok {
+		id, _, _ = strings.Cut(id, "/")
+		return feed + url.Values{"channel_id": {id}}.Encode()
+	}
+	if u.Path == "/playlist" && u.Query().Get("list") != "" {
+		return feed + url.Values{"playlist_id": {u.Query().Get("list")}}.Encode()
+	}
+
+	return ""
+}
+
+func isYoutube(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
+// Key of a subscription url for the duplicates, regardless of the scheme,
+// the www or mobile subdomain and a trailing slash
+func normalizeURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+
+	host := strings.ToLower(u.Host)
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	key := host + strings.TrimSuffix(u.Path, "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+
+	return key
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+func urls(subs []domain.Subscription) []string {
+	u := make([]string, len(subs))
+	for i, s := range subs {
+		u[i] = s.URL
+	}
+	return u
+}
+
+func TestDecodeOPML(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.1">
+  <head><title>YouTube subscriptions</title></head>
+  <body>
+    <outline text="YouTube Subscriptions" title="YouTube Subscriptions">
+      <outline text="A channel" type="rss" xmlUrl="https://www.youtube.com/feeds/videos.xml?channel_id=UC123"/>
+      <outline text="A playlist" type="rss" xmlUrl="https://www.youtube.com/feeds/videos.xml?playlist_id=PL456"/>
+    </outline>
+    <outline text="Elsewhere" htmlUrl="https://vimeo.com/someone" cron_expression="0 * * * *" max_entries="3"/>
+    <outline text="A podcast" type="rss" htmlUrl="https://example.com/show" xmlUrl="https://example.com/show/feed.xml"/>
+    <outline text="Broken" htmlUrl="https://vimeo.com/broken" max_entries="many"/>
+  </body>
+</opml>`
+
+	subs, invalid, err := decode(strings.NewReader(doc), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"https://www.youtube.com/channel/UC123",
+		"https://www.youtube.com/playlist?list=PL456",
+		"https://vimeo.com/someone",
+		"https://example.com/show",
+	}
+	if got := urls(subs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if subs[2].CronExpr != "0 * * * *" || subs[2].MaxEntries != 3 {
+		t.Errorf("settings not decoded: %+v", subs[2])
+	}
+	// only the feeds other than YouTube are polled
+	if subs[0].FeedURL != "" || subs[3].FeedURL != "https://example.com/show/feed.xml" {
+		t.Errorf("unexpected feeds %q and %q", subs[0].FeedURL, subs[3].FeedURL)
+	}
+	if len(invalid) != 1 || invalid[0].URL != "https://vimeo.com/broken" {
+		t.Errorf("unexpected invalid entries %+v", invalid)
+	}
+}
+
+func TestDecodeTakeoutCSV(t *testing.T) {
+	const takeout = "\ufeffChannel Id,Channel Url,Channel Title\n" +
+		"UC123,http://www.youtube.com/channel/UC123,A channel\n" +
+		"\n" +
+		"UC456,,Another channel\n"
+
+	subs, invalid, err := decode(strings.NewReader(takeout), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"http://www.youtube.com/channel/UC123",
+		"https://www.youtube.com/channel/UC456",
+	}
+	if got := urls(subs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(invalid) != 0 {
+		t.Errorf("unexpected invalid entries %+v", invalid)
+	}
+
+	if _, _, err := decode(strings.NewReader("title\nfoo\n"), domain.FormatCSV); err == nil {
+		t.Error("expected an error for a csv without urls")
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	subs := []domain.Subscription{
+		{
+			URL:        "https://www.youtube.com/channel/UC123",
+			CronExpr:   "0 * * * *",
+			Params:     `-f "bv*+ba/b"`,
+			OutputPath: "/downloads/channel",
+			MaxEntries: 5,
+			Filters:    domain.Filters{TitleExclude: "(?i)trailer", ExcludeShorts: true},
+		},
+		{
+			URL:        "https://vimeo.com/someone",
+			CronExpr:   "*/5 * * * *",
+			TemplateId: "template",
+		},
+		{
+			URL:      "https://example.com/show",
+			CronExpr: "0 0 * * *",
+			FeedURL:  "https://example.com/show/feed.xml",
+		},
+	}
+
+	for _, format := range []string{domain.FormatOPML, domain.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encode(&buf, format, subs); err != nil {
+				t.Fatal(err)
+			}
+
+			got, invalid, err := decode(&buf, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(invalid) != 0 {
+				t.Fatalf("unexpected invalid entries %+v", invalid)
+			}
+
+			// sorted by url
+			want := slices.SortedFunc(slices.Values(subs), func(a, b domain.Subscription) int {
+				return strings.Compare(a.URL, b.URL)
+			})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	same := []string{
+		"https://www.youtube.com/channel/UC123",
+		"http://youtube.com/channel/UC123/",
+		"https://m.youtube.com/channel/UC123",
+	}
+
+	for _, u := range same[1:] {
+		if normalizeURL(u) != normalizeURL(same[0]) {
+			t.Errorf("%s and %s should be duplicates", u, same[0])
+		}
+	}
+
+	if normalizeURL("https://www.youtube.com/playlist?list=A") == normalizeURL("https://www.youtube.com/playlist?list=B") {
+		t.Error("different playlists are not duplicates")
+	}
+}
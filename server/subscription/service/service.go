@@ -1,10 +1,18 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"io"
+	"log/slog"
 	"math"
+	"path/filepath"
+	"slices"
+	"time"
 
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/data"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/task"
@@ -12,20 +20,31 @@ import (
 )
 
 type Service struct {
-	r      domain.Repository
-	runner task.TaskRunner
+	r         domain.Repository
+	runner    task.TaskRunner
+	pipelines *pipeline.Store
 }
 
-func New(r domain.Repository, runner task.TaskRunner) domain.Service {
+func New(r domain.Repository, runner task.TaskRunner, pipelines *pipeline.Store) domain.Service {
 	s := &Service{
-		r:      r,
-		runner: runner,
+		r:         r,
+		runner:    runner,
+		pipelines: pipelines,
 	}
 
+	runner.OnDisable(func(id, reason string) {
+		if err := r.Disable(context.Background(), id, reason); err != nil {
+			slog.Error("failed to disable subscription", slog.String("id", id), slog.Any("err", err))
+		}
+	})
+
 	// very crude recoverer
 	initial, _ := s.List(context.Background(), 0, math.MaxInt)
 	if initial != nil {
 		for _, v := range initial.Data {
+			if v.Disabled {
+				continue
+			}
 			s.runner.Submit(&v)
 		}
 	}
@@ -35,25 +54,54 @@ func New(r domain.Repository, runner task.TaskRunner) domain.Service {
 
 func fromDB(model *data.Subscription) domain.Subscription {
 	return domain.Subscription{
-		Id:       model.Id,
-		URL:      model.URL,
-		Params:   model.Params,
-		CronExpr: model.CronExpr,
+		Id:               model.Id,
+		URL:              model.URL,
+		Params:           model.Params,
+		CronExpr:         model.CronExpr,
+		PipelineId:       model.PipelineId,
+		FeedURL:          model.FeedURL,
+		OutputPath:       model.OutputPath,
+		FilenameTemplate: model.FilenameTemplate,
+		TemplateId:       model.TemplateId,
+		MaxEntries:       model.MaxEntries,
+		BackfillCount:    model.BackfillCount,
+		BackfillAfter:    model.BackfillAfter,
+		Filters:          domain.Filters(model.Filters),
+		Retention:        domain.Retention(model.Retention),
+		Disabled:         model.Disabled,
+		DisabledReason:   model.DisabledReason,
+		EnabledAt:        model.EnabledAt,
 	}
 }
 
 func toDB(dto *domain.Subscription) data.Subscription {
 	return data.Subscription{
-		Id:       dto.Id,
-		URL:      dto.URL,
-		Params:   dto.Params,
-		CronExpr: dto.CronExpr,
+		Id:               dto.Id,
+		URL:              dto.URL,
+		Params:           dto.Params,
+		CronExpr:         dto.CronExpr,
+		PipelineId:       dto.PipelineId,
+		FeedURL:          dto.FeedURL,
+		OutputPath:       dto.OutputPath,
+		FilenameTemplate: dto.FilenameTemplate,
+		TemplateId:       dto.TemplateId,
+		MaxEntries:       dto.MaxEntries,
+		BackfillCount:    dto.BackfillCount,
+		BackfillAfter:    dto.BackfillAfter,
+		Filters:          data.Filters(dto.Filters),
+		Retention:        data.Retention(dto.Retention),
+		Disabled:         dto.Disabled,
+		DisabledReason:   dto.DisabledReason,
+		EnabledAt:        dto.EnabledAt,
 	}
 }
 
 // Delete implements domain.Service.
 func (s *Service) Delete(ctx context.Context, id string) error {
 	s.runner.StopTask(id)
+	if err := s.runner.Forget(id); err != nil {
+		return err
+	}
 	return s.r.Delete(ctx, id)
 }
 
@@ -62,6 +110,24 @@ func (s *Service) GetCursor(ctx context.Context, id string) (int64, error) {
 	return s.r.GetCursor(ctx, id)
 }
 
+// Runs implements domain.Service.
+func (s *Service) Runs(ctx context.Context, id string) (*domain.RunHistory, error) {
+	runs, err := s.runner.Runs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.RunHistory{
+		NextRun: s.runner.NextRun(id),
+		Runs:    runs,
+	}, nil
+}
+
+// RunNow implements domain.Service.
+func (s *Service) RunNow(ctx context.Context, id string) error {
+	return s.runner.RunNow(id)
+}
+
 // List implements domain.Service.
 func (s *Service) List(ctx context.Context, start int64, limit int) (
 	*domain.PaginatedResponse[[]domain.Subscription],
@@ -104,28 +170,191 @@ func (s *Service) List(ctx context.Context, start int64, limit int) (
 
 // Submit implements domain.Service.
 func (s *Service) Submit(ctx context.Context, sub *domain.Subscription) (*domain.Subscription, error) {
-	if sub.CronExpr == "" {
-		sub.CronExpr = "*/5 * * * *"
-	}
-
-	_, err := cron.ParseStandard(sub.CronExpr)
-	if err != nil {
-		return nil, errors.Join(errors.New("failed parsing cron expression"), err)
+	if err := s.prepare(sub); err != nil {
+		return nil, err
 	}
 
 	subDB, err := s.r.Submit(ctx, &data.Subscription{
-		URL:      sub.URL,
-		Params:   sub.Params,
-		CronExpr: sub.CronExpr,
+		URL:              sub.URL,
+		Params:           sub.Params,
+		CronExpr:         sub.CronExpr,
+		PipelineId:       sub.PipelineId,
+		FeedURL:          sub.FeedURL,
+		OutputPath:       sub.OutputPath,
+		FilenameTemplate: sub.FilenameTemplate,
+		TemplateId:       sub.TemplateId,
+		MaxEntries:       sub.MaxEntries,
+		BackfillCount:    sub.BackfillCount,
+		BackfillAfter:    sub.BackfillAfter,
+		Filters:          data.Filters(sub.Filters),
+		Retention:        data.Retention(sub.Retention),
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	retval := fromDB(subDB)
 
-	if err := s.runner.Submit(sub); err != nil {
+	// the runner tracks the seen entries by id
+	if err := s.runner.Submit(&retval); err != nil {
+		return nil, err
+	}
+
+	return &retval, nil
+}
+
+// Enable implements domain.Service.
+func (s *Service) Enable(ctx context.Context, id string) error {
+	if err := s.r.Enable(ctx, id); err != nil {
+		return err
+	}
+
+	subDB, err := s.r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	sub := fromDB(subDB)
+	return s.runner.Submit(&sub)
+}
+
+// Disable implements domain.Service.
+func (s *Service) Disable(ctx context.Context, id string) error {
+	if err := s.r.Disable(ctx, id, "disabled by the user"); err != nil {
+		return err
+	}
+	return s.runner.StopTask(id)
+}
+
+// Import implements domain.Service.
+func (s *Service) Import(ctx context.Context, r io.Reader, opts domain.ImportOptions) (*domain.ImportResult, error) {
+	subs, invalid, err := decode(r, opts.Format)
+	if err != nil {
 		return nil, err
 	}
 
-	return &retval, err
+	existing, err := s.r.List(ctx, 0, math.MaxInt)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := make(map[string]bool, len(*existing))
+	for _, sub := range *existing {
+		subscribed[normalizeURL(sub.URL)] = true
+	}
+
+	res := &domain.ImportResult{
+		DryRun:     opts.DryRun,
+		Imported:   []domain.Subscription{},
+		Duplicates: []string{},
+		Invalid:    slices.Concat([]domain.ImportError{}, invalid),
+	}
+
+	for _, sub := range subs {
+		key := normalizeURL(sub.URL)
+		if subscribed[key] {
+			res.Duplicates = append(res.Duplicates, sub.URL)
+			continue
+		}
+
+		sub.CronExpr = cmp.Or(sub.CronExpr, opts.CronExpr)
+		sub.TemplateId = cmp.Or(sub.TemplateId, opts.TemplateId)
+
+		if opts.DryRun {
+			err = s.prepare(&sub)
+		} else {
+			var created *domain.Subscription
+			if created, err = s.Submit(ctx, &sub); err == nil {
+				sub = *created
+			}
+		}
+		if err != nil {
+			res.Invalid = append(res.Invalid, domain.ImportError{URL: sub.URL, Error: err.Error()})
+			continue
+		}
+
+		subscribed[key] = true
+		res.Imported = append(res.Imported, sub)
+	}
+
+	return res, nil
+}
+
+// Export implements domain.Service.
+func (s *Service) Export(ctx context.Context, w io.Writer, format string) error {
+	dbSubs, err := s.r.List(ctx, 0, math.MaxInt)
+	if err != nil {
+		return err
+	}
+
+	subs := make([]domain.Subscription, len(*dbSubs))
+	for i, v := range *dbSubs {
+		subs[i] = fromDB(&v)
+	}
+
+	return encode(w, format, subs)
+}
+
+// Default the cron expression and validate a new subscription
+func (s *Service) prepare(sub *domain.Subscription) error {
+	if sub.CronExpr == "" {
+		sub.CronExpr = "*/5 * * * *"
+	}
+
+	if _, err := cron.ParseStandard(sub.CronExpr); err != nil {
+		return errors.Join(errors.New("failed parsing cron expression"), err)
+	}
+
+	return s.validate(sub)
+}
+
+func (s *Service) validate(sub *domain.Subscription) error {
+	if _, err := s.pipelines.Resolve(sub.PipelineId); err != nil {
+		return err
+	}
+
+	if sub.FeedURL != "" {
+		if err := validateURL(sub.FeedURL); err != nil {
+			return errors.Join(errors.New("invalid feed_url"), err)
+		}
+
+		// the feed entries have neither a media type nor a duration, these
+		// filters would let everything through
+		f := sub.Filters
+		if f.ExcludeShorts || f.ExcludeLive || f.MinDuration > 0 || f.MaxDuration > 0 {
+			return errors.New("exclude_shorts, exclude_live, min_duration and max_duration can't be used with a feed_url")
+		}
+	}
+
+	if sub.OutputPath != "" {
+		if err := internal.ValidateSubPath(sub.OutputPath); err != nil {
+			return err
+		}
+	}
+
+	if sub.FilenameTemplate != "" && !filepath.IsLocal(sub.FilenameTemplate) {
+		return errors.New("the filename template must be relative to the output path")
+	}
+
+	if sub.MaxEntries < 0 || sub.BackfillCount < 0 {
+		return errors.New("max_entries and backfill_count must not be negative")
+	}
+
+	if sub.BackfillCount > 0 && sub.BackfillAfter != "" {
+		return errors.New("backfill_count and backfill_after are mutually exclusive")
+	}
+
+	if sub.BackfillAfter != "" {
+		if _, err := time.Parse(time.DateOnly, sub.BackfillAfter); err != nil {
+			return errors.Join(errors.New("backfill_after must be formatted as YYYY-MM-DD"), err)
+		}
+	}
+
+	if sub.Retention.KeepLast < 0 || sub.Retention.MaxAge < 0 {
+		return errors.New("keep_last and max_age must not be negative")
+	}
+
+	return task.ValidateFilters(sub.Filters)
 }
 
 // UpdateByExample implements domain.Service.
@@ -135,7 +364,31 @@ func (s *Service) UpdateByExample(ctx context.Context, example *domain.Subscript
 		return errors.Join(errors.New("failed parsing cron expression"), err)
 	}
 
+	if err := s.validate(example); err != nil {
+		return err
+	}
+
 	e := toDB(example)
 
-	return s.r.UpdateByExample(ctx, &e)
+	if err := s.r.UpdateByExample(ctx, &e); err != nil {
+		return err
+	}
+
+	// reschedule the updated subscriptions, the running tasks are replaced
+	updated, err := s.r.List(ctx, 0, math.MaxInt)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range *updated {
+		if (v.Id != example.Id && v.URL != example.URL) || v.Disabled {
+			continue
+		}
+		sub := fromDB(&v)
+		if err := s.runner.Submit(&sub); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+func TestValidateFeedFilters(t *testing.T) {
+	tests := []struct {
+		filters domain.Filters
+		valid   bool
+	}{
+		{domain.Filters{TitleExclude: "(?i)trailer", UploadedAfter: "2024-01-01"}, true},
+		{domain.Filters{ExcludeShorts: true}, false},
+		{domain.Filters{ExcludeLive: true}, false},
+		{domain.Filters{MinDuration: 60}, false},
+		{domain.Filters{MaxDuration: 3600}, false},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		sub := domain.Subscription{
+			URL:     "https://example.com/show",
+			FeedURL: "https://example.com/show/feed.xml",
+			Filters: tt.filters,
+		}
+		if err := s.validate(&sub); (err == nil) != tt.valid {
+			t.Errorf("%+v: unexpected error %v", tt.filters, err)
+		}
+
+		// listed with yt-dlp, the entries have the metadata
+		sub.FeedURL = ""
+		if err := s.validate(&sub); err != nil {
+			t.Errorf("%+v without a feed: %v", tt.filters, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package task
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Validators of the last feed response of each subscription, keyed by the
+// subscription id, sent back as a conditional GET.
+var feedsBucket = []byte("subscriptions-feeds")
+
+// Larger feeds are rejected
+const maxFeedSize = 10 << 20
+
+type feedState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+type feedStore struct {
+	db     *bolt.DB
+	client *http.Client
+}
+
+func newFeedStore(db *bolt.DB) feedStore {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(feedsBucket)
+		return err
+	})
+
+	return feedStore{
+		db:     db,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s feedStore) get(subscriptionId string) (feedState, error) {
+	var state feedState
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(feedsBucket).Get([]byte(subscriptionId))
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &state)
+	})
+
+	return state, err
+}
+
+func (s feedStore) save(subscriptionId string, state feedState) error {
+	v, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(feedsBucket).Put([]byte(subscriptionId), v)
+	})
+}
+
+func (s feedStore) forget(subscriptionId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(feedsBucket).Delete([]byte(subscriptionId))
+	})
+}
+
+// Fetch the entries of the feed, newest first. A feed not modified since the
+// last poll has no entries and a nil state, otherwise the returned state has
+// to be saved once the entries are handled.
+func (s feedStore) poll(ctx context.Context, subscriptionId, feedURL string) ([]entry, *feedState, error) {
+	last, err := s.get(subscriptionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/atom+xml, application/rss+xml, application/xml;q=0.9, */*;q=0.8")
+
+	// the validators belong to the url they were received from
+	if last.URL == feedURL {
+		if last.ETag != "" {
+			req.Header.Set("If-None-Match", last.ETag)
+		}
+		if last.LastModified != "" {
+			req.Header.Set("If-Modified-Since", last.LastModified)
+		}
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		return nil, nil, nil
+	case res.StatusCode != http.StatusOK:
+		return nil, nil, fmt.Errorf("feed %s: %s", feedURL, res.Status)
+	}
+
+	entries, err := parseFeed(io.LimitReader(res.Body, maxFeedSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("feed %s: %w", feedURL, err)
+	}
+
+	return entries, &feedState{
+		URL:          feedURL,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Id        string     `xml:"id"`
+	VideoId   string     `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type rssItem struct {
+	Guid      string `xml:"guid"`
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+// Atom (YouTube channel and playlist feeds) or RSS 2.0 (podcasts, most sites)
+type feedDocument struct {
+	XMLName xml.Name
+	Entries []atomEntry `xml:"entry"`
+	Items   []rssItem   `xml:"channel>item"`
+}
+
+func parseFeed(r io.Reader) ([]entry, error) {
+	var doc feedDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+
+	switch doc.XMLName.Local {
+	case "feed":
+		for _, e := range doc.Entries {
+			link := ""
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+
+			fe := entry{
+				id:         cmp.Or(e.VideoId, e.Id, link),
+				url:        link,
+				title:      strings.TrimSpace(e.Title),
+				uploadDate: feedDate(cmp.Or(e.Published, e.Updated)),
+			}
+			if e.VideoId != "" {
+				fe.extractor = "youtube"
+			}
+			entries = append(entries, fe)
+		}
+	case "rss":
+		for _, i := range doc.Items {
+			// podcasts link to the episode page, the enclosure is the media
+			link := cmp.Or(strings.TrimSpace(i.Enclosure.URL), strings.TrimSpace(i.Link))
+
+			entries = append(entries, entry{
+				id:         cmp.Or(strings.TrimSpace(i.Guid), link),
+				url:        link,
+				title:      strings.TrimSpace(i.Title),
+				uploadDate: feedDate(i.PubDate),
+			})
+		}
+	default:
+		return nil, errors.New("neither an atom nor an rss feed")
+	}
+
+	entries = slices.DeleteFunc(entries, func(e entry) bool {
+		return e.id == "" || e.url == ""
+	})
+
+	// newest first, like the playlists listed by yt-dlp
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return strings.Compare(b.uploadDate, a.uploadDate)
+	})
+
+	return entries, nil
+}
+
+// Date of a feed entry as YYYYMMDD, empty if it can't be parsed
+func feedDate(s string) string {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range []string{
+		time.RFC3339,
+		time.RFC1123Z,
+		time.RFC1123,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format(uploadDateLayout)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,261 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const atomEntryFixture = `
+  <entry>
+    <id>yt:video:%[1]s</id>
+    <yt:videoId>%[1]s</yt:videoId>
+    <title>Video %[1]s</title>
+    <link rel="alternate" href="https://www.youtube.com/watch?v=%[1]s"/>
+    <published>%[2]s</published>
+  </entry>`
+
+func atomFixture(entries ...[2]string) string {
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns="http://www.w3.org/2005/Atom">
+  <title>A channel</title>`)
+	for _, e := range entries {
+		fmt.Fprintf(&b, atomEntryFixture, e[0], e[1])
+	}
+	b.WriteString("\n</feed>")
+
+	return b.String()
+}
+
+const rssFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>A podcast</title>
+    <item>
+      <title>Episode 1</title>
+      <guid>episode-1</guid>
+      <link>https://example.com/episodes/1</link>
+      <pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+      <enclosure url="https://cdn.example.com/1.mp3" type="audio/mpeg" length="1"/>
+    </item>
+    <item>
+      <title>Episode 2</title>
+      <guid>episode-2</guid>
+      <link>https://example.com/episodes/2</link>
+      <pubDate>Mon, 09 Jan 2006 15:04:05 -0700</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseFeed(t *testing.T) {
+	atom, err := parseFeed(strings.NewReader(atomFixture(
+		[2]string{"older", "2024-01-01T10:00:00+00:00"},
+		[2]string{"newer", "2024-02-01T10:00:00+00:00"},
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []entry{
+		{id: "newer", extractor: "youtube", uploadDate: "20240201", url: "https://www.youtube.com/watch?v=newer", title: "Video newer"},
+		{id: "older", extractor: "youtube", uploadDate: "20240101", url: "https://www.youtube.com/watch?v=older", title: "Video older"},
+	}
+	if fmt.Sprint(atom) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", atom, want)
+	}
+
+	rss, err := parseFeed(strings.NewReader(rssFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []entry{
+		{id: "episode-2", uploadDate: "20060109", url: "https://example.com/episodes/2", title: "Episode 2"},
+		{id: "episode-1", uploadDate: "20060102", url: "https://cdn.example.com/1.mp3", title: "Episode 1"},
+	}
+	if fmt.Sprint(rss) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", rss, want)
+	}
+
+	if _, err := parseFeed(strings.NewReader(`<html></html>`)); err == nil {
+		t.Error("expected an error for a document that isn't a feed")
+	}
+}
+
+// Serves a feed with an ETag or a Last-Modified date, answering the
+// conditional requests with 304
+type feedServer struct {
+	mu           sync.Mutex
+	body         string
+	etag         string
+	lastModified string
+	requests     int
+	notModified  int
+}
+
+func (f *feedServer) set(body, etag, lastModified string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.body, f.etag, f.lastModified = body, etag, lastModified
+}
+
+func (f *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+
+	if (f.etag != "" && r.Header.Get("If-None-Match") == f.etag) ||
+		(f.lastModified != "" && r.Header.Get("If-Modified-Since") == f.lastModified) {
+		f.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if f.etag != "" {
+		w.Header().Set("ETag", f.etag)
+	}
+	if f.lastModified != "" {
+		w.Header().Set("Last-Modified", f.lastModified)
+	}
+	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Write([]byte(f.body))
+}
+
+func openTestDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestFeedPoll(t *testing.T) {
+	fs := &feedServer{}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+
+	feeds := newFeedStore(openTestDB(t))
+
+	for _, validator := range []string{"etag", "last-modified"} {
+		t.Run(validator, func(t *testing.T) {
+			etag, lastModified := `"v1"`, ""
+			if validator == "last-modified" {
+				etag, lastModified = "", "Mon, 01 Jan 2024 10:00:00 GMT"
+			}
+			fs.set(rssFixture, etag, lastModified)
+
+			entries, state, err := feeds.poll(context.Background(), validator, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 || state == nil {
+				t.Fatalf("expected the feed, got %d entries and state %v", len(entries), state)
+			}
+
+			// nothing is sent back until the state is saved
+			if _, state, _ := feeds.poll(context.Background(), validator, srv.URL); state == nil {
+				t.Fatal("unexpected conditional request before saving the state")
+			}
+
+			if err := feeds.save(validator, *state); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, state, err = feeds.poll(context.Background(), validator, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries != nil || state != nil {
+				t.Fatalf("expected the feed not to be modified, got %d entries", len(entries))
+			}
+		})
+	}
+
+	if fs.notModified != 2 {
+		t.Errorf("expected 2 not modified responses, got %d", fs.notModified)
+	}
+}
+
+func TestFetchFeed(t *testing.T) {
+	// yt-dlp must not be spawned
+	config.Instance().Paths.DownloaderPath = filepath.Join(t.TempDir(), "yt-dlp")
+
+	runner := newTestRunner(t)
+
+	fs := &feedServer{}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+
+	sub := &domain.Subscription{
+		Id:      "feed",
+		URL:     "https://www.youtube.com/channel/UC123",
+		FeedURL: srv.URL,
+	}
+
+	runs := []struct {
+		name   string
+		feed   string
+		etag   string
+		queued int
+	}{
+		{
+			// only the latest entry without a backfill
+			name: "first",
+			feed: atomFixture(
+				[2]string{"b", "2024-02-01T10:00:00+00:00"},
+				[2]string{"a", "2024-01-01T10:00:00+00:00"},
+			),
+			etag:   `"v1"`,
+			queued: 1,
+		},
+		{
+			name: "not modified",
+			feed: atomFixture(
+				[2]string{"b", "2024-02-01T10:00:00+00:00"},
+				[2]string{"a", "2024-01-01T10:00:00+00:00"},
+			),
+			etag:   `"v1"`,
+			queued: 0,
+		},
+		{
+			name: "new entry",
+			feed: atomFixture(
+				[2]string{"c", "2024-03-01T10:00:00+00:00"},
+				[2]string{"b", "2024-02-01T10:00:00+00:00"},
+				[2]string{"a", "2024-01-01T10:00:00+00:00"},
+			),
+			etag:   `"v2"`,
+			queued: 1,
+		},
+	}
+
+	for _, tt := range runs {
+		fs.set(tt.feed, tt.etag, "")
+
+		var run domain.Run
+		if err := runner.fetch(context.Background(), sub, &run); err != nil {
+			t.Fatalf("%s run: %v", tt.name, err)
+		}
+		if run.Queued != tt.queued {
+			t.Errorf("%s run: queued %d, want %d", tt.name, run.Queued, tt.queued)
+		}
+	}
+
+	if fs.requests != len(runs) || fs.notModified != 1 {
+		t.Errorf("got %d requests and %d not modified responses", fs.requests, fs.notModified)
+	}
+}
@@ -0,0 +1,194 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Downloads queued by the subscriptions and not completed yet, keyed by
+	// the download id, the value is the subscription id
+	pendingBucket = []byte("subscriptions-downloads")
+	// Files downloaded by each subscription, a nested bucket for each of
+	// them keyed by the absolute path of the file
+	filesBucket = []byte("subscriptions-files")
+)
+
+type trackedFile struct {
+	Path       string    `json:"-"`
+	Downloaded time.Time `json:"downloaded"`
+	Watched    bool      `json:"watched,omitempty"`
+}
+
+type fileStore struct {
+	db *bolt.DB
+}
+
+func newFileStore(db *bolt.DB) fileStore {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(pendingBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(filesBucket)
+		return err
+	})
+
+	return fileStore{db: db}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func (s fileStore) queued(subscriptionId, downloadId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Put([]byte(downloadId), []byte(subscriptionId))
+	})
+}
+
+// Track the file of a completed download, downloads not queued by a
+// subscription are ignored
+func (s fileStore) completed(downloadId, path string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(pendingBucket)
+
+		subscriptionId := pending.Get([]byte(downloadId))
+		if subscriptionId == nil {
+			return nil
+		}
+		// copied, the value is valid only until the deletion
+		b, err := tx.Bucket(filesBucket).CreateBucketIfNotExists(slices.Clone(subscriptionId))
+		if err != nil {
+			return err
+		}
+		if err := pending.Delete([]byte(downloadId)); err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(trackedFile{Downloaded: time.Now()})
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(absPath(path)), v)
+	})
+}
+
+// Mark the file as watched, whichever subscription downloaded it
+func (s fileStore) watched(path string) error {
+	key := []byte(absPath(path))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(filesBucket).Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v != nil {
+				continue // not a nested bucket
+			}
+
+			b := tx.Bucket(filesBucket).Bucket(k)
+
+			v := b.Get(key)
+			if v == nil {
+				continue
+			}
+
+			var f trackedFile
+			if err := json.Unmarshal(v, &f); err != nil {
+				return err
+			}
+			if f.Watched {
+				return nil
+			}
+			f.Watched = true
+
+			v, err := json.Marshal(f)
+			if err != nil {
+				return err
+			}
+			return b.Put(key, v)
+		}
+
+		return nil
+	})
+}
+
+// Files of a subscription, newest first
+func (s fileStore) list(subscriptionId string) ([]trackedFile, error) {
+	var files []trackedFile
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket).Bucket([]byte(subscriptionId))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var f trackedFile
+			if err := json.Unmarshal(v, &f); err != nil {
+				return err
+			}
+			f.Path = string(k)
+			files = append(files, f)
+			return nil
+		})
+	})
+
+	slices.SortStableFunc(files, func(a, b trackedFile) int {
+		return b.Downloaded.Compare(a.Downloaded)
+	})
+
+	return files, err
+}
+
+func (s fileStore) remove(subscriptionId string, paths ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket).Bucket([]byte(subscriptionId))
+		if b == nil {
+			return nil
+		}
+
+		for _, path := range paths {
+			if err := b.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Stop tracking the files of a deleted subscription, they're kept on disk
+func (s fileStore) forget(subscriptionId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(pendingBucket)
+
+		var downloads [][]byte
+		pending.ForEach(func(k, v []byte) error {
+			if string(v) == subscriptionId {
+				downloads = append(downloads, slices.Clone(k))
+			}
+			return nil
+		})
+		for _, k := range downloads {
+			if err := pending.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		err := tx.Bucket(filesBucket).DeleteBucket([]byte(subscriptionId))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,119 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+// uploadDateLayout is the yt-dlp upload_date format
+const uploadDateLayout = "20060102"
+
+type compiledFilters struct {
+	domain.Filters
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	after   string // YYYYMMDD
+	before  string // YYYYMMDD
+}
+
+func ValidateFilters(f domain.Filters) error {
+	_, err := compileFilters(f)
+	return err
+}
+
+func compileFilters(f domain.Filters) (*compiledFilters, error) {
+	c := &compiledFilters{Filters: f}
+
+	var err error
+
+	if f.TitleInclude != "" {
+		if c.include, err = regexp.Compile(f.TitleInclude); err != nil {
+			return nil, fmt.Errorf("title_include: %w", err)
+		}
+	}
+
+	if f.TitleExclude != "" {
+		if c.exclude, err = regexp.Compile(f.TitleExclude); err != nil {
+			return nil, fmt.Errorf("title_exclude: %w", err)
+		}
+	}
+
+	if f.MinDuration < 0 || f.MaxDuration < 0 || f.MaxAge < 0 {
+		return nil, errors.New("min_duration, max_duration and max_age must not be negative")
+	}
+
+	if f.MaxDuration > 0 && f.MinDuration > f.MaxDuration {
+		return nil, errors.New("min_duration is greater than max_duration")
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *string
+	}{
+		{"uploaded_after", f.UploadedAfter, &c.after},
+		{"uploaded_before", f.UploadedBefore, &c.before},
+	} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, d.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be formatted as YYYY-MM-DD: %w", d.name, err)
+		}
+		*d.dst = t.Format(uploadDateLayout)
+	}
+
+	if c.after != "" && c.before != "" && c.after > c.before {
+		return nil, errors.New("uploaded_after is later than uploaded_before")
+	}
+
+	return c, nil
+}
+
+// Why e has to be skipped, empty if it passes the filters
+func (c *compiledFilters) skip(e entry, now time.Time) string {
+	if c.include != nil && e.title != "" && !c.include.MatchString(e.title) {
+		return "title doesn't match " + c.TitleInclude
+	}
+
+	if c.exclude != nil && e.title != "" && c.exclude.MatchString(e.title) {
+		return "title matches " + c.TitleExclude
+	}
+
+	if c.ExcludeShorts && (e.mediaType == "short" || strings.Contains(e.url, "/shorts/")) {
+		return "short"
+	}
+
+	if c.ExcludeLive && (e.mediaType == "livestream" || e.liveStatus == "was_live" || e.liveStatus == "post_live") {
+		return "livestream replay"
+	}
+
+	if e.duration > 0 {
+		if c.MinDuration > 0 && e.duration < float64(c.MinDuration) {
+			return fmt.Sprintf("shorter than %ds", c.MinDuration)
+		}
+		if c.MaxDuration > 0 && e.duration > float64(c.MaxDuration) {
+			return fmt.Sprintf("longer than %ds", c.MaxDuration)
+		}
+	}
+
+	if e.uploadDate != "" {
+		if c.after != "" && e.uploadDate < c.after {
+			return "uploaded before " + c.UploadedAfter
+		}
+		if c.before != "" && e.uploadDate > c.before {
+			return "uploaded after " + c.UploadedBefore
+		}
+		if c.MaxAge > 0 && e.uploadDate < now.AddDate(0, 0, -c.MaxAge).Format(uploadDateLayout) {
+			return fmt.Sprintf("older than %d days", c.MaxAge)
+		}
+	}
+
+	return ""
+}
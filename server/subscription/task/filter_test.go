@@ -0,0 +1,74 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+func TestFilters(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	video := entry{
+		id:         "abc",
+		url:        "https://www.youtube.com/watch?v=abc",
+		title:      "Weekly update #12",
+		duration:   600,
+		uploadDate: "20240615",
+	}
+
+	tests := []struct {
+		name    string
+		filters domain.Filters
+		entry   entry
+		skipped bool
+	}{
+		{"no filters", domain.Filters{}, video, false},
+		{"title included", domain.Filters{TitleInclude: `(?i)weekly`}, video, false},
+		{"title not included", domain.Filters{TitleInclude: `(?i)podcast`}, video, true},
+		{"title excluded", domain.Filters{TitleExclude: `#\d+`}, video, true},
+		{"too short", domain.Filters{MinDuration: 900}, video, true},
+		{"too long", domain.Filters{MaxDuration: 300}, video, true},
+		{"unknown duration", domain.Filters{MinDuration: 900}, entry{id: "x", url: "https://y/x"}, false},
+		{"short by url", domain.Filters{ExcludeShorts: true}, entry{id: "x", url: "https://www.youtube.com/shorts/x"}, true},
+		{"short by media type", domain.Filters{ExcludeShorts: true}, entry{id: "x", url: "https://y/x", mediaType: "short"}, true},
+		{"live replay", domain.Filters{ExcludeLive: true}, entry{id: "x", url: "https://y/x", liveStatus: "was_live"}, true},
+		{"not a live replay", domain.Filters{ExcludeLive: true}, video, false},
+		{"uploaded too early", domain.Filters{UploadedAfter: "2024-06-20"}, video, true},
+		{"uploaded too late", domain.Filters{UploadedBefore: "2024-06-10"}, video, true},
+		{"inside the window", domain.Filters{UploadedAfter: "2024-06-01", UploadedBefore: "2024-06-15"}, video, false},
+		{"too old", domain.Filters{MaxAge: 7}, video, true},
+		{"recent enough", domain.Filters{MaxAge: 30}, video, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileFilters(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reason := c.skip(tt.entry, now)
+			if (reason != "") != tt.skipped {
+				t.Errorf("skipped = %q, want skipped %v", reason, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	invalid := []domain.Filters{
+		{TitleInclude: "("},
+		{MinDuration: 600, MaxDuration: 60},
+		{UploadedAfter: "15/06/2024"},
+		{UploadedAfter: "2024-06-15", UploadedBefore: "2024-06-01"},
+		{MaxAge: -1},
+	}
+
+	for _, f := range invalid {
+		if err := ValidateFilters(f); err == nil {
+			t.Errorf("%+v: expected an error", f)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+const defaultRetentionInterval = time.Hour
+
+// Track the file of a download queued by a subscription
+func (t *CronTaskRunner) downloaded(d downloaders.Downloader) {
+	path := d.Status().Output.SavedFilePath
+	if path == "" {
+		return
+	}
+
+	if err := t.files.completed(d.GetId(), path); err != nil {
+		slog.Error("failed to track the subscription download", slog.String("path", path), slog.Any("err", err))
+	}
+	// downloaded again, it's not watched anymore
+	t.marked.Delete(absPath(path))
+}
+
+// Mark a served file as watched, once per file. It's called by the file
+// browser once the file has been read up to its end, a player seeking back
+// reads the last range again.
+func (t *CronTaskRunner) watched(path string) {
+	key := absPath(path)
+	if _, ok := t.marked.LoadOrStore(key, struct{}{}); ok {
+		return
+	}
+
+	go func() {
+		if err := t.files.watched(key); err != nil {
+			t.marked.Delete(key)
+			slog.Error("failed to mark the file as watched", slog.String("path", path), slog.Any("err", err))
+		}
+	}()
+}
+
+// Periodically enforce the retention of the scheduled subscriptions
+func (t *CronTaskRunner) Janitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.Warn("invalid subscriptions retention interval, using the default one", slog.Duration("interval", interval))
+		interval = defaultRetentionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		subs := make([]*domain.Subscription, 0, len(t.running))
+		for _, task := range t.running {
+			subs = append(subs, task.Subscription)
+		}
+		t.mu.Unlock()
+
+		for _, sub := range subs {
+			if sub.Retention != (domain.Retention{}) {
+				t.retain(sub)
+			}
+		}
+	}
+}
+
+// Delete the expired files of the subscription and record the deletion as a run
+func (t *CronTaskRunner) retain(sub *domain.Subscription) {
+	files, err := t.files.list(sub.Id)
+	if err != nil {
+		slog.Error("failed to list the subscription files", slog.String("url", sub.URL), slog.Any("err", err))
+		return
+	}
+
+	expired := expiredFiles(files, sub.Retention, time.Now())
+	if len(expired) == 0 {
+		return
+	}
+
+	run := domain.Run{Kind: domain.RunKindRetention, Start: time.Now()}
+
+	var (
+		errs    []error
+		removed []string
+	)
+
+	for _, f := range expired {
+		deleted, err := removeWithSidecars(f.Path)
+		run.Deleted = append(run.Deleted, deleted...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, f.Path)
+	}
+
+	errs = append(errs, t.files.remove(sub.Id, removed...))
+
+	run.End = time.Now()
+	if err := errors.Join(errs...); err != nil {
+		run.Error = err.Error()
+		slog.Error("subscription retention failed", slog.String("url", sub.URL), slog.Any("err", err))
+	}
+
+	slog.Info(
+		"subscription retention",
+		slog.String("url", sub.URL),
+		slog.Int("deleted", len(run.Deleted)),
+	)
+
+	if err := t.runs.add(sub.Id, run); err != nil {
+		slog.Error("failed to save the subscription run", slog.String("url", sub.URL), slog.Any("err", err))
+	}
+}
+
+// Files expired by any of the rules, files must be sorted newest first
+func expiredFiles(files []trackedFile, r domain.Retention, now time.Time) []trackedFile {
+	var expired []trackedFile
+
+	for i, f := range files {
+		switch {
+		case r.KeepLast > 0 && i >= r.KeepLast:
+		case r.MaxAge > 0 && f.Downloaded.Before(now.AddDate(0, 0, -r.MaxAge)):
+		case r.KeepUnwatched && f.Watched:
+		default:
+			continue
+		}
+		expired = append(expired, f)
+	}
+
+	return expired
+}
+
+var (
+	sidecarExts  = []string{"jpg", "png", "webp", "vtt", "srt", "ass", "info.json", "chat.jsonl"}
+	subtitleExts = []string{"vtt", "srt", "ass"}
+	subtitleLang = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+)
+
+// Whether name is a sidecar of the file with the given stem: a thumbnail,
+// a subtitle (also with a language, e.g. "<stem>.en.vtt"), the info json or
+// the chat. Files merely sharing the stem as prefix ("<stem>. Part 2.mp4")
+// aren't.
+func isSidecar(name, stem string) bool {
+	ext, ok := strings.CutPrefix(name, stem+".")
+	if !ok {
+		return false
+	}
+	if slices.Contains(sidecarExts, ext) {
+		return true
+	}
+
+	lang, ext, ok := strings.Cut(ext, ".")
+	return ok && subtitleLang.MatchString(lang) && slices.Contains(subtitleExts, ext)
+}
+
+// Remove a downloaded file along with its sidecars, see isSidecar. A missing
+// file isn't an error. Returns the removed paths.
+func removeWithSidecars(path string) ([]string, error) {
+	var (
+		dir  = filepath.Dir(path)
+		base = filepath.Base(path)
+		stem = strings.TrimSuffix(base, filepath.Ext(base))
+	)
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		removed []string
+		errs    []error
+	)
+
+	for _, e := range entries {
+		if e.IsDir() || (e.Name() != base && !isSidecar(e.Name(), stem)) {
+			continue
+		}
+
+		p := filepath.Join(dir, e.Name())
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, p)
+	}
+
+	return removed, errors.Join(errs...)
+}
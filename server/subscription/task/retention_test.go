@@ -0,0 +1,124 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+)
+
+func TestExpiredFiles(t *testing.T) {
+	now := time.Now()
+
+	// newest first
+	files := []trackedFile{
+		{Path: "d", Downloaded: now.Add(-time.Hour)},
+		{Path: "c", Downloaded: now.AddDate(0, 0, -2), Watched: true},
+		{Path: "b", Downloaded: now.AddDate(0, 0, -8)},
+		{Path: "a", Downloaded: now.AddDate(0, 0, -30)},
+	}
+
+	tests := []struct {
+		name      string
+		retention domain.Retention
+		want      []string
+	}{
+		{"none", domain.Retention{}, nil},
+		{"keep last", domain.Retention{KeepLast: 2}, []string{"b", "a"}},
+		{"max age", domain.Retention{MaxAge: 7}, []string{"b", "a"}},
+		{"keep unwatched", domain.Retention{KeepUnwatched: true}, []string{"c"}},
+		{"any rule", domain.Retention{KeepLast: 3, KeepUnwatched: true}, []string{"c", "a"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, f := range expiredFiles(files, tt.retention, now) {
+			got = append(got, f.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveWithSidecars(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{
+		"Video.mp4",
+		"Video.webp",
+		"Video.info.json",
+		"Video.en.vtt",
+		"Video.live_chat.srt",
+		"Video.chat.jsonl",
+		"Video 2.mp4",
+		// another title starting with the same stem
+		"Video. Part 2.mp4",
+		"Video. Part 2.webp",
+		"Video.Part 2.en.vtt",
+		"Other.mp4",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := removeWithSidecars(filepath.Join(dir, "Video.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 6 {
+		t.Errorf("expected 6 removed files, got %v", removed)
+	}
+
+	left, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range left {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"Other.mp4", "Video 2.mp4", "Video. Part 2.mp4", "Video. Part 2.webp", "Video.Part 2.en.vtt"}) {
+		t.Errorf("unexpected files left %v", names)
+	}
+
+	if _, err := removeWithSidecars(filepath.Join(dir, "missing", "Video.mp4")); err != nil {
+		t.Errorf("a missing file isn't an error: %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	files := newFileStore(openTestDB(t))
+
+	path := filepath.Join(t.TempDir(), "Video.mp4")
+
+	if err := files.queued("sub", "download"); err != nil {
+		t.Fatal(err)
+	}
+	// not queued by a subscription
+	if err := files.completed("other", filepath.Join(t.TempDir(), "Other.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.completed("download", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.watched(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tracked, err := files.list("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracked) != 1 || tracked[0].Path != path || !tracked[0].Watched {
+		t.Fatalf("unexpected tracked files %+v", tracked)
+	}
+
+	if err := files.remove("sub", path); err != nil {
+		t.Fatal(err)
+	}
+	if tracked, _ := files.list("sub"); len(tracked) != 0 {
+		t.Errorf("expected no tracked files, got %+v", tracked)
+	}
+}
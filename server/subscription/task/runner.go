@@ -2,69 +2,133 @@ package task
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os/exec"
-	"path/filepath"
 	"regexp"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/filebrowser"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
 	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
 	"github.com/robfig/cron/v3"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 type TaskRunner interface {
 	Submit(subcription *domain.Subscription) error
 	Spawner(ctx context.Context)
+	// Stop a scheduled subscription, submitting it again replaces the task
 	StopTask(id string) error
-	Recoverer()
+	Forget(id string) error
+	// Run a scheduled subscription right away
+	RunNow(id string) error
+	// Most recent runs of a subscription, newest first
+	Runs(id string) ([]domain.Run, error)
+	// Zero if the subscription isn't scheduled
+	NextRun(id string) time.Time
+	// Register a function called when a subscription is disabled
+	// because of too many consecutive failed runs
+	OnDisable(hook func(id, reason string))
+	// Restart the tasks that crashed
+	Recoverer(ctx context.Context)
+	// Periodically delete the files expired by the retention of the subscriptions
+	Janitor(ctx context.Context, interval time.Duration)
 }
 
 type monitorTask struct {
 	Done         chan struct{}
+	Trigger      chan struct{} // run now
 	Schedule     cron.Schedule
 	Subscription *domain.Subscription
+	nextRun      time.Time
 }
 
 type CronTaskRunner struct {
-	mq *queue.MessageQueue
-	db *kv.Store
-
-	tasks  chan monitorTask
-	errors chan error
+	mq        *queue.MessageQueue
+	db        *kv.Store
+	pipelines *pipeline.Store
+	seen      seenStore
+	runs      runStore
+	templates templateStore
+	feeds     feedStore
+	files     fileStore
+	// files already marked as watched, see watched
+	marked sync.Map
+
+	tasks   chan *monitorTask
+	crashed chan *monitorTask
 
 	running map[string]*monitorTask
+	mu      sync.Mutex
+
+	onDisable func(id, reason string)
 }
 
-func NewCronTaskRunner(mq *queue.MessageQueue, db *kv.Store) TaskRunner {
-	return &CronTaskRunner{
-		mq:      mq,
-		db:      db,
-		tasks:   make(chan monitorTask),
-		errors:  make(chan error),
-		running: make(map[string]*monitorTask),
+func NewCronTaskRunner(mq *queue.MessageQueue, db *kv.Store, pipelines *pipeline.Store, bdb *bolt.DB) TaskRunner {
+	t := &CronTaskRunner{
+		mq:        mq,
+		db:        db,
+		pipelines: pipelines,
+		seen:      newSeenStore(bdb),
+		runs:      newRunStore(bdb),
+		templates: templateStore{db: bdb},
+		feeds:     newFeedStore(bdb),
+		files:     newFileStore(bdb),
+		tasks:     make(chan *monitorTask),
+		crashed:   make(chan *monitorTask, 1),
+		running:   make(map[string]*monitorTask),
 	}
+
+	// the retention tracks the files downloaded by the subscriptions
+	mq.OnCompleted(t.downloaded)
+	filebrowser.OnServed(t.watched)
+
+	return t
 }
 
 var argsSplitterRe = regexp.MustCompile(`(?mi)[^\s"']+|"([^"]*)"|'([^']*)'`)
 
+// Delay before a crashed task is restarted
+const restartDelay = 30 * time.Second
+
 func (t *CronTaskRunner) Submit(subcription *domain.Subscription) error {
 	schedule, err := cron.ParseStandard(subcription.CronExpr)
 	if err != nil {
 		return err
 	}
 
-	job := monitorTask{
+	job := &monitorTask{
 		Done:         make(chan struct{}),
+		Trigger:      make(chan struct{}, 1),
 		Schedule:     schedule,
 		Subscription: subcription,
 	}
 
+	// an updated subscription replaces its running task, in one step so that
+	// a concurrent submit can't leave two tasks running
+	t.mu.Lock()
+	if task := t.running[subcription.Id]; task != nil {
+		close(task.Done)
+	}
+	t.running[subcription.Id] = job // keep track of the current job
+	t.mu.Unlock()
+
 	t.tasks <- job
 
 	return nil
@@ -73,11 +137,15 @@ func (t *CronTaskRunner) Submit(subcription *domain.Subscription) error {
 // Handles the entire lifecylce of a monitor job.
 func (t *CronTaskRunner) Spawner(ctx context.Context) {
 	for req := range t.tasks {
-		t.running[req.Subscription.Id] = &req // keep track of the current job
-
 		go func() {
+			select {
+			case <-req.Done: // replaced or stopped before being spawned
+				return
+			default:
+			}
+
 			ctx, cancel := context.WithCancel(ctx) // inject into the job's context a cancellation singal
-			fetcherEvents := t.doFetch(ctx, &req)  // retrieve the channel of events of the job
+			fetcherEvents := t.doFetch(ctx, req)   // retrieve the channel of events of the job
 
 			for {
 				select {
@@ -95,85 +163,408 @@ func (t *CronTaskRunner) Spawner(ctx context.Context) {
 
 // Stop a currently scheduled job
 func (t *CronTaskRunner) StopTask(id string) error {
-	task := t.running[id]
-	if task != nil {
-		t.running[id].Done <- struct{}{}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if task := t.running[id]; task != nil {
+		close(task.Done)
 		delete(t.running, id)
 	}
 	return nil
 }
 
+func (t *CronTaskRunner) RunNow(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	task := t.running[id]
+	if task == nil {
+		return fmt.Errorf("subscription %s is not scheduled", id)
+	}
+
+	select {
+	case task.Trigger <- struct{}{}:
+	default:
+		// already triggered
+	}
+
+	return nil
+}
+
+func (t *CronTaskRunner) Runs(id string) ([]domain.Run, error) {
+	return t.runs.list(id)
+}
+
+func (t *CronTaskRunner) NextRun(id string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if task := t.running[id]; task != nil {
+		return task.nextRun
+	}
+	return time.Time{}
+}
+
+func (t *CronTaskRunner) OnDisable(hook func(id, reason string)) {
+	t.mu.Lock()
+	t.onDisable = hook
+	t.mu.Unlock()
+}
+
 // Start a fetcher and notify on a channel when a fetcher has completed
 func (t *CronTaskRunner) doFetch(ctx context.Context, req *monitorTask) <-chan struct{} {
 	completed := make(chan struct{})
 
 	// generator func
 	go func() {
+		defer t.recoverTask(req)
+
 		for {
 			sleepFor := t.fetcher(ctx, req)
-			completed <- struct{}{}
 
-			time.Sleep(sleepFor)
+			t.mu.Lock()
+			req.nextRun = time.Now().Add(sleepFor)
+			t.mu.Unlock()
+
+			select {
+			case completed <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-time.After(sleepFor):
+			case <-req.Trigger:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return completed
 }
 
-// Perform the retrieval of the latest video of the channel.
+// Perform a run of the subscription and record it.
 // Returns a time.Duration containing the amount of time to the next schedule.
 func (t *CronTaskRunner) fetcher(ctx context.Context, req *monitorTask) time.Duration {
-	slog.Info("fetching latest video for channel", slog.String("channel", req.Subscription.URL))
+	sub := req.Subscription
 
-	nextSchedule := time.Until(req.Schedule.Next(time.Now()))
+	slog.Info("fetching latest videos for channel", slog.String("channel", sub.URL))
 
-	cmd := exec.CommandContext(
-		ctx,
-		config.Instance().Paths.DownloaderPath,
-		"-I1",
-		"--flat-playlist",
-		"--print", "webpage_url",
-		req.Subscription.URL,
-	)
+	run := domain.Run{Start: time.Now()}
 
-	stdout, err := cmd.Output()
+	err := t.fetch(ctx, sub, &run)
+
+	run.End = time.Now()
 	if err != nil {
-		t.errors <- err
-		return time.Duration(0)
+		run.Error = err.Error()
+		slog.Error("subscription run failed", slog.String("url", sub.URL), slog.Any("err", err))
 	}
 
-	latestVideoURL := string(bytes.Trim(stdout, "\n"))
+	if err := t.runs.add(sub.Id, run); err != nil {
+		slog.Error("failed to save the subscription run", slog.String("url", sub.URL), slog.Any("err", err))
+	}
 
-	// if the download exists there's not point in sending it into the message queue.
-	exists, err := archive.DownloadExists(ctx, latestVideoURL)
-	if exists && err == nil {
-		return nextSchedule
-	}
-
-	// TODO: autoremove hook
-	d := downloaders.NewGenericDownload(
-		latestVideoURL,
-		append(
-			argsSplitterRe.FindAllString(req.Subscription.Params, 1),
-			[]string{
-				"--break-on-existing",
-				"--download-archive",
-				filepath.Join(config.Instance().Dir(), "archive.txt"),
-			}...),
-	)
+	if run.Error != "" {
+		t.checkFailures(sub)
+	}
 
-	t.db.Set(d)     // give it an id
-	t.mq.Publish(d) // send it to the message queue waiting to be processed
+	nextSchedule := time.Until(req.Schedule.Next(time.Now()))
 
 	slog.Info(
 		"cron task runner next schedule",
-		slog.String("url", req.Subscription.URL),
+		slog.String("url", sub.URL),
+		slog.Int("queued", run.Queued),
 		slog.Any("duration", nextSchedule),
 	)
 
 	return nextSchedule
 }
 
-func (t *CronTaskRunner) Recoverer() {
-	panic("unimplemented")
+// Disable the subscription once the last subscriptions.max_failures runs failed
+func (t *CronTaskRunner) checkFailures(sub *domain.Subscription) {
+	limit := config.Instance().Subscriptions.MaxFailures
+	if limit <= 0 {
+		return
+	}
+
+	failures, err := t.runs.consecutiveFailures(sub.Id, sub.EnabledAt)
+	if err != nil || failures < limit {
+		return
+	}
+
+	reason := fmt.Sprintf("disabled after %d consecutive failed runs", failures)
+	slog.Warn("subscription "+reason, slog.String("url", sub.URL))
+
+	t.StopTask(sub.Id)
+
+	t.mu.Lock()
+	hook := t.onDisable
+	t.mu.Unlock()
+
+	if hook != nil {
+		hook(sub.Id, reason)
+	}
+}
+
+// Queue the entries of the channel that haven't been seen yet and pass the
+// filters, the outcome is reported in run.
+func (t *CronTaskRunner) fetch(ctx context.Context, sub *domain.Subscription, run *domain.Run) error {
+	seen, initialized, err := t.seen.get(sub.Id)
+	if err != nil {
+		return err
+	}
+
+	filters, err := compileFilters(sub.Filters)
+	if err != nil {
+		return err
+	}
+
+	var (
+		limit = cmp.Or(sub.MaxEntries, config.Instance().Subscriptions.MaxEntries)
+		// the first run marks all the listed entries as seen
+		listed = limit
+		after  string
+	)
+
+	if !initialized {
+		switch {
+		case sub.BackfillCount > 0:
+			limit = sub.BackfillCount
+			listed = max(limit, listed)
+		case sub.BackfillAfter != "":
+			after = strings.ReplaceAll(sub.BackfillAfter, "-", "")
+			limit, listed = 0, 0
+		default:
+			limit = 1
+		}
+	}
+
+	var (
+		entries []entry
+		feed    *feedState
+	)
+
+	// the feed is polled without spawning yt-dlp, an unmodified one has no entries
+	if sub.FeedURL != "" {
+		entries, feed, err = t.feeds.poll(ctx, sub.Id, sub.FeedURL)
+		if listed > 0 && len(entries) > listed {
+			entries = entries[:listed]
+		}
+	} else {
+		entries, err = listEntries(ctx, sub.URL, listed)
+	}
+	if err != nil {
+		return err
+	}
+
+	run.Found = len(entries)
+
+	// if the download exists there's not point in sending it into the message queue.
+	archived, err := archive.DownloadArchive()
+	if err != nil {
+		slog.Warn("failed to read the download archive", slog.Any("err", err))
+	}
+
+	var fresh []entry
+
+	for _, e := range entries {
+		// entries are listed newest first
+		if after != "" && e.uploadDate != "" && e.uploadDate < after {
+			break
+		}
+		if seen[e.id] || archived[e.archiveKey()] {
+			continue
+		}
+		if limit > 0 && len(fresh) == limit {
+			break
+		}
+		if reason := filters.skip(e, time.Now()); reason != "" {
+			run.Skipped = append(run.Skipped, domain.SkippedEntry{
+				Id:     e.id,
+				Title:  e.title,
+				URL:    e.url,
+				Reason: reason,
+			})
+			continue
+		}
+		fresh = append(fresh, e)
+	}
+
+	p := t.pipelines.ResolveOrNone(sub.PipelineId)
+
+	// the template parameters come first, the subscription ones override them
+	params, err := t.templates.params(sub.TemplateId)
+	if err != nil {
+		return err
+	}
+	params = append(params, splitArgs(sub.Params)...)
+
+	// oldest first
+	for _, e := range slices.Backward(fresh) {
+		// TODO: autoremove hook
+		d := downloaders.NewGenericDownload(e.url, slices.Clone(params))
+		d.SetOutput(internal.DownloadOutput{
+			Path:     sub.OutputPath,
+			Filename: sub.FilenameTemplate,
+			Archive:  true,
+		})
+		d.SetPipeline(p)
+
+		t.db.Set(d) // give it an id
+		if err := t.files.queued(sub.Id, d.GetId()); err != nil {
+			slog.Error("failed to track the subscription download", slog.String("url", e.url), slog.Any("err", err))
+		}
+		t.mq.Publish(d) // send it to the message queue waiting to be processed
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.id
+	}
+
+	run.Queued = len(fresh)
+
+	// filtered entries are seen too, they're skipped once
+	if err := t.seen.add(sub.Id, ids...); err != nil {
+		return err
+	}
+
+	if feed != nil {
+		return t.feeds.save(sub.Id, *feed)
+	}
+	return nil
+}
+
+// An entry of a channel or playlist, the metadata is missing when the
+// extractor doesn't provide it in the flat playlist
+type entry struct {
+	id         string
+	extractor  string
+	uploadDate string // YYYYMMDD
+	url        string
+	duration   float64 // seconds
+	liveStatus string
+	mediaType  string // e.g. "short", "livestream" (youtube)
+	title      string
+}
+
+// Key of the entry in the yt-dlp download archive
+func (e entry) archiveKey() string {
+	return strings.ToLower(e.extractor) + " " + e.id
+}
+
+// the title is the last field, it may contain anything
+const entryTemplate = "%(id)s\t%(ie_key,extractor_key|)s\t%(upload_date|)s\t%(webpage_url,url)s\t" +
+	"%(duration|)s\t%(live_status|)s\t%(media_type|)s\t%(title|)s"
+
+// List the latest limit entries of url, all of them if limit is 0.
+// A variable to be replaced in the tests, which can't spawn yt-dlp.
+var listEntries = listChannelEntries
+
+func listChannelEntries(ctx context.Context, url string, limit int) ([]entry, error) {
+	args := []string{
+		"--flat-playlist",
+		"--no-warnings",
+		"--print", entryTemplate,
+		// dates of the flat youtube entries
+		"--extractor-args", "youtubetab:approximate_date",
+	}
+	if limit > 0 {
+		args = append(args, "-I", fmt.Sprintf("1:%d", limit))
+	}
+	args = append(args, url)
+
+	cmd := exec.CommandContext(ctx, config.Instance().Paths.DownloaderPath, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+
+	var entries []entry
+
+	for line := range strings.Lines(string(stdout)) {
+		fields := strings.SplitN(strings.TrimRight(line, "\r\n"), "\t", 8)
+		if len(fields) != 8 || fields[0] == "" || fields[3] == "" {
+			continue
+		}
+
+		duration, _ := strconv.ParseFloat(fields[4], 64)
+
+		entries = append(entries, entry{
+			id:         fields[0],
+			extractor:  fields[1],
+			uploadDate: fields[2],
+			url:        fields[3],
+			duration:   duration,
+			liveStatus: fields[5],
+			mediaType:  fields[6],
+			title:      fields[7],
+		})
+	}
+
+	return entries, nil
+}
+
+// Drop the seen entries, the runs, the feed state and the tracked files of a
+// deleted subscription
+func (t *CronTaskRunner) Forget(id string) error {
+	return errors.Join(t.seen.forget(id), t.runs.forget(id), t.feeds.forget(id), t.files.forget(id))
+}
+
+// Report a panicking task to the Recoverer
+func (t *CronTaskRunner) recoverTask(req *monitorTask) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	slog.Error(
+		"subscription task crashed",
+		slog.String("url", req.Subscription.URL),
+		slog.Any("err", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+
+	t.crashed <- req
+}
+
+func (t *CronTaskRunner) Recoverer(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-t.crashed:
+			go func() {
+				select {
+				case <-time.After(restartDelay):
+				case <-req.Done: // stopped in the meantime
+					return
+				case <-ctx.Done():
+					return
+				}
+
+				t.mu.Lock()
+				current := t.running[req.Subscription.Id] == req
+				t.mu.Unlock()
+
+				if !current {
+					return
+				}
+
+				slog.Info("restarting subscription task", slog.String("url", req.Subscription.URL))
+
+				if err := t.Submit(req.Subscription); err != nil {
+					slog.Error("failed to restart subscription task", slog.String("url", req.Subscription.URL), slog.Any("err", err))
+				}
+			}()
+		}
+	}
 }
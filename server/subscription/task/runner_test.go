@@ -0,0 +1,311 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+	"github.com/robfig/cron/v3"
+)
+
+func newTestRunner(t *testing.T) *CronTaskRunner {
+	if config.Instance().Server.QueueSize <= 0 {
+		config.Instance().Server.QueueSize = 10
+	}
+
+	db := openTestDB(t)
+
+	mq, err := queue.NewMessageQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdb, err := kv.NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipelines, err := pipeline.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCronTaskRunner(mq, mdb, pipelines, db).(*CronTaskRunner)
+}
+
+// Replace yt-dlp listing the entries of a channel
+func stubListEntries(t *testing.T, list func(url string, limit int) ([]entry, error)) {
+	prev := listEntries
+	listEntries = func(_ context.Context, url string, limit int) ([]entry, error) {
+		return list(url, limit)
+	}
+	t.Cleanup(func() { listEntries = prev })
+}
+
+// Entries of a channel newest first, uploaded one day apart and the last
+// one on 2024-01-01
+func channelEntries(ids ...string) []entry {
+	entries := make([]entry, len(ids))
+	for i, id := range ids {
+		entries[i] = entry{
+			id:         id,
+			extractor:  "Generic",
+			uploadDate: fmt.Sprintf("202401%02d", len(ids)-i),
+			url:        "https://example.com/" + id,
+			title:      "Video " + id,
+		}
+	}
+	return entries
+}
+
+func TestFetch(t *testing.T) {
+	type run struct {
+		listing []entry
+		queued  int
+	}
+
+	tests := []struct {
+		name string
+		sub  domain.Subscription
+		runs []run
+	}{
+		{
+			// the first run only queues the latest entry, the listed ones are seen
+			name: "latest",
+			sub:  domain.Subscription{MaxEntries: 3},
+			runs: []run{
+				{channelEntries("e", "d", "c", "b", "a"), 1},
+				{channelEntries("f", "e", "d", "c", "b", "a"), 1},
+				{channelEntries("f", "e", "d", "c", "b", "a"), 0},
+			},
+		},
+		{
+			name: "backfill count",
+			sub:  domain.Subscription{MaxEntries: 2, BackfillCount: 4},
+			runs: []run{
+				{channelEntries("e", "d", "c", "b", "a"), 4},
+				{channelEntries("g", "f", "e", "d", "c", "b", "a"), 2},
+			},
+		},
+		{
+			// only the latest max entries are listed
+			name: "max entries",
+			sub:  domain.Subscription{MaxEntries: 2},
+			runs: []run{
+				{channelEntries("c", "b", "a"), 1},
+				{channelEntries("f", "e", "d", "c", "b", "a"), 2},
+				{channelEntries("f", "e", "d", "c", "b", "a"), 0},
+			},
+		},
+		{
+			// downloaded without it
+			name: "deleted pipeline",
+			sub:  domain.Subscription{PipelineId: "deleted"},
+			runs: []run{
+				{channelEntries("a"), 1},
+			},
+		},
+		{
+			name: "backfill after",
+			sub:  domain.Subscription{BackfillAfter: "2024-01-03"},
+			runs: []run{
+				{channelEntries("e", "d", "c", "b", "a"), 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := newTestRunner(t)
+
+			sub := tt.sub
+			sub.Id = tt.name
+			sub.URL = "https://example.com/channel"
+
+			var listing []entry
+			stubListEntries(t, func(_ string, limit int) ([]entry, error) {
+				if limit > 0 && len(listing) > limit {
+					return listing[:limit], nil
+				}
+				return listing, nil
+			})
+
+			for i, r := range tt.runs {
+				listing = r.listing
+
+				var got domain.Run
+				if err := runner.fetch(context.Background(), &sub, &got); err != nil {
+					t.Fatalf("run %d: %v", i, err)
+				}
+				if got.Queued != r.queued {
+					t.Errorf("run %d: queued %d, want %d", i, got.Queued, r.queued)
+				}
+			}
+		})
+	}
+
+	t.Run("seen", func(t *testing.T) {
+		runner := newTestRunner(t)
+
+		sub := &domain.Subscription{Id: "seen", URL: "https://example.com/channel", MaxEntries: 3}
+
+		stubListEntries(t, func(string, int) ([]entry, error) {
+			return channelEntries("c", "b", "a"), nil
+		})
+
+		if err := runner.fetch(context.Background(), sub, &domain.Run{}); err != nil {
+			t.Fatal(err)
+		}
+
+		seen, initialized, err := runner.seen.get(sub.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !initialized || len(seen) != 3 || !seen["a"] || !seen["b"] || !seen["c"] {
+			t.Errorf("unexpected seen entries %v", seen)
+		}
+	})
+}
+
+func TestCheckFailures(t *testing.T) {
+	prev := config.Instance().Subscriptions.MaxFailures
+	config.Instance().Subscriptions.MaxFailures = 2
+	t.Cleanup(func() { config.Instance().Subscriptions.MaxFailures = prev })
+
+	runner := newTestRunner(t)
+
+	var disabled []string
+	runner.OnDisable(func(id, reason string) {
+		disabled = append(disabled, id)
+	})
+
+	fail := true
+	stubListEntries(t, func(string, int) ([]entry, error) {
+		if fail {
+			return nil, errors.New("channel unavailable")
+		}
+		return nil, nil
+	})
+
+	req := &monitorTask{
+		Schedule:     cron.Every(time.Hour),
+		Subscription: &domain.Subscription{Id: "failing", URL: "https://example.com/channel"},
+	}
+
+	runner.fetcher(context.Background(), req)
+	if len(disabled) != 0 {
+		t.Fatal("disabled after a single failed run")
+	}
+
+	// a successful run in between resets the count
+	fail = false
+	runner.fetcher(context.Background(), req)
+	fail = true
+	runner.fetcher(context.Background(), req)
+	if len(disabled) != 0 {
+		t.Fatal("disabled after failed runs that aren't consecutive")
+	}
+
+	runner.fetcher(context.Background(), req)
+	if !slices.Equal(disabled, []string{"failing"}) {
+		t.Fatalf("expected the subscription to be disabled, got %v", disabled)
+	}
+
+	// the runs before it was enabled again don't count
+	req.Subscription.EnabledAt = time.Now()
+	runner.fetcher(context.Background(), req)
+	if len(disabled) != 1 {
+		t.Errorf("disabled again after a single failed run")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	runner := newTestRunner(t)
+
+	calls := make(chan string, 10)
+	stubListEntries(t, func(url string, _ int) ([]entry, error) {
+		calls <- url
+		return nil, nil
+	})
+
+	expectRun := func(want string) {
+		t.Helper()
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Fatalf("ran %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s didn't run", want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go runner.Spawner(ctx)
+
+	// once a year, it only runs when it's submitted or triggered
+	sub := &domain.Subscription{Id: "scheduled", URL: "https://example.com/old", CronExpr: "0 0 1 1 *"}
+
+	if err := runner.Submit(sub); err != nil {
+		t.Fatal(err)
+	}
+	expectRun("https://example.com/old")
+
+	if err := runner.RunNow(sub.Id); err != nil {
+		t.Fatal(err)
+	}
+	expectRun("https://example.com/old")
+
+	// give the task the time to record the next run
+	time.Sleep(50 * time.Millisecond)
+	if next := runner.NextRun(sub.Id); next.Before(time.Now()) {
+		t.Errorf("unexpected next run %v", next)
+	}
+
+	runner.mu.Lock()
+	old := runner.running[sub.Id]
+	runner.mu.Unlock()
+
+	// an update replaces the running task
+	updated := *sub
+	updated.URL = "https://example.com/new"
+	if err := runner.Submit(&updated); err != nil {
+		t.Fatal(err)
+	}
+	expectRun("https://example.com/new")
+
+	select {
+	case <-old.Done:
+	default:
+		t.Fatal("the replaced task is still running")
+	}
+
+	if err := runner.RunNow(sub.Id); err != nil {
+		t.Fatal(err)
+	}
+	expectRun("https://example.com/new")
+
+	if err := runner.StopTask(sub.Id); err != nil {
+		t.Fatal(err)
+	}
+	if !runner.NextRun(sub.Id).IsZero() {
+		t.Error("a stopped task has a next run")
+	}
+	if err := runner.RunNow(sub.Id); err == nil {
+		t.Error("expected an error running a stopped task")
+	}
+
+	select {
+	case url := <-calls:
+		t.Errorf("unexpected run of %s", url)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
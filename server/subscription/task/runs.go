@@ -0,0 +1,125 @@
+package task
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/subscription/domain"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Run history, a nested bucket for each subscription keyed by the start
+// time of the runs so that they're sorted.
+var runsBucket = []byte("subscriptions-runs")
+
+// runs kept for each subscription
+const maxRuns = 50
+
+type runStore struct {
+	db *bolt.DB
+}
+
+func newRunStore(db *bolt.DB) runStore {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	})
+
+	return runStore{db: db}
+}
+
+func (s runStore) add(subscriptionId string, run domain.Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	key := binary.BigEndian.AppendUint64(nil, uint64(run.Start.UnixNano()))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(subscriptionId))
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(key, data); err != nil {
+			return err
+		}
+
+		var count int
+		b.ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+
+		// drop the oldest ones
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && count > maxRuns; k, _ = c.First() {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			count--
+		}
+
+		return nil
+	})
+}
+
+// Newest first
+func (s runStore) list(subscriptionId string) ([]domain.Run, error) {
+	runs := make([]domain.Run, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket).Bucket([]byte(subscriptionId))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run domain.Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+
+		return nil
+	})
+
+	return runs, err
+}
+
+// Failed runs since the last successful one, runs started before since don't count
+func (s runStore) consecutiveFailures(subscriptionId string, since time.Time) (int, error) {
+	runs, err := s.list(subscriptionId)
+	if err != nil {
+		return 0, err
+	}
+
+	var failures int
+	for _, run := range runs {
+		if run.Kind != "" {
+			continue // only the fetches count
+		}
+		if run.Error == "" || run.Start.Before(since) {
+			break
+		}
+		failures++
+	}
+
+	return failures, nil
+}
+
+func (s runStore) forget(subscriptionId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(runsBucket).DeleteBucket([]byte(subscriptionId))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,73 @@
+package task
+
+import (
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Entries already handled by each subscription, a nested bucket for each of
+// them keyed by the entry id. The nested bucket is created by the first run.
+var seenBucket = []byte("subscriptions-seen")
+
+type seenStore struct {
+	db *bolt.DB
+}
+
+func newSeenStore(db *bolt.DB) seenStore {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(seenBucket)
+		return err
+	})
+
+	return seenStore{db: db}
+}
+
+// Seen entries of a subscription, initialized is false until its first run
+func (s seenStore) get(subscriptionId string) (seen map[string]bool, initialized bool, err error) {
+	seen = make(map[string]bool)
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(seenBucket).Bucket([]byte(subscriptionId))
+		if b == nil {
+			return nil
+		}
+		initialized = true
+		return b.ForEach(func(k, v []byte) error {
+			seen[string(k)] = true
+			return nil
+		})
+	})
+
+	return seen, initialized, err
+}
+
+func (s seenStore) add(subscriptionId string, entryIds ...string) error {
+	now := []byte(time.Now().Format(time.RFC3339))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(seenBucket).CreateBucketIfNotExists([]byte(subscriptionId))
+		if err != nil {
+			return err
+		}
+
+		for _, id := range entryIds {
+			if err := b.Put([]byte(id), now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s seenStore) forget(subscriptionId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(seenBucket).DeleteBucket([]byte(subscriptionId))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
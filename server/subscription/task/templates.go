@@ -0,0 +1,61 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Saved templates are created through the rest api, the runner only reads them
+var templatesBucket = []byte("templates")
+
+type templateStore struct {
+	db *bolt.DB
+}
+
+// Parameters of the saved template, none if id is empty
+func (s templateStore) params(id string) ([]string, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	var t internal.CustomTemplate
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(templatesBucket)
+		if b == nil {
+			return fmt.Errorf("template %s not found", id)
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("template %s not found", id)
+		}
+		return json.Unmarshal(v, &t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return splitArgs(t.Content), nil
+}
+
+// Split a parameters string the way a shell would, without the quotes
+func splitArgs(s string) []string {
+	matches := argsSplitterRe.FindAllStringSubmatch(s, -1)
+
+	args := make([]string, len(matches))
+	for i, m := range matches {
+		switch {
+		case len(m[0]) > 0 && m[0][0] == '"':
+			args[i] = m[1]
+		case len(m[0]) > 0 && m[0][0] == '\'':
+			args[i] = m[2]
+		default:
+			args[i] = m[0]
+		}
+	}
+
+	return args
+}
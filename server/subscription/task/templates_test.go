@@ -0,0 +1,24 @@
+package task
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		params string
+		want   []string
+	}{
+		{"", []string{}},
+		{"-x --audio-format mp3", []string{"-x", "--audio-format", "mp3"}},
+		{`-f "bv*+ba/b" --embed-metadata`, []string{"-f", "bv*+ba/b", "--embed-metadata"}},
+		{`-o '%(title)s [%(id)s].%(ext)s'`, []string{"-o", "%(title)s [%(id)s].%(ext)s"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitArgs(tt.params); !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.params, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package twitch
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 )
 
 const authURL = "https://id.twitch.tv/oauth2/token"
@@ -25,6 +29,9 @@ type AuthenticationManager struct {
 	clientId     string
 	clientSecret string
 	accesToken   *AccessToken
+	mu           sync.Mutex
+	// OAuth token endpoint
+	AuthURL string
 }
 
 func NewAuthenticationManager(clientId, clientSecret string) *AuthenticationManager {
@@ -32,10 +39,14 @@ func NewAuthenticationManager(clientId, clientSecret string) *AuthenticationMana
 		clientId:     clientId,
 		clientSecret: clientSecret,
 		accesToken:   &AccessToken{},
+		AuthURL:      cmp.Or(config.Instance().Twitch.AuthURL, authURL),
 	}
 }
 
 func (a *AuthenticationManager) GetAccessToken() (*AccessToken, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if a.accesToken != nil && a.accesToken.Token != "" && a.accesToken.Expiry.After(time.Now()) {
 		return a.accesToken, nil
 	}
@@ -45,7 +56,7 @@ func (a *AuthenticationManager) GetAccessToken() (*AccessToken, error) {
 	data.Set("client_secret", a.clientSecret)
 	data.Set("grant_type", "client_credentials")
 
-	resp, err := http.PostForm(authURL, data)
+	resp, err := http.PostForm(a.AuthURL, data)
 	if err != nil {
 		return nil, fmt.Errorf("errore richiesta token: %w", err)
 	}
@@ -70,6 +81,14 @@ func (a *AuthenticationManager) GetAccessToken() (*AccessToken, error) {
 	return token, nil
 }
 
+// Discard the cached token, e.g. when it has been revoked
+func (a *AuthenticationManager) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.accesToken = &AccessToken{}
+}
+
 func (a *AuthenticationManager) GetClientId() string {
 	return a.clientId
 }
@@ -0,0 +1,360 @@
+package twitch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/archive"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Videos already recorded, a nested bucket for each user. Live recordings
+	// are stored as "stream/<stream id>" so that their vods are skipped.
+	backfillBucket = []byte("twitch-backfill")
+	// Videos queued and not completed yet keyed by the download id, they're
+	// recorded once completed
+	backfillPendingBucket = []byte("twitch-backfill-pending")
+)
+
+const (
+	defaultMaxClips = 20
+	maxClips        = 1000
+
+	defaultSyncInterval = 6 * time.Hour
+)
+
+type pendingVideo struct {
+	User string `json:"user"`
+	ID   string `json:"id"`
+}
+
+// Archives the past broadcasts and clips of the monitored users
+type Backfill struct {
+	source    *Source
+	channels  *channel.Monitor
+	mdb       *kv.Store
+	mq        *queue.MessageQueue
+	pipelines *pipeline.Store
+	// a user is backfilled once at a time
+	mu sync.Mutex
+}
+
+func NewBackfill(
+	s *Source,
+	cm *channel.Monitor,
+	mdb *kv.Store,
+	mq *queue.MessageQueue,
+	pipelines *pipeline.Store,
+) *Backfill {
+	s.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(backfillPendingBucket)
+		return err
+	})
+
+	b := &Backfill{
+		source:    s,
+		channels:  cm,
+		mdb:       mdb,
+		mq:        mq,
+		pipelines: pipelines,
+	}
+
+	// only the completed downloads are recorded, the failed ones are queued
+	// again by the next backfill
+	mq.OnCompleted(b.completed)
+
+	return b
+}
+
+// Queue the vods and clips of user that haven't been recorded yet.
+// Returns how many downloads have been queued.
+func (b *Backfill) Run(user string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	settings, err := b.settings(user)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := settings.Backfill
+	if !opts.Vods && !opts.Clips {
+		opts.Vods, opts.Clips = true, true
+	}
+
+	p := b.pipelines.ResolveOrNone(settings.PipelineId)
+
+	userId, err := b.source.client.UserId(user)
+	if err != nil {
+		return 0, err
+	}
+
+	var videos []VodInfo
+
+	if opts.Vods {
+		vods, err := b.source.client.Videos(userId)
+		if err != nil {
+			return 0, err
+		}
+		videos = append(videos, vods...)
+	}
+
+	if opts.Clips {
+		clips, err := b.source.client.Clips(userId, cmp.Or(opts.MaxClips, defaultMaxClips))
+		if err != nil {
+			return 0, err
+		}
+		videos = append(videos, clips...)
+	}
+
+	archived, err := archive.DownloadArchive()
+	if err != nil {
+		slog.Warn("failed to read the download archive", slog.Any("err", err))
+	}
+
+	recorded, err := b.source.recorded(user)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := b.pending(user)
+	if err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Join(cmp.Or(settings.OutputPath, config.Instance().Paths.DownloadPath), user)
+
+	var queued []string
+
+	for _, v := range backfillable(videos, recorded, pending, archived) {
+		d := downloaders.NewGenericDownload(v.URL, []string{})
+		d.SetOutput(internal.DownloadOutput{Path: dir, Filename: "%(title)s [%(id)s].%(ext)s", Archive: true})
+		d.SetPipeline(p)
+
+		b.mdb.Set(d) // give it an id
+		if err := b.queued(d.GetId(), user, v.ID); err != nil {
+			slog.Error("failed to track the backfill download", slog.String("url", v.URL), slog.Any("err", err))
+		}
+		b.mq.Publish(d)
+
+		queued = append(queued, v.ID)
+	}
+
+	slog.Info("twitch backfill completed",
+		slog.String("user", user),
+		slog.Int("found", len(videos)),
+		slog.Int("queued", len(queued)),
+	)
+
+	return len(queued), nil
+}
+
+// Videos neither recorded, queued nor in the download archive
+func backfillable(videos []VodInfo, recorded, pending, archived map[string]bool) []VodInfo {
+	var todo []VodInfo
+
+	for _, v := range videos {
+		if recorded[v.ID] || pending[v.ID] || (v.StreamID != "" && recorded["stream/"+v.StreamID]) {
+			continue
+		}
+		if key := archiveEntry(v); key != "" && archived[key] {
+			continue
+		}
+		todo = append(todo, v)
+	}
+
+	return todo
+}
+
+// Periodically backfill the users with the sync enabled
+func (b *Backfill) Sync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.Warn("invalid twitch sync interval, using the default one", slog.Duration("interval", interval))
+		interval = defaultSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, c := range b.channels.List() {
+				login, err := twitchLogin(c.URL)
+				if err != nil || c.Settings.Source != sourceName {
+					continue
+				}
+
+				settings, err := settingsOf(c)
+				if err != nil || !settings.Backfill.Sync {
+					continue
+				}
+
+				if _, err := b.Run(login); err != nil {
+					slog.Error("twitch backfill failed", slog.String("user", login), slog.Any("err", err))
+				}
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Settings of the twitch channel of user
+func (b *Backfill) settings(user string) (UserSettings, error) {
+	c, err := b.channels.Get(ChannelURL(user))
+	if err != nil {
+		return UserSettings{}, err
+	}
+	if c.Settings.Source != sourceName {
+		return UserSettings{}, fmt.Errorf("%s is not monitored as a twitch channel", c.URL)
+	}
+
+	return settingsOf(c)
+}
+
+// Key of v in the yt-dlp download archive, empty for the clips: yt-dlp
+// archives them by an id helix doesn't expose, only their slug
+func archiveEntry(v VodInfo) string {
+	if v.IsClip {
+		return ""
+	}
+	return "twitchvod v" + strings.TrimPrefix(v.ID, "v")
+}
+
+func (b *Backfill) queued(downloadId, user, videoId string) error {
+	v, err := json.Marshal(pendingVideo{User: user, ID: videoId})
+	if err != nil {
+		return err
+	}
+
+	return b.source.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillPendingBucket).Put([]byte(downloadId), v)
+	})
+}
+
+// Videos of user queued and not completed yet. The ones whose download
+// failed or has been removed are forgotten, so that they're queued again.
+func (b *Backfill) pending(user string) (map[string]bool, error) {
+	var (
+		pending = make(map[string]bool)
+		stale   [][]byte
+	)
+
+	err := b.source.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillPendingBucket).ForEach(func(k, v []byte) error {
+			var p pendingVideo
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if p.User != user {
+				return nil
+			}
+			if d, err := b.mdb.Get(string(k)); err != nil || failed(d) {
+				stale = append(stale, slices.Clone(k))
+				return nil
+			}
+			pending[p.ID] = true
+			return nil
+		})
+	})
+	if err != nil || len(stale) == 0 {
+		return pending, err
+	}
+
+	return pending, b.source.db.Update(func(tx *bolt.Tx) error {
+		for _, k := range stale {
+			if err := tx.Bucket(backfillPendingBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func failed(d downloaders.Downloader) bool {
+	status := d.Status().Progress.Status
+	return status == internal.StatusErrored || status == internal.StatusCorrupt
+}
+
+// Record the video of a completed backfill download
+func (b *Backfill) completed(d downloaders.Downloader) {
+	var p pendingVideo
+
+	err := b.source.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(backfillPendingBucket)
+
+		v := pending.Get([]byte(d.GetId()))
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		return pending.Delete([]byte(d.GetId()))
+	})
+	if err == nil && p.ID != "" {
+		err = b.source.markRecorded(p.User, p.ID)
+	}
+	if err != nil {
+		slog.Error("failed to record the backfill download", slog.String("id", d.GetId()), slog.Any("err", err))
+	}
+}
+
+func (s *Source) recorded(user string) (map[string]bool, error) {
+	recorded := make(map[string]bool)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(backfillBucket).Bucket([]byte(user))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			recorded[string(k)] = true
+			return nil
+		})
+	})
+
+	return recorded, err
+}
+
+func (s *Source) markRecorded(user string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := []byte(time.Now().Format(time.RFC3339))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(backfillBucket).CreateBucketIfNotExists([]byte(user))
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := b.Put([]byte(id), now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
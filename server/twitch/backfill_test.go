@@ -0,0 +1,216 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestVideosPagination(t *testing.T) {
+	client, _ := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/helix/videos" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("user_id") != "42" {
+			t.Errorf("unexpected user %s", r.URL.Query().Get("user_id"))
+		}
+
+		// three pages of two videos
+		page, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+		var data []map[string]string
+		for i := range 2 {
+			id := strconv.Itoa(page*2 + i)
+			data = append(data, map[string]string{"id": id, "stream_id": "s" + id})
+		}
+
+		cursor := ""
+		if page < 2 {
+			cursor = strconv.Itoa(page + 1)
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":       data,
+			"pagination": map[string]string{"cursor": cursor},
+		})
+	})
+
+	vods, err := client.Videos("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, v := range vods {
+		ids = append(ids, v.ID)
+		if v.StreamID != "s"+v.ID {
+			t.Errorf("vod %s: unexpected stream id %s", v.ID, v.StreamID)
+		}
+	}
+	if want := []string{"0", "1", "2", "3", "4", "5"}; !slices.Equal(ids, want) {
+		t.Errorf("got vods %v, want %v", ids, want)
+	}
+}
+
+func TestClipsPagination(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		firsts []int
+	)
+
+	client, _ := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		mu.Lock()
+		firsts = append(firsts, first)
+		mu.Unlock()
+
+		// pages of at most 100 clips, whatever is asked
+		offset, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+		var data []map[string]any
+		for i := range min(first, 100) {
+			data = append(data, map[string]any{"id": fmt.Sprintf("clip%d", offset+i), "duration": 30.5})
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":       data,
+			"pagination": map[string]string{"cursor": strconv.Itoa(offset + len(data))},
+		})
+	})
+
+	clips, err := client.Clips("42", 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(clips) != 250 {
+		t.Fatalf("got %d clips, want 250", len(clips))
+	}
+	if !slices.Equal(firsts, []int{100, 100, 50}) {
+		t.Errorf("unexpected page sizes %v", firsts)
+	}
+	if clips[249].ID != "clip249" || !clips[249].IsClip || clips[249].Duration != "30.5s" {
+		t.Errorf("unexpected last clip %+v", clips[249])
+	}
+}
+
+func TestBackfillable(t *testing.T) {
+	videos := []VodInfo{
+		{ID: "1", StreamID: "100"},
+		{ID: "2", StreamID: "200"},
+		{ID: "3", StreamID: "300"},
+		{ID: "4", StreamID: "400"},
+		{ID: "5"},
+		{ID: "SlugOne", IsClip: true},
+		{ID: "SlugTwo", IsClip: true},
+	}
+
+	recorded := map[string]bool{
+		"1": true,
+		// recorded while live
+		"stream/200": true,
+		"SlugOne":    true,
+	}
+	pending := map[string]bool{"3": true}
+	archived := map[string]bool{
+		"twitchvod v4": true,
+		// clips are archived by their numeric id, not the slug
+		"twitchclips 123456":  true,
+		"twitchclips SlugTwo": true,
+	}
+
+	var ids []string
+	for _, v := range backfillable(videos, recorded, pending, archived) {
+		ids = append(ids, v.ID)
+	}
+
+	if want := []string{"5", "SlugTwo"}; !slices.Equal(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
+
+func TestBackfillRecordsOnCompletion(t *testing.T) {
+	if config.Instance().Server.QueueSize <= 0 {
+		config.Instance().Server.QueueSize = 2
+	}
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pipelines, err := pipeline.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdb, err := kv.NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mq, err := queue.NewMessageQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSource(NewAuthenticationManager("client", "secret"), db, mdb, mq, pipelines)
+	b := NewBackfill(s, channel.NewMonitor(db, pipelines), mdb, mq, pipelines)
+
+	enqueue := func(videoId string) downloaders.Downloader {
+		d := downloaders.NewGenericDownload("https://www.twitch.tv/videos/"+videoId, []string{})
+		mdb.Set(d)
+		if err := b.queued(d.GetId(), "streamer", videoId); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	var (
+		completed = enqueue("1")
+		failed    = enqueue("2")
+		removed   = enqueue("3")
+		_         = enqueue("4")
+	)
+
+	failed.SetProgress(internal.DownloadProgress{Status: internal.StatusErrored})
+	mdb.Delete(removed.GetId())
+
+	b.completed(completed)
+
+	recorded, err := s.recorded("streamer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recorded["1"] || len(recorded) != 1 {
+		t.Errorf("unexpected recorded videos %v", recorded)
+	}
+
+	// the failed and removed downloads are forgotten
+	pending, err := b.pending("streamer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending["4"] || len(pending) != 1 {
+		t.Errorf("unexpected pending videos %v", pending)
+	}
+
+	if pending, _ := b.pending("someone-else"); len(pending) != 0 {
+		t.Errorf("unexpected pending videos of another user %v", pending)
+	}
+}
@@ -0,0 +1,316 @@
+package twitch
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+)
+
+const twitchChatURL = "wss://irc-ws.chat.twitch.tv:443"
+
+const (
+	chatMinBackoff = time.Second
+	chatMaxBackoff = time.Minute
+	// how long a message stays on screen in the subtitle track
+	chatCueDuration = 5 * time.Second
+	// messages on screen at the same time
+	chatCueLines = 5
+)
+
+// A chat message, one line of the JSONL capture
+type ChatMessage struct {
+	Id   string    `json:"id,omitempty"`
+	Time time.Time `json:"time"`
+	// seconds since the start of the capture
+	Offset  float64 `json:"offset"`
+	User    string  `json:"user"`
+	Color   string  `json:"color,omitempty"`
+	Message string  `json:"message"`
+}
+
+// Records the chat of a channel, read anonymously through IRC over WebSocket
+type ChatCapture struct {
+	URL     string
+	Channel string
+	// path of the capture without extension, the messages are written to
+	// <path>.chat.jsonl and the subtitles to <path>.srt
+	Path      string
+	Subtitles bool
+	// closed once the recording starts, the offsets are relative to it.
+	// If nil the capture starts right away.
+	Started <-chan struct{}
+
+	start time.Time
+}
+
+func NewChatCapture(channel, path string, subtitles bool) *ChatCapture {
+	return &ChatCapture{
+		URL:       cmp.Or(config.Instance().Twitch.ChatURL, twitchChatURL),
+		Channel:   strings.ToLower(channel),
+		Path:      path,
+		Subtitles: subtitles,
+	}
+}
+
+// Capture the chat until ctx is done, then render the subtitles if requested.
+// A dropped connection is reopened with an exponential backoff.
+func (c *ChatCapture) Run(ctx context.Context) error {
+	// the messages sent before the recording aren't in it
+	if c.Started != nil {
+		select {
+		case <-c.Started:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(c.Path+".chat.jsonl", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.start = time.Now()
+	enc := json.NewEncoder(f)
+
+	slog.Info("capturing twitch chat", slog.String("channel", c.Channel), slog.String("path", f.Name()))
+
+	backoff := chatMinBackoff
+
+	for ctx.Err() == nil {
+		connected, err := c.read(ctx, enc)
+		if ctx.Err() != nil {
+			break
+		}
+		if connected {
+			backoff = chatMinBackoff
+		}
+
+		slog.Warn("twitch chat disconnected",
+			slog.String("channel", c.Channel),
+			slog.Any("err", err),
+			slog.Duration("retry", backoff),
+		)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, chatMaxBackoff)
+	}
+
+	if !c.Subtitles {
+		return nil
+	}
+
+	return RenderChatSubtitles(c.Path+".chat.jsonl", c.Path+".srt")
+}
+
+// Join the channel and write its messages until the connection drops.
+// Reports whether the channel has been joined.
+func (c *ChatCapture) read(ctx context.Context, enc *json.Encoder) (bool, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// unblocks the read below
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	login := []string{
+		"CAP REQ :twitch.tv/tags twitch.tv/commands",
+		// anonymous, read only
+		fmt.Sprintf("NICK justinfan%d", rand.IntN(90000)+10000),
+		"JOIN #" + c.Channel,
+	}
+	for _, line := range login {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(line+"\r\n")); err != nil {
+			return false, err
+		}
+	}
+
+	var joined bool
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return joined, err
+		}
+
+		// a frame can carry several messages
+		for line := range strings.SplitSeq(strings.TrimRight(string(data), "\r\n"), "\r\n") {
+			msg := parseIRC(line)
+
+			switch msg.command {
+			case "PING":
+				if err := conn.WriteMessage(websocket.TextMessage, []byte("PONG :"+msg.trailing+"\r\n")); err != nil {
+					return joined, err
+				}
+			case "JOIN":
+				joined = true
+			case "RECONNECT":
+				return joined, errors.New("reconnection requested by the server")
+			case "PRIVMSG":
+				if err := enc.Encode(c.message(msg)); err != nil {
+					return joined, err
+				}
+			}
+		}
+	}
+}
+
+func (c *ChatCapture) message(msg ircMessage) ChatMessage {
+	sent := time.Now()
+	if ms, err := strconv.ParseInt(msg.tags["tmi-sent-ts"], 10, 64); err == nil {
+		sent = time.UnixMilli(ms)
+	}
+
+	user := msg.tags["display-name"]
+	if user == "" {
+		user, _, _ = strings.Cut(msg.prefix, "!")
+	}
+
+	return ChatMessage{
+		Id:      msg.tags["id"],
+		Time:    sent,
+		Offset:  max(sent.Sub(c.start).Seconds(), 0),
+		User:    user,
+		Color:   msg.tags["color"],
+		Message: msg.trailing,
+	}
+}
+
+type ircMessage struct {
+	tags     map[string]string
+	prefix   string
+	command  string
+	trailing string
+}
+
+// Parse an IRCv3 message, e.g.
+// @display-name=User;tmi-sent-ts=1700000000000 :user!user@user.tmi.twitch.tv PRIVMSG #channel :hello
+func parseIRC(line string) ircMessage {
+	msg := ircMessage{tags: make(map[string]string)}
+
+	if rest, ok := strings.CutPrefix(line, "@"); ok {
+		var tags string
+		tags, line, _ = strings.Cut(rest, " ")
+		for tag := range strings.SplitSeq(tags, ";") {
+			k, v, _ := strings.Cut(tag, "=")
+			msg.tags[k] = unescapeTag(v)
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(line, ":"); ok {
+		msg.prefix, line, _ = strings.Cut(rest, " ")
+	}
+
+	line, msg.trailing, _ = strings.Cut(line, " :")
+	msg.command, _, _ = strings.Cut(line, " ")
+
+	return msg
+}
+
+func unescapeTag(v string) string {
+	return strings.NewReplacer(
+		`\:`, ";",
+		`\s`, " ",
+		`\\`, `\`,
+		`\r`, "\r",
+		`\n`, "\n",
+	).Replace(v)
+}
+
+// Render a JSONL chat capture as a SRT subtitle track, each cue shows the
+// latest messages.
+func RenderChatSubtitles(capture, path string) error {
+	in, err := os.Open(capture)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var messages []ChatMessage
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var m ChatMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var (
+		w   = bufio.NewWriter(out)
+		cue int
+	)
+
+	for i, m := range messages {
+		var (
+			start = offsetDuration(m.Offset)
+			end   = start + chatCueDuration
+			lines []string
+		)
+
+		if i+1 < len(messages) {
+			end = min(end, offsetDuration(messages[i+1].Offset))
+		}
+		if end <= start {
+			// replaced by the next cue right away
+			continue
+		}
+
+		for _, prev := range messages[max(i-chatCueLines+1, 0) : i+1] {
+			if start-offsetDuration(prev.Offset) < chatCueDuration {
+				lines = append(lines, prev.User+": "+strings.ReplaceAll(prev.Message, "\n", " "))
+			}
+		}
+
+		cue++
+		fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", cue, srtTimestamp(start), srtTimestamp(end), strings.Join(lines, "\n"))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+func offsetDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+func srtTimestamp(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d",
+		int(d.Hours()),
+		int(d.Minutes())%60,
+		int(d.Seconds())%60,
+		d.Milliseconds()%1000,
+	)
+}
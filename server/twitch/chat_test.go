@@ -0,0 +1,264 @@
+package twitch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stand-in of the twitch IRC over WebSocket endpoint.
+// script is run once the client joined the channel.
+func fakeChat(t *testing.T, script func(conn *websocket.Conn, attempt int32)) string {
+	var (
+		upgrader websocket.Upgrader
+		attempts atomic.Int32
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		attempt := attempts.Add(1)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if channel, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "JOIN "); ok {
+				conn.WriteMessage(websocket.TextMessage, fmt.Appendf(nil, ":justinfan!justinfan@justinfan.tmi.twitch.tv JOIN %s\r\n", channel))
+				break
+			}
+		}
+
+		script(conn, attempt)
+
+		// keep the connection open until the client leaves
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func privmsg(user, text string, sent time.Time) string {
+	return fmt.Sprintf(
+		"@display-name=%s;id=%s-%d;tmi-sent-ts=%d :%s!%s@%s.tmi.twitch.tv PRIVMSG #streamer :%s\r\n",
+		user, user, sent.UnixMilli(), sent.UnixMilli(), strings.ToLower(user), strings.ToLower(user), strings.ToLower(user), text,
+	)
+}
+
+func readCapture(t *testing.T, path string) []ChatMessage {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var messages []ChatMessage
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m ChatMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages
+}
+
+func TestChatCapture(t *testing.T) {
+	pong := make(chan string, 1)
+
+	url := fakeChat(t, func(conn *websocket.Conn, _ int32) {
+		conn.WriteMessage(websocket.TextMessage, []byte("PING :tmi.twitch.tv\r\n"))
+
+		_, data, _ := conn.ReadMessage()
+		pong <- strings.TrimSpace(string(data))
+
+		now := time.Now()
+		// two messages in the same frame
+		conn.WriteMessage(websocket.TextMessage, []byte(
+			privmsg("Alice", "hello chat", now)+privmsg("Bob", "hi :)", now.Add(time.Second)),
+		))
+	})
+
+	path := filepath.Join(t.TempDir(), "streamer (live)")
+
+	c := NewChatCapture("Streamer", path, true)
+	c.URL = url
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	select {
+	case got := <-pong:
+		if got != "PONG :tmi.twitch.tv" {
+			t.Fatalf("unexpected ping reply %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the capture didn't reply to the ping")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readCapture(t, path+".chat.jsonl")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("messages not captured")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// the recording ended
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	messages := readCapture(t, path+".chat.jsonl")
+	if messages[0].User != "Alice" || messages[0].Message != "hello chat" {
+		t.Errorf("unexpected message %+v", messages[0])
+	}
+	if messages[1].User != "Bob" || messages[1].Message != "hi :)" {
+		t.Errorf("unexpected message %+v", messages[1])
+	}
+	if math.Abs(messages[1].Offset-messages[0].Offset-1) > 0.01 {
+		t.Errorf("unexpected offsets %v %v", messages[0].Offset, messages[1].Offset)
+	}
+
+	srt, err := os.ReadFile(path + ".srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(srt), "Alice: hello chat\nBob: hi :)") {
+		t.Errorf("unexpected subtitles:\n%s", srt)
+	}
+}
+
+func TestChatCaptureReconnects(t *testing.T) {
+	url := fakeChat(t, func(conn *websocket.Conn, attempt int32) {
+		if attempt == 1 {
+			conn.WriteMessage(websocket.TextMessage, []byte(":tmi.twitch.tv RECONNECT\r\n"))
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(privmsg("Alice", "back again", time.Now())))
+	})
+
+	path := filepath.Join(t.TempDir(), "streamer (live)")
+
+	c := NewChatCapture("streamer", path, false)
+	c.URL = url
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readCapture(t, path+".chat.jsonl")) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("messages not captured after the reconnection")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".srt"); !os.IsNotExist(err) {
+		t.Error("subtitles rendered without being requested")
+	}
+}
+
+func TestChatCaptureWaitsForTheRecording(t *testing.T) {
+	joined := make(chan time.Time, 1)
+
+	url := fakeChat(t, func(conn *websocket.Conn, _ int32) {
+		joined <- time.Now()
+		conn.WriteMessage(websocket.TextMessage, []byte(privmsg("Alice", "first", time.Now().Add(2*time.Second))))
+	})
+
+	path := filepath.Join(t.TempDir(), "streamer (live)")
+
+	started := make(chan struct{})
+
+	c := NewChatCapture("streamer", path, false)
+	c.URL = url
+	c.Started = started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	select {
+	case <-joined:
+		t.Fatal("the chat has been joined before the recording started")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(started)
+	start := time.Now()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readCapture(t, path+".chat.jsonl")) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("messages not captured")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// sent 2s after joining, which follows the start
+	offset := readCapture(t, path+".chat.jsonl")[0].Offset
+	if want := (<-joined).Add(2 * time.Second).Sub(start).Seconds(); math.Abs(offset-want) > 0.1 {
+		t.Errorf("offset %v, want %v", offset, want)
+	}
+}
+
+func TestChatCaptureWithoutRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "streamer (live)")
+
+	c := NewChatCapture("streamer", path, true)
+	c.URL = "ws://127.0.0.1:1"
+	c.Started = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".chat.jsonl"); !os.IsNotExist(err) {
+		t.Error("chat captured for a recording that never started")
+	}
+}
@@ -1,27 +1,70 @@
 package twitch
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
 )
 
 const twitchAPIURL = "https://api.twitch.tv/helix"
 
+const (
+	// max user_login values of a /streams request
+	streamsBatchSize = 100
+	// retries of a rate limited request
+	maxRateLimitRetries = 3
+	// upper bound of the wait for the rate limit reset
+	maxRateLimitWait = time.Minute
+	// pages of a paginated listing, each up to 100 entries
+	maxPages = 10
+)
+
 type Client struct {
-	authenticationManager AuthenticationManager
+	authenticationManager *AuthenticationManager
+	// Helix base url
+	BaseURL string
+
+	mu sync.Mutex
+	// set when the rate limit bucket is empty
+	resetAt time.Time
 }
 
 func NewTwitchClient(am *AuthenticationManager) *Client {
+	baseURL := cmp.Or(config.Instance().Twitch.APIURL, twitchAPIURL)
+
 	return &Client{
-		authenticationManager: *am,
+		authenticationManager: am,
+		BaseURL:               strings.TrimSuffix(baseURL, "/"),
 	}
 }
 
+// Non 2xx response of the Helix API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("twitch api: %d %s", e.StatusCode, e.Body)
+}
+
 type streamResp struct {
 	Data []struct {
 		ID        string `json:"id"`
+		UserLogin string `json:"user_login"`
 		UserName  string `json:"user_name"`
 		Title     string `json:"title"`
 		GameName  string `json:"game_name"`
@@ -30,62 +73,338 @@ type streamResp struct {
 }
 
 func (c *Client) doRequest(endpoint string, params map[string]string) ([]byte, error) {
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	return c.request(http.MethodGet, endpoint, query, nil)
+}
+
+// Perform an authenticated Helix request, payload (if not nil) is sent as JSON.
+// Rate limited requests are retried once the limit resets, a rejected token
+// is refreshed and the request retried once.
+func (c *Client) request(method, endpoint string, query url.Values, payload any) ([]byte, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		refreshed bool
+		retries   int
+	)
+
+	for {
+		c.waitRateLimit()
+
+		status, body, err := c.do(method, endpoint, query, data)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case status == http.StatusUnauthorized && !refreshed:
+			slog.Info("twitch token rejected, refreshing")
+			c.authenticationManager.Invalidate()
+			refreshed = true
+
+		case status == http.StatusTooManyRequests && retries < maxRateLimitRetries:
+			retries++
+			// the reset header is missing
+			if c.rateLimitWait() == 0 {
+				time.Sleep(time.Duration(1<<retries) * time.Second)
+			}
+
+		case status < 200 || status > 299:
+			return nil, &APIError{StatusCode: status, Body: string(body)}
+
+		default:
+			return body, nil
+		}
+	}
+}
+
+func (c *Client) do(method, endpoint string, query url.Values, payload []byte) (int, []byte, error) {
 	token, err := c.authenticationManager.GetAccessToken()
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
-	reqURL := twitchAPIURL + endpoint
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return nil, err
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
 	}
 
-	q := req.URL.Query()
-	for k, v := range params {
-		q.Set(k, v)
+	req, err := http.NewRequest(method, c.BaseURL+endpoint, body)
+	if err != nil {
+		return 0, nil, err
 	}
-	req.URL.RawQuery = q.Encode()
+
+	req.URL.RawQuery = query.Encode()
 
 	req.Header.Set("Client-Id", c.authenticationManager.GetClientId())
 	req.Header.Set("Authorization", "Bearer "+token.Token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	c.trackRateLimit(resp.Header)
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, data, nil
+}
+
+// Remember when the rate limit bucket refills once it's empty
+func (c *Client) trackRateLimit(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("Ratelimit-Remaining"))
+	if err != nil || remaining > 0 {
+		return
+	}
+
+	reset, err := strconv.ParseInt(h.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.resetAt = time.Unix(reset, 0)
+	c.mu.Unlock()
+}
+
+func (c *Client) rateLimitWait() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return min(max(time.Until(c.resetAt), 0), maxRateLimitWait)
+}
+
+func (c *Client) waitRateLimit() {
+	if wait := c.rateLimitWait(); wait > 0 {
+		slog.Warn("twitch rate limit reached, waiting", slog.Duration("wait", wait))
+		time.Sleep(wait)
+	}
+}
+
+// Query the state of the given users, batching the requests.
+// A StreamInfo is returned for each of them, in no particular order.
+func (c *Client) PollStreams(logins []string) ([]StreamInfo, error) {
+	var (
+		streams = make([]StreamInfo, 0, len(logins))
+		errs    []error
+	)
+
+	for batch := range slices.Chunk(logins, streamsBatchSize) {
+		query := url.Values{
+			"user_login": batch,
+			"first":      {strconv.Itoa(streamsBatchSize)},
+		}
+
+		body, err := c.request(http.MethodGet, "/streams", query, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var sr streamResp
+		if err := json.Unmarshal(body, &sr); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		live := make(map[string]StreamInfo, len(sr.Data))
+		for _, s := range sr.Data {
+			started, _ := time.Parse(time.RFC3339, s.StartedAt)
+			live[strings.ToLower(s.UserLogin)] = StreamInfo{
+				ID:        s.ID,
+				Title:     s.Title,
+				GameName:  s.GameName,
+				StartedAt: started,
+				IsLive:    true,
+			}
+		}
+
+		// users are reported with the login they're monitored with
+		for _, login := range batch {
+			stream, ok := live[strings.ToLower(login)]
+			if !ok {
+				stream = StreamInfo{IsLive: false}
+			}
+			stream.UserName = login
+			streams = append(streams, stream)
+		}
+	}
+
+	return streams, errors.Join(errs...)
 }
 
 func (c *Client) PollStream(channel string, liveChannel chan<- *StreamInfo) error {
-	body, err := c.doRequest("/streams", map[string]string{"user_login": channel})
+	streams, err := c.PollStreams([]string{channel})
 	if err != nil {
 		return err
 	}
 
-	var sr streamResp
-	if err := json.Unmarshal(body, &sr); err != nil {
-		return err
+	for _, s := range streams {
+		liveChannel <- &s
 	}
 
-	if len(sr.Data) == 0 {
-		liveChannel <- &StreamInfo{UserName: channel, IsLive: false}
-		return nil
+	return nil
+}
+
+type usersResp struct {
+	Data []struct {
+		ID    string `json:"id"`
+		Login string `json:"login"`
+	} `json:"data"`
+}
+
+// Id of the broadcaster with the given login
+func (c *Client) UserId(login string) (string, error) {
+	body, err := c.doRequest("/users", map[string]string{"login": login})
+	if err != nil {
+		return "", err
 	}
 
-	s := sr.Data[0]
-	started, _ := time.Parse(time.RFC3339, s.StartedAt)
+	var ur usersResp
+	if err := json.Unmarshal(body, &ur); err != nil {
+		return "", err
+	}
 
-	liveChannel <- &StreamInfo{
-		ID:        s.ID,
-		UserName:  s.UserName,
-		Title:     s.Title,
-		GameName:  s.GameName,
-		StartedAt: started,
-		IsLive:    true,
+	if len(ur.Data) == 0 {
+		return "", fmt.Errorf("twitch user %s not found", login)
 	}
 
-	return nil
+	return ur.Data[0].ID, nil
+}
+
+type pagination struct {
+	Cursor string `json:"cursor"`
+}
+
+type videosResp struct {
+	Data []struct {
+		ID        string `json:"id"`
+		StreamID  string `json:"stream_id"`
+		Title     string `json:"title"`
+		URL       string `json:"url"`
+		Duration  string `json:"duration"`
+		CreatedAt string `json:"created_at"`
+	} `json:"data"`
+	Pagination pagination `json:"pagination"`
+}
+
+// Past broadcasts of a user, most recent first
+func (c *Client) Videos(userId string) ([]VodInfo, error) {
+	var (
+		vods   []VodInfo
+		cursor string
+	)
+
+	for range maxPages {
+		query := url.Values{
+			"user_id": {userId},
+			"type":    {"archive"},
+			"first":   {"100"},
+		}
+		if cursor != "" {
+			query.Set("after", cursor)
+		}
+
+		body, err := c.request(http.MethodGet, "/videos", query, nil)
+		if err != nil {
+			return vods, err
+		}
+
+		var vr videosResp
+		if err := json.Unmarshal(body, &vr); err != nil {
+			return vods, err
+		}
+
+		for _, v := range vr.Data {
+			created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+			vods = append(vods, VodInfo{
+				ID:        v.ID,
+				StreamID:  v.StreamID,
+				Title:     v.Title,
+				URL:       v.URL,
+				Duration:  v.Duration,
+				CreatedAt: created,
+			})
+		}
+
+		if cursor = vr.Pagination.Cursor; cursor == "" {
+			break
+		}
+	}
+
+	return vods, nil
+}
+
+type clipsResp struct {
+	Data []struct {
+		ID        string  `json:"id"`
+		Title     string  `json:"title"`
+		URL       string  `json:"url"`
+		Duration  float64 `json:"duration"`
+		CreatedAt string  `json:"created_at"`
+	} `json:"data"`
+	Pagination pagination `json:"pagination"`
+}
+
+// The n most viewed clips of a broadcaster
+func (c *Client) Clips(broadcasterId string, n int) ([]VodInfo, error) {
+	var (
+		clips  []VodInfo
+		cursor string
+	)
+
+	for len(clips) < n {
+		query := url.Values{
+			"broadcaster_id": {broadcasterId},
+			"first":          {strconv.Itoa(min(n-len(clips), 100))},
+		}
+		if cursor != "" {
+			query.Set("after", cursor)
+		}
+
+		body, err := c.request(http.MethodGet, "/clips", query, nil)
+		if err != nil {
+			return clips, err
+		}
+
+		var cr clipsResp
+		if err := json.Unmarshal(body, &cr); err != nil {
+			return clips, err
+		}
+
+		for _, v := range cr.Data {
+			created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+			clips = append(clips, VodInfo{
+				ID:        v.ID,
+				Title:     v.Title,
+				URL:       v.URL,
+				Duration:  strconv.FormatFloat(v.Duration, 'f', -1, 64) + "s",
+				CreatedAt: created,
+				IsClip:    true,
+			})
+		}
+
+		if cursor = cr.Pagination.Cursor; cursor == "" || len(cr.Data) == 0 {
+			break
+		}
+	}
+
+	return clips[:min(len(clips), n)], nil
 }
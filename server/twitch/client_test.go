@@ -0,0 +1,141 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type helixStream struct {
+	ID        string `json:"id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+	Title     string `json:"title"`
+}
+
+func setupClient(t *testing.T, handler http.HandlerFunc) (*Client, *atomic.Int32) {
+	var tokens atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2/token" {
+			n := tokens.Add(1)
+			json.NewEncoder(w).Encode(AuthResponse{
+				AccessToken: fmt.Sprintf("token-%d", n),
+				ExpiresIn:   3600,
+			})
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	am := NewAuthenticationManager("client", "secret")
+	am.AuthURL = srv.URL + "/oauth2/token"
+
+	client := NewTwitchClient(am)
+	client.BaseURL = srv.URL + "/helix"
+
+	return client, &tokens
+}
+
+func TestPollStreamsBatches(t *testing.T) {
+	var requests atomic.Int32
+
+	client, _ := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		logins := r.URL.Query()["user_login"]
+		if len(logins) > streamsBatchSize {
+			t.Errorf("batch of %d users", len(logins))
+		}
+
+		// every third user is live
+		var data []helixStream
+		for _, login := range logins {
+			n, _ := strconv.Atoi(login[len("user"):])
+			if n%3 == 0 {
+				data = append(data, helixStream{ID: login, UserLogin: login, UserName: "Display " + login})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+
+	users := make([]string, 250)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+	}
+
+	streams, err := client.PollStreams(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests.Load() != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests.Load())
+	}
+	if len(streams) != len(users) {
+		t.Fatalf("expected %d streams, got %d", len(users), len(streams))
+	}
+
+	for _, s := range streams {
+		n, _ := strconv.Atoi(s.UserName[len("user"):])
+		if s.IsLive != (n%3 == 0) {
+			t.Errorf("%s: unexpected live state %v", s.UserName, s.IsLive)
+		}
+	}
+}
+
+func TestRequestRefreshesRejectedToken(t *testing.T) {
+	client, tokens := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// the first token has been revoked
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": []helixStream{}})
+	})
+
+	if _, err := client.PollStreams([]string{"user0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens.Load() != 2 {
+		t.Fatalf("expected the token to be refreshed once, got %d tokens", tokens.Load())
+	}
+}
+
+func TestRequestWaitsRateLimitReset(t *testing.T) {
+	var (
+		requests atomic.Int32
+		reset    = time.Now().Add(time.Second)
+	)
+
+	client, _ := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if requests.Add(1) == 1 {
+			w.Header().Set("Ratelimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.Header().Set("Ratelimit-Remaining", "799")
+		json.NewEncoder(w).Encode(map[string]any{"data": []helixStream{}})
+	})
+
+	if _, err := client.PollStreams([]string{"user0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests.Load() != 2 {
+		t.Fatalf("expected the request to be retried once, got %d requests", requests.Load())
+	}
+	if time.Now().Before(reset.Truncate(time.Second)) {
+		t.Fatal("the request has been retried before the rate limit reset")
+	}
+}
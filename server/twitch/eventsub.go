@@ -0,0 +1,371 @@
+package twitch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	eventStreamOnline  = "stream.online"
+	eventStreamOffline = "stream.offline"
+
+	headerMessageId        = "Twitch-Eventsub-Message-Id"
+	headerMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	headerMessageSignature = "Twitch-Eventsub-Message-Signature"
+	headerMessageType      = "Twitch-Eventsub-Message-Type"
+
+	messageVerification = "webhook_callback_verification"
+	messageNotification = "notification"
+	messageRevocation   = "revocation"
+
+	// older notifications are rejected, they could be replayed
+	eventSubMaxAge = 10 * time.Minute
+)
+
+type eventSubTransport struct {
+	Method   string `json:"method"`
+	Callback string `json:"callback"`
+	Secret   string `json:"secret,omitempty"`
+}
+
+type eventSubCondition struct {
+	BroadcasterUserId string `json:"broadcaster_user_id"`
+}
+
+type eventSubSubscription struct {
+	ID        string            `json:"id,omitempty"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Status    string            `json:"status,omitempty"`
+	Condition eventSubCondition `json:"condition"`
+	Transport eventSubTransport `json:"transport"`
+}
+
+type eventSubList struct {
+	Data       []eventSubSubscription `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+type eventSubMessage struct {
+	Challenge    string               `json:"challenge"`
+	Subscription eventSubSubscription `json:"subscription"`
+	Event        struct {
+		BroadcasterUserId    string `json:"broadcaster_user_id"`
+		BroadcasterUserLogin string `json:"broadcaster_user_login"`
+		BroadcasterUserName  string `json:"broadcaster_user_name"`
+		ID                   string `json:"id"`
+		StartedAt            string `json:"started_at"`
+	} `json:"event"`
+}
+
+// Receives stream.online and stream.offline notifications from Twitch
+// instead of polling the Helix API.
+// Notifications are delivered to the callback url, which must be publicly
+// reachable and routed to ServeHTTP. They're authenticated with secret.
+type EventSub struct {
+	client   *Client
+	callback string
+	secret   string
+	events   chan<- *StreamInfo
+
+	mu sync.Mutex
+	// subscriptions registered with the callback, by type and broadcaster id
+	existing map[string]string
+	loaded   bool
+	// logins of the subscribed broadcasters by id, a revocation only has the id
+	logins    map[string]string
+	onRevoked func(login string)
+	// twitch may deliver the same message more than once
+	seen map[string]time.Time
+}
+
+func NewEventSub(client *Client, callback, secret string, events chan<- *StreamInfo) *EventSub {
+	return &EventSub{
+		client:   client,
+		callback: callback,
+		secret:   secret,
+		events:   events,
+		existing: make(map[string]string),
+		logins:   make(map[string]string),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Register a function called with the login of a user when twitch revokes
+// one of its subscriptions. The user isn't notified anymore until it's
+// subscribed again.
+func (e *EventSub) OnRevoked(hook func(login string)) {
+	e.mu.Lock()
+	e.onRevoked = hook
+	e.mu.Unlock()
+}
+
+// Register the stream.online and stream.offline subscriptions of a user.
+// Subscriptions already registered for the callback are reused.
+func (e *EventSub) Subscribe(login string) error {
+	id, err := e.client.UserId(login)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.logins[id] = login
+
+	if err := e.load(); err != nil {
+		return err
+	}
+
+	for _, event := range []string{eventStreamOnline, eventStreamOffline} {
+		if _, ok := e.existing[event+":"+id]; ok {
+			continue
+		}
+
+		body, err := e.client.request(http.MethodPost, "/eventsub/subscriptions", nil, eventSubSubscription{
+			Type:      event,
+			Version:   "1",
+			Condition: eventSubCondition{BroadcasterUserId: id},
+			Transport: eventSubTransport{
+				Method:   "webhook",
+				Callback: e.callback,
+				Secret:   e.secret,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("%s subscription: %w", event, err)
+		}
+
+		var created eventSubList
+		if err := json.Unmarshal(body, &created); err != nil {
+			return err
+		}
+		if len(created.Data) == 0 {
+			return fmt.Errorf("%s subscription: empty response", event)
+		}
+
+		e.existing[event+":"+id] = created.Data[0].ID
+	}
+
+	slog.Info("subscribed to twitch eventsub", slog.String("user", login))
+	return nil
+}
+
+// Delete the subscriptions of a user
+func (e *EventSub) Unsubscribe(login string) error {
+	id, err := e.client.UserId(login)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+
+	for _, event := range []string{eventStreamOnline, eventStreamOffline} {
+		subId, ok := e.existing[event+":"+id]
+		if !ok {
+			continue
+		}
+
+		_, err := e.client.request(http.MethodDelete, "/eventsub/subscriptions", url.Values{"id": {subId}}, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		delete(e.existing, event+":"+id)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Fetch the subscriptions registered in a previous run
+func (e *EventSub) load() error {
+	if e.loaded {
+		return nil
+	}
+
+	var cursor string
+
+	for {
+		query := url.Values{}
+		if cursor != "" {
+			query.Set("after", cursor)
+		}
+
+		body, err := e.client.request(http.MethodGet, "/eventsub/subscriptions", query, nil)
+		if err != nil {
+			return err
+		}
+
+		var list eventSubList
+		if err := json.Unmarshal(body, &list); err != nil {
+			return err
+		}
+
+		for _, sub := range list.Data {
+			if sub.Transport.Callback != e.callback {
+				continue
+			}
+			// failed or revoked subscriptions have to be created again
+			if sub.Status != "enabled" && sub.Status != messageVerification+"_pending" {
+				continue
+			}
+			e.existing[sub.Type+":"+sub.Condition.BroadcasterUserId] = sub.ID
+		}
+
+		cursor = list.Pagination.Cursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	e.loaded = true
+	return nil
+}
+
+func (e *EventSub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := e.verify(r.Header, body); err != nil {
+		slog.Warn("rejected eventsub message", slog.Any("err", err))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var msg eventSubMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Header.Get(headerMessageType) {
+	case messageVerification:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(msg.Challenge))
+
+	case messageNotification:
+		if e.duplicate(r.Header.Get(headerMessageId)) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// reported with the login it's monitored with, like the polled streams
+		e.mu.Lock()
+		login, ok := e.logins[msg.Event.BroadcasterUserId]
+		e.mu.Unlock()
+		if !ok {
+			login = msg.Event.BroadcasterUserLogin
+		}
+
+		stream := &StreamInfo{
+			ID:       msg.Event.ID,
+			UserName: login,
+			IsLive:   msg.Subscription.Type == eventStreamOnline,
+		}
+		stream.StartedAt, _ = time.Parse(time.RFC3339, msg.Event.StartedAt)
+
+		select {
+		case e.events <- stream:
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+		}
+
+	case messageRevocation:
+		slog.Warn("twitch eventsub subscription revoked",
+			slog.String("type", msg.Subscription.Type),
+			slog.String("status", msg.Subscription.Status),
+		)
+
+		id := msg.Subscription.Condition.BroadcasterUserId
+
+		e.mu.Lock()
+		delete(e.existing, msg.Subscription.Type+":"+id)
+		login, hook := e.logins[id], e.onRevoked
+		e.mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+
+		if hook != nil && login != "" {
+			hook(login)
+		}
+
+	default:
+		http.Error(w, "unknown message type", http.StatusBadRequest)
+	}
+}
+
+// Check the HMAC-SHA256 signature of the message id, timestamp and body
+func (e *EventSub) verify(h http.Header, body []byte) error {
+	var (
+		id        = h.Get(headerMessageId)
+		timestamp = h.Get(headerMessageTimestamp)
+		signature = h.Get(headerMessageSignature)
+	)
+
+	if id == "" || timestamp == "" || signature == "" {
+		return errors.New("missing eventsub headers")
+	}
+
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return err
+	}
+	if time.Since(sent) > eventSubMaxAge {
+		return errors.New("eventsub message too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(e.secret))
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid eventsub signature")
+	}
+
+	return nil
+}
+
+func (e *EventSub) duplicate(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	// messages older than the max age are rejected anyway
+	for k, t := range e.seen {
+		if now.Sub(t) > eventSubMaxAge {
+			delete(e.seen, k)
+		}
+	}
+
+	if _, ok := e.seen[id]; ok {
+		return true
+	}
+
+	e.seen[id] = now
+	return false
+}
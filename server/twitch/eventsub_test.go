@@ -0,0 +1,362 @@
+package twitch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+// Stand-in for the Helix API and the EventSub delivery
+type fakeTwitch struct {
+	mu         sync.Mutex
+	subs       map[string]eventSubSubscription
+	nextId     int
+	challenges map[string]string // subscription id -> challenge response
+}
+
+func newFakeTwitch() *fakeTwitch {
+	return &fakeTwitch{
+		subs:       make(map[string]eventSubSubscription),
+		challenges: make(map[string]string),
+	}
+}
+
+func (f *fakeTwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/oauth2/token":
+		json.NewEncoder(w).Encode(AuthResponse{AccessToken: "token", ExpiresIn: 3600})
+
+	case r.Header.Get("Authorization") != "Bearer token":
+		w.WriteHeader(http.StatusUnauthorized)
+
+	case r.URL.Path == "/helix/users":
+		login := r.URL.Query().Get("login")
+		fmt.Fprintf(w, `{"data":[{"id":"id-%s","login":"%s"}]}`, login, login)
+
+	case r.URL.Path == "/helix/eventsub/subscriptions" && r.Method == http.MethodGet:
+		list := eventSubList{Data: []eventSubSubscription{}}
+		for _, sub := range f.subs {
+			sub.Transport.Secret = ""
+			list.Data = append(list.Data, sub)
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case r.URL.Path == "/helix/eventsub/subscriptions" && r.Method == http.MethodPost:
+		var sub eventSubSubscription
+		json.NewDecoder(r.Body).Decode(&sub)
+
+		f.nextId++
+		sub.ID = fmt.Sprintf("sub-%d", f.nextId)
+		sub.Status = "enabled"
+		f.subs[sub.ID] = sub
+
+		// twitch checks the callback before enabling the subscription
+		f.challenges[sub.ID] = f.verifyCallback(sub)
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(eventSubList{Data: []eventSubSubscription{sub}})
+
+	case r.URL.Path == "/helix/eventsub/subscriptions" && r.Method == http.MethodDelete:
+		delete(f.subs, r.URL.Query().Get("id"))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeTwitch) verifyCallback(sub eventSubSubscription) string {
+	body, _ := json.Marshal(map[string]any{
+		"challenge":    "challenge-" + sub.ID,
+		"subscription": sub,
+	})
+
+	resp, err := deliver(sub.Transport.Callback, sub.Transport.Secret, messageVerification, "verify-"+sub.ID, time.Now(), body)
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+
+	challenge, _ := io.ReadAll(resp.Body)
+	return string(challenge)
+}
+
+func deliver(callback, secret, msgType, id string, ts time.Time, body []byte) (*http.Response, error) {
+	timestamp := ts.UTC().Format(time.RFC3339Nano)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + timestamp))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(headerMessageId, id)
+	req.Header.Set(headerMessageTimestamp, timestamp)
+	req.Header.Set(headerMessageSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set(headerMessageType, msgType)
+
+	return http.DefaultClient.Do(req)
+}
+
+func setupEventSub(t *testing.T) (*EventSub, *fakeTwitch, chan *StreamInfo, string) {
+	fake := newFakeTwitch()
+	helix := httptest.NewServer(fake)
+	t.Cleanup(helix.Close)
+
+	events := make(chan *StreamInfo, 4)
+
+	am := NewAuthenticationManager("client", "secret")
+	am.AuthURL = helix.URL + "/oauth2/token"
+
+	client := NewTwitchClient(am)
+	client.BaseURL = helix.URL + "/helix"
+
+	var es *EventSub
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		es.ServeHTTP(w, r)
+	}))
+	t.Cleanup(callback.Close)
+
+	es = NewEventSub(client, callback.URL, testSecret, events)
+
+	return es, fake, events, callback.URL
+}
+
+func TestEventSubSubscribe(t *testing.T) {
+	es, fake, _, callback := setupEventSub(t)
+
+	if err := es.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	if len(fake.subs) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", len(fake.subs))
+	}
+	for id, sub := range fake.subs {
+		if sub.Condition.BroadcasterUserId != "id-streamer" {
+			t.Errorf("unexpected condition %+v", sub.Condition)
+		}
+		if sub.Transport.Callback != callback || sub.Transport.Secret != testSecret {
+			t.Errorf("unexpected transport %+v", sub.Transport)
+		}
+		if fake.challenges[id] != "challenge-"+id {
+			t.Errorf("callback verification failed: %s", fake.challenges[id])
+		}
+	}
+	fake.mu.Unlock()
+
+	// already registered
+	if err := es.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.subs) != 2 {
+		t.Fatalf("subscriptions have been duplicated")
+	}
+
+	if err := es.Unsubscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.subs) != 0 {
+		t.Fatalf("expected the subscriptions to be deleted, %d left", len(fake.subs))
+	}
+}
+
+func TestEventSubReusesSubscriptions(t *testing.T) {
+	es, fake, events, callback := setupEventSub(t)
+
+	if err := es.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new process finds the subscriptions of the previous one
+	restarted := NewEventSub(es.client, callback, testSecret, events)
+	if err := restarted.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.subs) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", len(fake.subs))
+	}
+}
+
+func notification(event string) []byte {
+	body, _ := json.Marshal(map[string]any{
+		"subscription": map[string]any{"type": event},
+		"event": map[string]any{
+			"broadcaster_user_id":    "id-streamer",
+			"broadcaster_user_login": "streamer",
+			"broadcaster_user_name":  "Streamer",
+			"started_at":             "2024-07-21T13:00:00Z",
+		},
+	})
+	return body
+}
+
+func TestEventSubNotification(t *testing.T) {
+	_, _, events, callback := setupEventSub(t)
+
+	resp, err := deliver(callback, testSecret, messageNotification, "msg-1", time.Now(), notification(eventStreamOnline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	select {
+	case stream := <-events:
+		if stream.UserName != "streamer" || !stream.IsLive {
+			t.Fatalf("unexpected stream %+v", stream)
+		}
+	default:
+		t.Fatal("no event emitted")
+	}
+
+	// redelivered
+	resp, _ = deliver(callback, testSecret, messageNotification, "msg-1", time.Now(), notification(eventStreamOnline))
+	resp.Body.Close()
+
+	resp, _ = deliver(callback, testSecret, messageNotification, "msg-2", time.Now(), notification(eventStreamOffline))
+	resp.Body.Close()
+
+	select {
+	case stream := <-events:
+		if stream.IsLive {
+			t.Fatal("duplicated notification has been emitted")
+		}
+	default:
+		t.Fatal("no event emitted")
+	}
+}
+
+func TestEventSubNotifiesMonitoredLogin(t *testing.T) {
+	es, _, events, callback := setupEventSub(t)
+
+	// reported with the login it is monitored with, not the one of the event
+	es.mu.Lock()
+	es.logins["id-streamer"] = "old_login"
+	es.mu.Unlock()
+
+	resp, err := deliver(callback, testSecret, messageNotification, "msg-1", time.Now(), notification(eventStreamOnline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	select {
+	case stream := <-events:
+		if stream.UserName != "old_login" {
+			t.Errorf("notified as %s", stream.UserName)
+		}
+	default:
+		t.Fatal("no event emitted")
+	}
+}
+
+func TestEventSubSignature(t *testing.T) {
+	_, _, events, callback := setupEventSub(t)
+
+	body := notification(eventStreamOnline)
+
+	tests := []struct {
+		name   string
+		secret string
+		ts     time.Time
+	}{
+		{"wrong secret", "another-secret-value", time.Now()},
+		{"replayed", testSecret, time.Now().Add(-time.Hour)},
+	}
+
+	for _, tt := range tests {
+		resp, err := deliver(callback, tt.secret, messageNotification, "msg-"+tt.name, tt.ts, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", tt.name, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Post(callback, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned: expected 403, got %d", resp.StatusCode)
+	}
+
+	if len(events) != 0 {
+		t.Fatal("rejected notifications have been emitted")
+	}
+}
+
+func TestEventSubRevocation(t *testing.T) {
+	es, fake, _, callback := setupEventSub(t)
+
+	revoked := make(chan string, 1)
+	es.OnRevoked(func(login string) { revoked <- login })
+
+	if err := es.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"subscription": map[string]any{
+			"type":      eventStreamOnline,
+			"status":    "authorization_revoked",
+			"condition": map[string]any{"broadcaster_user_id": "id-streamer"},
+		},
+	})
+
+	resp, err := deliver(callback, testSecret, messageRevocation, "revoke-1", time.Now(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	select {
+	case login := <-revoked:
+		if login != "streamer" {
+			t.Fatalf("unexpected revoked user %s", login)
+		}
+	default:
+		t.Fatal("revocation not notified")
+	}
+
+	// the revoked subscription is created again
+	if err := es.Subscribe("streamer"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.subs) != 3 {
+		t.Fatalf("expected the revoked subscription to be created again, got %d", len(fake.subs))
+	}
+}
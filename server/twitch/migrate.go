@@ -0,0 +1,64 @@
+package twitch
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Users monitored before twitch became a source of the channel monitor
+var legacyBucket = []byte("twitch-monitor")
+
+// Move the users of the legacy twitch monitor to the channel monitor.
+// The users failing to migrate are kept and retried on the next start.
+func Migrate(db *bolt.DB, cm *channel.Monitor) error {
+	users := make(map[string]UserSettings)
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(legacyBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s UserSettings
+			// users added before the settings were introduced have an empty value
+			if len(v) > 0 {
+				if err := json.Unmarshal(v, &s); err != nil {
+					return err
+				}
+			}
+			users[string(k)] = s
+			return nil
+		})
+	})
+	if err != nil || len(users) == 0 {
+		return err
+	}
+
+	var migrated []string
+
+	for user, settings := range users {
+		if err := cm.Add(ChannelURL(user), settings.channelSettings()); err != nil {
+			slog.Error("failed to migrate twitch user", slog.String("user", user), slog.Any("err", err))
+			continue
+		}
+		migrated = append(migrated, user)
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if len(migrated) == len(users) {
+			return tx.DeleteBucket(legacyBucket)
+		}
+
+		b := tx.Bucket(legacyBucket)
+		for _, user := range migrated {
+			if err := b.Delete([]byte(user)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,446 @@
+package twitch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/config"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/downloaders"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/kv"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipes"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/queue"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const sourceName = "twitch"
+
+// Options of a twitch channel, see UserSettings
+const (
+	optionQuality          = "quality"
+	optionNoTranscode      = "no_transcode"
+	optionFilenameTemplate = "filename_template"
+	optionCaptureChat      = "capture_chat"
+	optionChatSubtitles    = "chat_subtitles"
+	optionBackfillVods     = "backfill_vods"
+	optionBackfillClips    = "backfill_clips"
+	optionMaxClips         = "max_clips"
+	optionBackfillSync     = "backfill_sync"
+)
+
+// Checks the twitch channels through the Helix API, the channel url is
+// https://www.twitch.tv/<login>.
+// The channels are notified through eventsub when it's enabled and recorded
+// with the options of their UserSettings.
+type Source struct {
+	client    *Client
+	db        *bolt.DB
+	mdb       *kv.Store
+	mq        *queue.MessageQueue
+	pipelines *pipeline.Store
+	// nil when polling, see EventSub
+	eventSub *EventSub
+	events   chan *StreamInfo
+
+	mu sync.Mutex
+	// subscribed channels by login
+	watchers map[string]watcher
+}
+
+type watcher struct {
+	notify    func(channel.Status)
+	cancelled func()
+}
+
+func NewSource(
+	authenticationManager *AuthenticationManager,
+	db *bolt.DB,
+	mdb *kv.Store,
+	mq *queue.MessageQueue,
+	pipelines *pipeline.Store,
+) *Source {
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(backfillBucket)
+		return err
+	})
+
+	s := &Source{
+		client:    NewTwitchClient(authenticationManager),
+		db:        db,
+		mdb:       mdb,
+		mq:        mq,
+		pipelines: pipelines,
+		events:    make(chan *StreamInfo, 16),
+		watchers:  make(map[string]watcher),
+	}
+
+	var (
+		callback = config.Instance().Twitch.CallbackURL
+		secret   = config.Instance().Twitch.WebhookSecret
+	)
+
+	switch {
+	case callback == "":
+	case len(secret) < 10 || len(secret) > 100:
+		slog.Warn("twitch eventsub requires a webhook secret of 10 to 100 characters, falling back to polling")
+	default:
+		s.eventSub = NewEventSub(s.client, callback, secret, s.events)
+		s.eventSub.OnRevoked(s.revoked)
+		go s.dispatch()
+	}
+
+	return s
+}
+
+func (s *Source) Name() string { return sourceName }
+
+func (s *Source) Validate(c channel.Channel) error {
+	if _, err := twitchLogin(c.URL); err != nil {
+		return err
+	}
+
+	settings, err := settingsOf(c)
+	if err != nil {
+		return err
+	}
+
+	return settings.Validate()
+}
+
+func (s *Source) Check(ctx context.Context, c channel.Channel) (channel.Status, error) {
+	statuses, err := s.CheckAll(ctx, []channel.Channel{c})
+	return statuses[c.URL], err
+}
+
+// Users are polled in batches, each request covers up to 100 of them
+func (s *Source) CheckAll(ctx context.Context, channels []channel.Channel) (map[string]channel.Status, error) {
+	urls := make(map[string]string, len(channels))
+
+	for _, c := range channels {
+		login, err := twitchLogin(c.URL)
+		if err != nil {
+			return nil, err
+		}
+		urls[login] = c.URL
+	}
+
+	streams, err := s.client.PollStreams(slices.Collect(maps.Keys(urls)))
+
+	statuses := make(map[string]channel.Status, len(streams))
+	for _, stream := range streams {
+		statuses[urls[stream.UserName]] = channel.Status{
+			Live:  stream.IsLive,
+			Title: stream.Title,
+			ID:    stream.ID,
+		}
+	}
+
+	return statuses, err
+}
+
+// Notify the channel through eventsub, errors.ErrUnsupported if it's disabled
+func (s *Source) Subscribe(c channel.Channel, notify func(channel.Status), cancelled func()) error {
+	if s.eventSub == nil {
+		return errors.ErrUnsupported
+	}
+
+	login, err := twitchLogin(c.URL)
+	if err != nil {
+		return err
+	}
+
+	// the first notification may come before Subscribe returns
+	s.mu.Lock()
+	s.watchers[login] = watcher{notify: notify, cancelled: cancelled}
+	s.mu.Unlock()
+
+	if err := s.eventSub.Subscribe(login); err != nil {
+		s.mu.Lock()
+		delete(s.watchers, login)
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (s *Source) Unsubscribe(c channel.Channel) error {
+	login, err := twitchLogin(c.URL)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.watchers, login)
+	s.mu.Unlock()
+
+	if s.eventSub == nil {
+		return nil
+	}
+
+	return s.eventSub.Unsubscribe(login)
+}
+
+// Stop notifying a user whose subscription has been revoked
+func (s *Source) revoked(login string) {
+	s.mu.Lock()
+	w, ok := s.watchers[login]
+	delete(s.watchers, login)
+	s.mu.Unlock()
+
+	if ok {
+		w.cancelled()
+	}
+}
+
+// Forward the eventsub notifications to the subscribed channels
+func (s *Source) dispatch() {
+	for stream := range s.events {
+		s.mu.Lock()
+		w, ok := s.watchers[stream.UserName]
+		s.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		w.notify(channel.Status{
+			Live:  stream.IsLive,
+			Title: stream.Title,
+			ID:    stream.ID,
+		})
+	}
+}
+
+// Receives the eventsub notifications
+func (s *Source) EventSubHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.eventSub == nil {
+			http.Error(w, "twitch eventsub is not enabled", http.StatusNotFound)
+			return
+		}
+		s.eventSub.ServeHTTP(w, r)
+	}
+}
+
+// Record the stream of a channel gone live with its UserSettings
+func (s *Source) Record(c channel.Channel, status channel.Status) (<-chan struct{}, error) {
+	login, err := twitchLogin(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := settingsOf(c)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := StreamInfo{
+		ID:       status.ID,
+		UserName: login,
+		Title:    status.Title,
+		IsLive:   true,
+	}
+
+	p := s.pipelines.ResolveOrNone(settings.PipelineId)
+
+	filename, err := settings.Filename(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dir    = cmp.Or(settings.OutputPath, config.Instance().Paths.DownloadPath)
+		path   = filepath.Join(dir, filename)
+		params []string
+		chain  []pipes.Pipe
+	)
+
+	if err := internal.ValidateSubPath(path); err != nil {
+		return nil, err
+	}
+
+	if settings.Quality != "" {
+		params = append(params, "-f", settings.Quality)
+	}
+
+	// without pipes the stream is saved as is
+	if !settings.NoTranscode {
+		chain = []pipes.Pipe{
+			&pipes.Transcoder{
+				Args: []string{
+					"-c:a", "libopus",
+					"-c:v", "libsvtav1",
+					"-crf", "30",
+					"-preset", "7",
+				},
+			},
+			&pipes.FileWriter{
+				Path:    path + ".webm",
+				IsFinal: true,
+			},
+		}
+	}
+
+	d := downloaders.NewLiveStreamDownloader("https://www.twitch.tv/"+login, chain, params...)
+	d.SetOutput(internal.DownloadOutput{Path: dir, Filename: filename})
+	// replaces the default transcoding
+	d.SetPipeline(p)
+
+	s.mdb.Set(d)
+	s.mq.Publish(d)
+
+	if settings.CaptureChat {
+		captureChat(login, path, settings.ChatSubtitles, d)
+	}
+
+	if stream.ID != "" {
+		// its vod won't be backfilled
+		if err := s.markRecorded(login, "stream/"+stream.ID); err != nil {
+			slog.Error("failed to record the stream", slog.String("user", login), slog.Any("err", err))
+		}
+	}
+
+	return d.(*downloaders.LiveStreamDownloader).Done(), nil
+}
+
+// Capture the chat of user from the start of the recording d until it ends
+func captureChat(user, path string, subtitles bool, d downloaders.Downloader) {
+	rec, ok := d.(interface {
+		Started() <-chan struct{}
+		Done() <-chan struct{}
+	})
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-rec.Done()
+		cancel()
+	}()
+
+	go func() {
+		c := NewChatCapture(user, path, subtitles)
+		c.Started = rec.Started()
+
+		if err := c.Run(ctx); err != nil {
+			slog.Error("chat capture failed", slog.String("user", user), slog.Any("err", err))
+		}
+	}()
+}
+
+// Login of a twitch channel url, lowercase as the API reports it
+func twitchLogin(channelURL string) (string, error) {
+	u, err := url.Parse(channelURL)
+	if err != nil {
+		return "", err
+	}
+
+	login := strings.Trim(u.Path, "/")
+	host := strings.TrimPrefix(strings.TrimPrefix(u.Hostname(), "www."), "m.")
+
+	if host != "twitch.tv" || login == "" || strings.Contains(login, "/") {
+		return "", errors.New("a twitch channel url is https://www.twitch.tv/<login>")
+	}
+
+	return strings.ToLower(login), nil
+}
+
+// Url of the channel of a twitch user
+func ChannelURL(login string) string {
+	return "https://www.twitch.tv/" + strings.ToLower(login)
+}
+
+// Recording options of a twitch channel, the shared settings and its options
+func settingsOf(c channel.Channel) (UserSettings, error) {
+	settings := UserSettings{
+		PipelineId: c.Settings.PipelineId,
+		OutputPath: c.Settings.Path,
+	}
+
+	var errs []error
+
+	for key, value := range c.Settings.Options {
+		var err error
+
+		switch key {
+		case optionQuality:
+			settings.Quality = value
+		case optionFilenameTemplate:
+			settings.FilenameTemplate = value
+		case optionNoTranscode:
+			settings.NoTranscode, err = strconv.ParseBool(value)
+		case optionCaptureChat:
+			settings.CaptureChat, err = strconv.ParseBool(value)
+		case optionChatSubtitles:
+			settings.ChatSubtitles, err = strconv.ParseBool(value)
+		case optionBackfillVods:
+			settings.Backfill.Vods, err = strconv.ParseBool(value)
+		case optionBackfillClips:
+			settings.Backfill.Clips, err = strconv.ParseBool(value)
+		case optionBackfillSync:
+			settings.Backfill.Sync, err = strconv.ParseBool(value)
+		case optionMaxClips:
+			settings.Backfill.MaxClips, err = strconv.Atoi(value)
+		default:
+			err = errors.New("unknown option")
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	return settings, errors.Join(errs...)
+}
+
+// Settings of the twitch channel recorded with s
+func (s UserSettings) channelSettings() channel.Settings {
+	options := make(map[string]string)
+
+	set := func(key, value string) {
+		if value != "" {
+			options[key] = value
+		}
+	}
+	setBool := func(key string, v bool) {
+		if v {
+			options[key] = strconv.FormatBool(v)
+		}
+	}
+
+	set(optionQuality, s.Quality)
+	set(optionFilenameTemplate, s.FilenameTemplate)
+	setBool(optionNoTranscode, s.NoTranscode)
+	setBool(optionCaptureChat, s.CaptureChat)
+	setBool(optionChatSubtitles, s.ChatSubtitles)
+	setBool(optionBackfillVods, s.Backfill.Vods)
+	setBool(optionBackfillClips, s.Backfill.Clips)
+	setBool(optionBackfillSync, s.Backfill.Sync)
+	if s.Backfill.MaxClips != 0 {
+		options[optionMaxClips] = strconv.Itoa(s.Backfill.MaxClips)
+	}
+
+	return channel.Settings{
+		PipelineId: s.PipelineId,
+		Path:       s.OutputPath,
+		Source:     sourceName,
+		Options:    options,
+	}
+}
@@ -0,0 +1,165 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/channel"
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal/pipeline"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSourceCheckAll(t *testing.T) {
+	client, _ := setupClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if logins := r.URL.Query()["user_login"]; len(logins) != 2 {
+			t.Errorf("unexpected users %v", logins)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []helixStream{{ID: "42", UserLogin: "streamer", Title: "live"}},
+		})
+	})
+
+	s := &Source{client: client}
+
+	channels := []channel.Channel{
+		{URL: "https://www.twitch.tv/Streamer"},
+		{URL: "https://m.twitch.tv/offline"},
+	}
+
+	statuses, err := s.CheckAll(context.Background(), channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := statuses[channels[0].URL]; !got.Live || got.ID != "42" || got.Title != "live" {
+		t.Errorf("unexpected status of the live channel %+v", got)
+	}
+	if got, ok := statuses[channels[1].URL]; !ok || got.Live {
+		t.Errorf("unexpected status of the offline channel %+v", got)
+	}
+}
+
+func TestSourceValidate(t *testing.T) {
+	s := &Source{}
+
+	tests := []struct {
+		url     string
+		options map[string]string
+		valid   bool
+	}{
+		{"https://www.twitch.tv/streamer", nil, true},
+		{"https://twitch.tv/streamer", map[string]string{optionCaptureChat: "true", optionChatSubtitles: "true"}, true},
+		{"https://kick.com/streamer", nil, false},
+		{"https://www.twitch.tv/videos/1", nil, false},
+		{"https://www.twitch.tv/streamer", map[string]string{optionCaptureChat: "yes please"}, false},
+		{"https://www.twitch.tv/streamer", map[string]string{optionChatSubtitles: "true"}, false},
+		{"https://www.twitch.tv/streamer", map[string]string{"unknown": "1"}, false},
+	}
+
+	for _, tt := range tests {
+		c := channel.Channel{URL: tt.url, Settings: channel.Settings{Source: sourceName, Options: tt.options}}
+		if err := s.Validate(c); (err == nil) != tt.valid {
+			t.Errorf("%s %v: unexpected error %v", tt.url, tt.options, err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pipelines, err := pipeline.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm := channel.NewMonitor(db, pipelines)
+	cm.Register(&Source{})
+
+	settings := UserSettings{
+		Quality:     "720p60",
+		CaptureChat: true,
+		Backfill:    BackfillSettings{Clips: true, MaxClips: 50},
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(legacyBucket)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("streamer"), data); err != nil {
+			return err
+		}
+		// added before the settings were introduced
+		return b.Put([]byte("legacy"), nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db, cm); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cm.Get("https://www.twitch.tv/streamer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := settingsOf(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != settings {
+		t.Errorf("migrated as %+v, want %+v", migrated, settings)
+	}
+
+	if _, err := cm.Get("https://www.twitch.tv/legacy"); err != nil {
+		t.Error(err)
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(legacyBucket) != nil {
+			t.Error("the legacy bucket is left")
+		}
+		return nil
+	})
+}
+
+func TestFilename(t *testing.T) {
+	tests := []struct {
+		template string
+		title    string
+		want     string
+	}{
+		{"{user} - {title}", "a/b", "streamer - a_b"},
+		{"{title}", "..", ""},
+		{"{title}", ".", ""},
+		{"{title}", "", ""},
+	}
+
+	for _, tt := range tests {
+		s := UserSettings{FilenameTemplate: tt.template}
+
+		name, err := s.Filename(StreamInfo{UserName: "streamer", Title: tt.title})
+		if name != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("%q with %q: got %q, %v", tt.template, tt.title, name, err)
+		}
+	}
+
+	for _, template := range []string{"..", ".", "a/b"} {
+		if err := (UserSettings{FilenameTemplate: template}).Validate(); err == nil {
+			t.Errorf("%q: expected an error", template)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package twitch
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marcopiovanello/yt-dlp-web-ui/v4/server/internal"
+)
 
 type StreamInfo struct {
 	ID        string
@@ -11,10 +18,93 @@ type StreamInfo struct {
 	IsLive    bool
 }
 
+// A past broadcast or a clip
 type VodInfo struct {
-	ID        string
+	ID string
+	// broadcast of the vod, empty for clips
+	StreamID  string
 	Title     string
 	URL       string
 	Duration  string
 	CreatedAt time.Time
+	IsClip    bool
+}
+
+// Recording options of a monitored user, persisted in the twitch-monitor bucket
+type UserSettings struct {
+	PipelineId string `json:"pipeline_id,omitempty"`
+	// yt-dlp format selector (e.g. "720p60", "audio_only"), best if empty
+	Quality string `json:"quality,omitempty"`
+	// record the stream as served by twitch instead of transcoding it to AV1
+	NoTranscode bool `json:"no_transcode,omitempty"`
+	// directory of the recordings, must be under the download path
+	OutputPath string `json:"output_path,omitempty"`
+	// name of the recordings without extension, supports the {user}, {title}
+	// and {date} placeholders
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// save the chat next to the recording, see ChatCapture
+	CaptureChat bool `json:"capture_chat,omitempty"`
+	// also render the captured chat as a subtitle track
+	ChatSubtitles bool `json:"chat_subtitles,omitempty"`
+	// past broadcasts and clips
+	Backfill BackfillSettings `json:"backfill,omitzero"`
+}
+
+// What a backfill of a user archives, both vods and clips if none is set
+type BackfillSettings struct {
+	Vods  bool `json:"vods,omitempty"`
+	Clips bool `json:"clips,omitempty"`
+	// most viewed clips to archive, 20 if 0
+	MaxClips int `json:"max_clips,omitempty"`
+	// run the backfill periodically, see twitch.sync_interval
+	Sync bool `json:"sync,omitempty"`
+}
+
+const defaultFilenameTemplate = "{user} (live) {date}"
+
+func (s UserSettings) Validate() error {
+	if s.NoTranscode && s.PipelineId != "" {
+		return errors.New("a pipeline can't be used when transcoding is disabled")
+	}
+
+	if s.OutputPath != "" {
+		if err := internal.ValidateSubPath(s.OutputPath); err != nil {
+			return err
+		}
+	}
+
+	if s.ChatSubtitles && !s.CaptureChat {
+		return errors.New("chat subtitles require the chat capture")
+	}
+
+	if s.Backfill.MaxClips < 0 || s.Backfill.MaxClips > maxClips {
+		return fmt.Errorf("max_clips must be between 0 and %d", maxClips)
+	}
+
+	if t := s.FilenameTemplate; strings.ContainsAny(t, `/\`) || t == "." || t == ".." {
+		return errors.New("the filename template must not contain a path")
+	}
+
+	return nil
+}
+
+// Name of a recording of the given stream, the title may turn it into a path
+func (s UserSettings) Filename(stream StreamInfo) (string, error) {
+	template := s.FilenameTemplate
+	if template == "" {
+		template = defaultFilenameTemplate
+	}
+
+	name := strings.NewReplacer(
+		"{user}", stream.UserName,
+		// the title is chosen by the streamer, it can't be trusted as a path
+		"{title}", strings.NewReplacer("/", "_", `\`, "_").Replace(stream.Title),
+		"{date}", time.Now().Format(time.ANSIC),
+	).Replace(template)
+
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid recording filename %q", name)
+	}
+
+	return name, nil
 }